@@ -1,6 +1,7 @@
 package wgo
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/xiaocairen/wgo/config"
@@ -12,24 +13,35 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
 var (
-	appinst *app
-	oncerun sync.Once
+	appinst  *app
+	onceinst sync.Once
 )
 
 type WebsocketHandler func(w http.ResponseWriter, r *http.Request, c *config.Configurator, s *service.Service)
 type Tasker func(c *config.Configurator, s *service.Service)
+
+// ContextTasker is a Tasker told to stop by its ctx, which Shutdown cancels.
+type ContextTasker func(ctx context.Context, c *config.Configurator, s *service.Service)
+
 type Finally func(w *HttpResponse, r *HttpRequest)
+type NotFound func(w *HttpResponse, r *HttpRequest)
+type MethodNotAllowed func(w *HttpResponse, r *HttpRequest, allow []string)
+type PanicHandler func(w *HttpResponse, r *HttpRequest, err any)
 
 type app struct {
 	debug                        bool
+	logger                       *log.Logger
+	codecs                       *codecRegistry
+	workDir                      string
 	configurator                 *config.Configurator
 	servicer                     *service.Servicer
 	router                       *router
@@ -41,12 +53,87 @@ type app struct {
 	templatePath                 string
 	templateFuncs                template.FuncMap
 	websocketHandlers            map[string]WebsocketHandler
-	taskers                      []Tasker
+	websockets                   wsSet
+	sessionStore                 SessionStore
+	sessions                     *sessions
+	cookies                      *cookies
+	auth                         *authenticator
+	policy                       *Policy
+	taskers                      []task
 	finally                      Finally
+	notFound                     NotFound
+	methodNotAllowed             MethodNotAllowed
+	panicHandler                 PanicHandler
+	validationFormatter          ValidationFormatter
+	timeLayout                   string
+	middlewares                  []Middleware
+	servers                      []*http.Server
+	certReloader                 *certReloader
+	listeners                    []namedListener
+	inherited                    listenerPool
+	stopTaskers                  context.CancelFunc
+	taskerGroup                  sync.WaitGroup
+	runOnce                      sync.Once
+	shutdownOnce                 sync.Once
+	shutdownErr                  error
+	done                         chan struct{}
+}
+
+// Options of New, ConfigFile and the files named in it are relative to
+// WorkDir, which defaults to the current working dir. ConfigFile defaults to
+// app.json and is not read when Configurator is given.
+type Options struct {
+	ConfigFile   string
+	WorkDir      string
+	Configurator *config.Configurator
 }
 
-func init() {
-	if nil == appinst {
+// New creates an app that shares no state with the other ones, it does not
+// change the working dir of the process. the listeners passed to the process
+// by Upgrade or systemd go to the first app created.
+func New(opts Options) (*app, error) {
+	var err error
+	if "" == opts.WorkDir {
+		if opts.WorkDir, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	}
+	if "" == opts.ConfigFile {
+		opts.ConfigFile = "app.json"
+	}
+
+	var this = &app{
+		workDir:           opts.WorkDir,
+		configurator:      opts.Configurator,
+		logger:            log.Default(),
+		codecs:            newCodecRegistry(),
+		websocketHandlers: make(map[string]WebsocketHandler),
+		done:              make(chan struct{}),
+	}
+	if nil == this.configurator {
+		if this.configurator, err = config.Load(this.path(opts.ConfigFile)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = this.configurator.GetBool("debug", &this.debug); err != nil {
+		return nil, err
+	}
+	if err = this.openDB(); err != nil {
+		return nil, err
+	}
+	if err = this.initLogger(); err != nil {
+		return nil, err
+	}
+	this.inherited.list = takeInheritedListeners()
+	return this, nil
+}
+
+// GetApp returns the default app, created on the first call from app.json in
+// the dir of the binary, which also becomes the working dir of the process.
+// it panics when the app can't be created.
+func GetApp() *app {
+	onceinst.Do(func() {
 		path, err := filepath.Abs(filepath.Dir(os.Args[0]))
 		if err != nil {
 			log.Panic(err)
@@ -55,112 +142,222 @@ func init() {
 			log.Panic("unable to change working dir " + err.Error())
 		}
 
-		appinst = &app{
-			configurator:      config.New("app.json"),
-			websocketHandlers: make(map[string]WebsocketHandler),
-		}
-
-		if err = appinst.configurator.GetBool("debug", &appinst.debug); err != nil {
+		if appinst, err = New(Options{WorkDir: path}); err != nil {
 			log.Panic(err)
 		}
+		if appinst.logger != log.Default() {
+			log.SetFlags(appinst.logger.Flags())
+			log.SetOutput(appinst.logger.Writer())
+		}
+	})
+	return appinst
+}
 
-		var dbTestPing bool
-		appinst.configurator.GetBool("db_test_ping", &dbTestPing)
+// openDB opens the pools of the database section, errors only count when
+// db_test_ping is true, otherwise the app runs without database.
+func (this *app) openDB() error {
+	var dbTestPing bool
+	this.configurator.GetBool("db_test_ping", &dbTestPing)
 
-		dbc, err := appinst.configurator.Get("database")
-		if nil != err {
-			if dbTestPing {
-				log.Panic(err)
-			}
-			return
+	var dbcs []*mdb.DBConfig
+	dbc, err := this.configurator.Get("database")
+	if nil == err {
+		err = parseDBConfig(dbc, &dbcs)
+	}
+
+	var db *mdb.DB
+	if nil == err {
+		db, err = mdb.Open(dbcs, dbTestPing)
+	}
+	if nil != err {
+		if dbTestPing {
+			return err
 		}
+		db, _ = mdb.Open(nil, false)
+	}
 
-		var dbcs []*mdb.DBConfig
-		if err := parseDBConfig(dbc, &dbcs); err != nil {
-			if dbTestPing {
-				log.Panic(err)
-			}
-			return
+	this.servicer = service.Open(db)
+	return nil
+}
+
+// path returns p relative to the work dir of the app.
+func (this *app) path(p string) string {
+	if "" == p || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(this.workDir, p)
+}
+
+// Run serves http until the process gets SIGINT or SIGTERM, or Shutdown is
+// called, and returns once the shutdown sequence is over.
+func (this *app) Run() {
+	this.runOnce.Do(func() {
+		// a signal coming while the app starts waits in sig until the
+		// servers are created.
+		var sig = notifySignals()
+		handler, e := this.build()
+		if e != nil {
+			log.Fatal(e)
 		}
 
-		db, err := mdb.NewDB(dbcs, dbTestPing)
-		if err != nil {
-			if dbTestPing {
-				log.Panic(err)
-			}
-			return
+		var ctx context.Context
+		ctx, this.stopTaskers = context.WithCancel(context.Background())
+		this.startTaskers(ctx)
+
+		// the signals are handled once every server is created, Shutdown
+		// and Upgrade see all of them.
+		serves, e := this.newServers(handler)
+		if e != nil {
+			log.Fatal(e)
+		}
+		go this.waitSignal(sig)
+		if e = this.wait(serves); e != nil {
+			log.Fatal(e)
 		}
+	})
+}
 
-		appinst.servicer = service.NewServicer(db)
+// build registers the routes and returns the handler of the app, or the error
+// of a store it can't open.
+func (this *app) build() (http.Handler, error) {
+	this.router = &router{RouteCollection: this.routeCollection}
+	var (
+		hc          = this.getHttpConfig()
+		s           = &server{app: this, Configurator: this.configurator, Router: this.router, maxBodyBytes: hc.MaxBodyBytes, maxMultipartMemory: hc.MaxMultipartMemory, wsOptions: hc.wsOptions()}
+		middlewares = this.middlewares
+	)
+	if rt := hc.RequestTimeout; rt > 0 {
+		middlewares = append([]Middleware{RequestTimeout(time.Duration(rt) * time.Second)}, middlewares...)
 	}
+	s.handler = chainRoute(nil, middlewares, s.handle)
+	this.cookies = this.newCookies()
+	var err error
+	if this.sessions, err = this.newSessions(); err != nil {
+		return nil, err
+	}
+	this.auth = this.newAuthenticator()
+	this.policy = this.newPolicy()
+	this.reqControllerInjectorChain = append([]RequestControllerInjector{principalInjector{}}, this.reqControllerInjectorChain...)
+	this.router.init([]RouteControllerInjector{s}, s.action)
+	this.checkPolicy()
 
-	initLogger()
-}
+	this.servicer.Registe(this.tableCollection)
 
-func GetApp() *app {
-	return appinst
+	var (
+		mux  = http.NewServeMux()
+		dirs = this.getStaticFileDirs()
+	)
+	if len(dirs) > 0 {
+		for _, dir := range dirs {
+			mux.Handle("/"+dir+"/", http.FileServer(http.Dir(this.path("web"))))
+		}
+		mux.Handle("/favicon.ico", http.FileServer(http.Dir(this.path("web"))))
+	}
+	if this.getHttpConfig().UseWebsocket && len(this.websocketHandlers) > 0 {
+		for url, handler := range this.websocketHandlers {
+			mux.HandleFunc(url, func(w http.ResponseWriter, r *http.Request) {
+				handler(w, r, this.configurator, this.servicer.New())
+			})
+		}
+	}
+
+	mux.Handle("/", s)
+	return mux, nil
 }
 
-func (this *app) Run() {
-	oncerun.Do(func() {
-		this.router = &router{RouteCollection: this.routeCollection}
-		var s = &server{app: this, Configurator: this.configurator, Router: this.router}
-		this.router.init([]RouteControllerInjector{s})
-
-		this.servicer.Registe(this.tableCollection)
-		this.startTaskers()
-
-		var (
-			host, port, enableWebsocket = this.getHostAndPort()
-			mux                         = http.NewServeMux()
-			dirs                        = this.getStaticFileDirs()
-		)
-		if len(dirs) > 0 {
-			for _, dir := range dirs {
-				mux.Handle("/"+dir+"/", http.FileServer(http.Dir("web")))
+// Shutdown stops accepting connections and waits for the requests in flight,
+// closes the websockets with WSCloseGoingAway, then cancels the context of
+// the ContextTaskers, waits for them to return and closes the database
+// pools. ctx bounds the whole sequence, the pools are closed even if it
+// expires.
+func (this *app) Shutdown(ctx context.Context) error {
+	this.shutdownOnce.Do(func() {
+		defer close(this.done)
+
+		for _, srv := range this.servers {
+			if e := srv.Shutdown(ctx); e != nil && nil == this.shutdownErr {
+				this.shutdownErr = e
 			}
-			mux.Handle("/favicon.ico", http.FileServer(http.Dir("web")))
 		}
-		if enableWebsocket && len(this.websocketHandlers) > 0 {
-			for url, handler := range this.websocketHandlers {
-				mux.HandleFunc(url, func(w http.ResponseWriter, r *http.Request) {
-					handler(w, r, this.configurator, this.servicer.New())
-				})
+		this.websockets.closeAll(WSCloseGoingAway, "server shutting down")
+		this.inherited.close()
+
+		if nil != this.stopTaskers {
+			this.stopTaskers()
+		}
+		var stopped = make(chan struct{})
+		go func() {
+			this.taskerGroup.Wait()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			if nil == this.shutdownErr {
+				this.shutdownErr = ctx.Err()
 			}
 		}
 
-		mux.Handle("/", s)
-
-		var httpServer = &http.Server{
-			Addr:              host + ":" + strconv.Itoa(port),
-			Handler:           mux,
-			TLSConfig:         nil,
-			ReadTimeout:       30 * time.Second,
-			ReadHeaderTimeout: 0,
-			WriteTimeout:      30 * time.Second,
-			IdleTimeout:       0,
-			MaxHeaderBytes:    1 << 20,
-		}
-		if e := httpServer.ListenAndServe(); e != nil {
-			log.Fatal(e)
+		if nil != this.servicer {
+			if e := this.servicer.Close(); e != nil && nil == this.shutdownErr {
+				this.shutdownErr = e
+			}
 		}
 	})
+	return this.shutdownErr
 }
 
-func (this *app) getHostAndPort() (host string, port int, enableWebSocket bool) {
-	h := struct {
-		Addr         string `json:"addr"`
-		Port         int    `json:"port"`
-		UseWebsocket bool   `json:"use_websocket"`
-	}{}
-	if err := this.configurator.GetStruct("http", &h); err != nil {
-		panic(err)
+// notifySignals catches SIGINT, SIGTERM, SIGHUP and the upgrade signal for
+// waitSignal.
+func notifySignals() chan os.Signal {
+	var sig = make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	if len(upgradeSignals) > 0 {
+		signal.Notify(sig, upgradeSignals...)
 	}
+	return sig
+}
 
-	host = h.Addr
-	port = h.Port
-	enableWebSocket = h.UseWebsocket
-	return
+// waitSignal shuts the app down on SIGINT or SIGTERM, with https enabled
+// SIGHUP reloads the certificate, it is ignored otherwise. SIGUSR2 starts the
+// new binary with the listeners of this process and then shuts this one down.
+func (this *app) waitSignal(sig chan os.Signal) {
+	defer signal.Stop(sig)
+
+	for stop := false; !stop; {
+		select {
+		case s := <-sig:
+			if isUpgradeSignal(s) {
+				if e := this.Upgrade(); e != nil {
+					this.logger.Printf("upgrade: %s", e)
+					continue
+				}
+				this.logger.Printf("new process started, shutting down")
+				stop = true
+				continue
+			}
+			if syscall.SIGHUP == s {
+				if nil == this.certReloader {
+					this.logger.Printf("received signal %s, no certificate to reload", s)
+				} else if e := this.certReloader.reload(); e != nil {
+					this.logger.Printf("reload certificate: %s", e)
+				} else {
+					this.logger.Printf("certificate reloaded")
+				}
+				continue
+			}
+			this.logger.Printf("received signal %s, shutting down", s)
+			stop = true
+		case <-this.done:
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(this.getHttpConfig().ShutdownTimeout)*time.Second)
+	defer cancel()
+	if e := this.Shutdown(ctx); e != nil {
+		this.logger.Printf("shutdown: %s", e)
+	}
 }
 
 func (this *app) getStaticFileDirs() []string {
@@ -179,16 +376,29 @@ func (this *app) getStaticFileDirs() []string {
 	return sd
 }
 
-func (this *app) startTaskers() {
-	for _, tasker := range this.taskers {
-		go func(t Tasker) {
+// task is a tasker added to the app, Shutdown waits only for the ones that
+// get a ctx.
+type task struct {
+	run  ContextTasker
+	wait bool
+}
+
+func (this *app) startTaskers(ctx context.Context) {
+	for _, t := range this.taskers {
+		if t.wait {
+			this.taskerGroup.Add(1)
+		}
+		go func(t task) {
+			if t.wait {
+				defer this.taskerGroup.Done()
+			}
 			defer func() {
 				if e := recover(); e != nil {
-					log.Printf("%s", e)
+					this.logger.Printf("%s", e)
 				}
 			}()
-			t(this.configurator, this.servicer.New())
-		}(tasker)
+			t.run(ctx, this.configurator, this.servicer.New())
+		}(t)
 	}
 }
 
@@ -222,6 +432,15 @@ func (this *app) SetHtmlPath(path string) *app {
 	return this
 }
 
+// SetTimeLayout sets the layout time.Time action params are parsed with,
+// time.RFC3339 by default.
+func (this *app) SetTimeLayout(layout string) *app {
+	if "" == this.timeLayout {
+		this.timeLayout = layout
+	}
+	return this
+}
+
 func (this *app) SetHtmlFuncs(fnmap template.FuncMap) *app {
 	if nil == this.templateFuncs {
 		this.templateFuncs = fnmap
@@ -229,16 +448,39 @@ func (this *app) SetHtmlFuncs(fnmap template.FuncMap) *app {
 	return this
 }
 
+// Use adds global middlewares, they run for every request in the order added,
+// before the route is searched.
+func (this *app) Use(middlewares ...Middleware) *app {
+	this.middlewares = append(this.middlewares, middlewares...)
+	return this
+}
+
+// AddWebsocketHandler mounts a raw handler outside the router when
+// use_websocket is set. a route whose action returns a WebSocket is served
+// by the native implementation instead, with its middlewares and Finally.
 func (this *app) AddWebsocketHandler(url string, handler WebsocketHandler) *app {
 	this.websocketHandlers[url] = handler
 	return this
 }
 
+// AddTasker adds a func run in its own goroutine by Run, Shutdown doesn't
+// wait for it.
 func (this *app) AddTasker(tasker Tasker) *app {
-	this.taskers = append(this.taskers, tasker)
+	this.taskers = append(this.taskers, task{run: func(_ context.Context, c *config.Configurator, s *service.Service) {
+		tasker(c, s)
+	}})
+	return this
+}
+
+// AddContextTasker adds a func run in its own goroutine by Run, it should
+// return soon after ctx is done. Shutdown waits for it.
+func (this *app) AddContextTasker(tasker ContextTasker) *app {
+	this.taskers = append(this.taskers, task{run: tasker, wait: true})
 	return this
 }
 
+// SetFinally sets a func run at the end of every request, after the
+// PanicHandler when the action panicked.
 func (this *app) SetFinally(f Finally) *app {
 	if nil == this.finally {
 		this.finally = f
@@ -246,34 +488,85 @@ func (this *app) SetFinally(f Finally) *app {
 	return this
 }
 
+// SetNotFound replaces the default 404 response, the handler must write the
+// status code itself.
+func (this *app) SetNotFound(f NotFound) *app {
+	if nil == this.notFound {
+		this.notFound = f
+	}
+	return this
+}
+
+// SetMethodNotAllowed replaces the default 405 response, the Allow header is
+// already set when the handler is called.
+func (this *app) SetMethodNotAllowed(f MethodNotAllowed) *app {
+	if nil == this.methodNotAllowed {
+		this.methodNotAllowed = f
+	}
+	return this
+}
+
+// SetPanicHandler replaces the default 500 response sent when an action
+// panics.
+func (this *app) SetPanicHandler(f PanicHandler) *app {
+	if nil == this.panicHandler {
+		this.panicHandler = f
+	}
+	return this
+}
+
+// SetValidationFormatter replaces the default 400 response sent when the
+// params of an action fail binding or validation.
+func (this *app) SetValidationFormatter(f ValidationFormatter) *app {
+	if nil == this.validationFormatter {
+		this.validationFormatter = f
+	}
+	return this
+}
+
 func (this *app) GetConfigurator() *config.Configurator {
 	return this.configurator
 }
 
-func initLogger() {
+func (this *app) initLogger() error {
 	var outer int
-	if e := appinst.configurator.GetInt("log_outer", &outer); e != nil {
-		log.Panic(e)
+	if e := this.configurator.GetInt("log_outer", &outer); e != nil {
+		return e
 	}
 
 	if outer == 0 {
-		return
+		return nil
 	}
 
-	if _, err := os.Stat("log"); nil != err {
+	var dir = this.path("log")
+	if _, err := os.Stat(dir); nil != err {
 		if !os.IsExist(err) {
-			if err := os.Mkdir("log", os.ModePerm); nil != err {
-				log.Panic(err)
+			if err := os.Mkdir(dir, os.ModePerm); nil != err {
+				return err
 			}
 		}
 	}
 
-	f, err := os.OpenFile("log/wgo.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	f, err := os.OpenFile(filepath.Join(dir, "wgo.log"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	this.logger = log.New(f, "", log.Ldate|log.Lmicroseconds|log.Lshortfile)
+	return nil
+}
+
+// Logger returns the logger of the app, the one of the process unless
+// log_outer is set, then it writes to log/wgo.log.
+func (this *app) Logger() *log.Logger {
+	return this.logger
+}
+
+// logf logs with l, or with the logger of the process when l is nil.
+func logf(l *log.Logger, format string, v ...any) {
+	if nil == l {
+		l = log.Default()
 	}
-	log.SetFlags(log.Ldate | log.Lmicroseconds | log.Lshortfile)
-	log.SetOutput(f)
+	l.Output(2, fmt.Sprintf(format, v...))
 }
 
 func parseDBConfig(dbc any, dbcs *[]*mdb.DBConfig) error {
@@ -345,7 +638,7 @@ func parseDBConfig(dbc any, dbcs *[]*mdb.DBConfig) error {
 				*dbcs = append(*dbcs, &c)
 
 			default:
-				fmt.Errorf("write database config is invalid")
+				return fmt.Errorf("write database config is invalid")
 			}
 		}
 
@@ -364,7 +657,7 @@ func parseDBConfig(dbc any, dbcs *[]*mdb.DBConfig) error {
 		}
 
 	default:
-		fmt.Errorf("database config is invalid")
+		return fmt.Errorf("database config is invalid")
 	}
 	return nil
 }
@@ -0,0 +1,360 @@
+package wgo
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/xiaocairen/wgo/config"
+	"github.com/xiaocairen/wgo/service"
+)
+
+// newTestApp creates an app of the config in a temporary work dir, with
+// "debug", "log_outer" and "http" set when they are missing.
+func newTestApp(t *testing.T, conf map[string]any) *app {
+	t.Helper()
+	if nil == conf {
+		conf = map[string]any{}
+	}
+	for k, v := range map[string]any{"debug": false, "log_outer": 0, "http": map[string]any{"addr": "127.0.0.1", "port": 0}} {
+		if _, ok := conf[k]; !ok {
+			conf[k] = v
+		}
+	}
+	var dir = t.TempDir()
+	b, _ := json.Marshal(conf)
+	if e := os.WriteFile(filepath.Join(dir, "app.json"), b, 0600); e != nil {
+		t.Fatal(e)
+	}
+	a, e := New(Options{WorkDir: dir})
+	if e != nil {
+		t.Fatal(e)
+	}
+	return a
+}
+
+// serveTestApp serves the app until the test ends.
+func serveTestApp(t *testing.T, a *app) *httptest.Server {
+	t.Helper()
+	handler, e := a.build()
+	if e != nil {
+		t.Fatal(e)
+	}
+	var ts = httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func testGet(t *testing.T, client *http.Client, req *http.Request) (int, string) {
+	t.Helper()
+	if nil == client {
+		client = http.DefaultClient
+	}
+	resp, e := client.Do(req)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+// newJarClient keeps the cookies the app sets.
+func newJarClient(t *testing.T) *http.Client {
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return &http.Client{Jar: jar}
+}
+
+type helloController struct {
+	WgoController
+}
+
+func (this *helloController) Hello() []byte {
+	return []byte("hello")
+}
+
+func TestNew(t *testing.T) {
+	var (
+		a = newTestApp(t, map[string]any{"debug": true})
+		b = newTestApp(t, map[string]any{"log_outer": 1})
+	)
+	if !a.debug || b.debug {
+		t.Fatalf("debug = %v %v", a.debug, b.debug)
+	}
+	if a.workDir == b.workDir || a.servicer == b.servicer {
+		t.Fatal("the apps share their state")
+	}
+
+	if a.Logger() != log.Default() || b.Logger() == log.Default() {
+		t.Fatal("only the app of log_outer 1 has its own logger")
+	}
+	b.Logger().Print("to the file")
+	if data, e := os.ReadFile(filepath.Join(b.workDir, "log", "wgo.log")); e != nil || !strings.Contains(string(data), "to the file") {
+		t.Fatalf("log/wgo.log = %q %v", data, e)
+	}
+
+	for _, x := range []*app{a, b} {
+		x.SetRouteCollection(func(r *RouteRegister) {
+			r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+				m.Get("/hello", &helloController{}, "Hello()")
+			})
+		})
+		req, _ := http.NewRequest(GET, serveTestApp(t, x).URL+"/hello", nil)
+		if code, body := testGet(t, nil, req); 200 != code || "hello" != body {
+			t.Fatalf("got %d %q", code, body)
+		}
+	}
+
+	if _, e := New(Options{WorkDir: t.TempDir()}); nil == e {
+		t.Fatal("created without app.json")
+	}
+	if _, e := New(Options{WorkDir: a.workDir, ConfigFile: "other.json"}); nil == e {
+		t.Fatal("created without other.json")
+	}
+}
+
+type bodyController struct {
+	WgoController
+}
+
+func (this *bodyController) Echo() []byte {
+	b, e := this.Request.Body()
+	if e != nil {
+		return []byte("error: " + e.Error())
+	}
+	return b
+}
+
+func (this *bodyController) Form() []byte {
+	return []byte("name=" + this.Request.GetPost("name"))
+}
+
+func TestMaxBodySize(t *testing.T) {
+	var (
+		a    = newTestApp(t, map[string]any{"http": map[string]any{"addr": "127.0.0.1", "port": 0, "max_body_bytes": 64}})
+		read = func(next HandlerFunc) HandlerFunc {
+			return func(w *HttpResponse, r *HttpRequest) {
+				if "1" == r.GetHeader("X-Read") {
+					r.Body()
+				}
+				next(w, r)
+			}
+		}
+	)
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Post("/echo", &bodyController{}, "Echo()")
+			m.Post("/form", &bodyController{}, "Form()")
+			um.Post(RouteUnit{Path: "/small", Controller: &bodyController{}, Action: "Echo()", Middlewares: []Middleware{MaxBodySize(8)}})
+		})
+		r.Registe("", "/big", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Post("/echo", &bodyController{}, "Echo()")
+		}, MaxBodySize(1024))
+	})
+	a.Use(MaxBodySize(16), read)
+	var ts = serveTestApp(t, a)
+
+	var cases = []struct {
+		name string
+		path string
+		read bool
+		body string
+		code int
+		want string
+	}{
+		{"global limit", "/echo", false, strings.Repeat("a", 16), http.StatusOK, strings.Repeat("a", 16)},
+		{"over the global limit", "/echo", false, strings.Repeat("a", 17), http.StatusRequestEntityTooLarge, ""},
+		{"read by a global middleware", "/echo", true, strings.Repeat("a", 17), http.StatusRequestEntityTooLarge, ""},
+		{"form values", "/form", false, "name=" + strings.Repeat("a", 20), http.StatusRequestEntityTooLarge, ""},
+		{"route limit", "/small", false, strings.Repeat("a", 9), http.StatusRequestEntityTooLarge, ""},
+		{"route limit read by a global middleware", "/small", true, strings.Repeat("a", 9), http.StatusRequestEntityTooLarge, ""},
+		{"namespace limit over the global one", "/big/echo", true, strings.Repeat("a", 100), http.StatusOK, strings.Repeat("a", 100)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(POST, ts.URL+c.path, strings.NewReader(c.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if c.read {
+				req.Header.Set("X-Read", "1")
+			}
+			code, body := testGet(t, nil, req)
+			if c.code != code {
+				t.Fatalf("status = %d %q, want %d", code, body, c.code)
+			}
+			if http.StatusOK == c.code && c.want != body {
+				t.Fatalf("body = %q, want %q", body, c.want)
+			}
+			if http.StatusRequestEntityTooLarge == c.code && !strings.HasPrefix(body, `{"code":413`) {
+				t.Fatalf("body = %q", body)
+			}
+		})
+	}
+}
+
+type pipelineController struct {
+	WgoController
+}
+
+func (this *pipelineController) Hello() []byte {
+	return []byte("hello")
+}
+
+func (this *pipelineController) Boom() []byte {
+	panic("boom")
+}
+
+// countInterceptor counts its calls, the field is exported to be copied with
+// the interceptor.
+type countInterceptor struct {
+	Calls *int
+}
+
+func (this *countInterceptor) Before(router Router, svc *service.Service, r *HttpRequest, w *HttpResponse) (bool, []byte) {
+	*this.Calls++
+	return true, nil
+}
+
+func TestPipeline(t *testing.T) {
+	var (
+		a     = newTestApp(t, map[string]any{"auth": map[string]any{"api_keys": []map[string]any{{"key": "secret-key", "subject": "job", "roles": []string{"admin"}}}}})
+		trace []string
+		calls int
+		mark  = func(name string) Middleware {
+			return func(next HandlerFunc) HandlerFunc {
+				return func(w *HttpResponse, r *HttpRequest) {
+					trace = append(trace, name)
+					next(w, r)
+				}
+			}
+		}
+	)
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.RegisteUnit(NamespaceUnit{Namespace: "/", Interceptor: &countInterceptor{&calls}, Middlewares: []Middleware{mark("namespace")}}, func(um UnitHttpMethod, m HttpMethod) {
+			um.Get(RouteUnit{Path: "/admin", Controller: &pipelineController{}, Action: "Hello()", Roles: []string{"admin"}, Middlewares: []Middleware{mark("route")}})
+			m.Get("/boom", &pipelineController{}, "Boom()")
+		})
+	})
+	a.Use(mark("global"))
+	a.SetFinally(func(w *HttpResponse, r *HttpRequest) { trace = append(trace, "finally") })
+	a.SetPanicHandler(func(w *HttpResponse, r *HttpRequest, e any) {
+		trace = append(trace, "panic")
+		writeError(w, r, http.StatusInternalServerError, "panicked")
+	})
+	var ts = serveTestApp(t, a)
+
+	var cases = []struct {
+		name  string
+		path  string
+		key   string
+		code  int
+		trace string
+		calls int
+	}{
+		{"rejected before the route runs", "/admin", "", http.StatusUnauthorized, "global finally", 0},
+		{"invalid key", "/admin", "nope", http.StatusUnauthorized, "global finally", 0},
+		{"allowed", "/admin", "secret-key", http.StatusOK, "global namespace route finally", 1},
+		{"panic handler then finally", "/boom", "", http.StatusInternalServerError, "global namespace panic finally", 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			trace, calls = nil, 0
+			req, _ := http.NewRequest(GET, ts.URL+c.path, nil)
+			if "" != c.key {
+				req.Header.Set("X-API-Key", c.key)
+			}
+			code, _ := testGet(t, nil, req)
+			if c.code != code {
+				t.Errorf("status = %d, want %d", code, c.code)
+			}
+			if got := strings.Join(trace, " "); c.trace != got {
+				t.Errorf("trace = %q, want %q", got, c.trace)
+			}
+			if c.calls != calls {
+				t.Errorf("interceptor calls = %d, want %d", calls, c.calls)
+			}
+		})
+	}
+}
+
+func TestTaskers(t *testing.T) {
+	var (
+		a       = newTestApp(t, nil)
+		started = make(chan string, 2)
+		stopped = make(chan struct{})
+		block   = make(chan struct{})
+	)
+	defer close(block)
+	a.AddTasker(func(c *config.Configurator, s *service.Service) {
+		started <- "tasker"
+		<-block
+	})
+	a.AddContextTasker(func(ctx context.Context, c *config.Configurator, s *service.Service) {
+		started <- "context tasker"
+		<-ctx.Done()
+		close(stopped)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopTaskers = cancel
+	a.startTaskers(ctx)
+	<-started
+	<-started
+
+	sctx, scancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer scancel()
+	if e := a.Shutdown(sctx); e != nil {
+		t.Fatalf("Shutdown = %v, it waited for the tasker without a context", e)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("Shutdown returned before the context tasker")
+	}
+}
+
+func TestWaitSignal(t *testing.T) {
+	var (
+		a       = newTestApp(t, nil)
+		sig     = make(chan os.Signal)
+		stopped = make(chan struct{})
+	)
+	go func() {
+		a.waitSignal(sig)
+		close(stopped)
+	}()
+
+	// sig is unbuffered, the second SIGHUP is received once the first one is
+	// handled.
+	sig <- syscall.SIGHUP
+	sig <- syscall.SIGHUP
+	select {
+	case <-a.done:
+		t.Fatal("SIGHUP without a certificate shut the app down")
+	default:
+	}
+
+	sig <- syscall.SIGTERM
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("SIGTERM did not shut the app down")
+	}
+	select {
+	case <-a.done:
+	default:
+		t.Fatal("waitSignal returned before the shutdown")
+	}
+}
@@ -0,0 +1,265 @@
+package wgo
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/xiaocairen/wgo/service"
+)
+
+// authConfig is the "auth" section of app.json, leeway is seconds
+//
+//	"auth": {
+//	  "jwt": {
+//	    "issuer": "https://id.example.com",
+//	    "audience": "orders-api",
+//	    "leeway": 30,
+//	    "roles_claim": "roles",
+//	    "scopes_claim": "scope",
+//	    "keys": [
+//	      {"kid": "k1", "alg": "HS256", "secret": "a long random string"},
+//	      {"kid": "k2", "alg": "RS256", "public_key_file": "keys/rs256.pem"},
+//	      {"kid": "k3", "alg": "EdDSA", "public_key_file": "keys/ed25519.pem"}
+//	    ],
+//	    "jwks_file": "keys/jwks.json"
+//	  },
+//	  "api_key_header": "X-API-Key",
+//	  "api_keys": [
+//	    {"key": "a long random string", "subject": "billing-job", "roles": ["admin"], "scopes": ["orders:read"]}
+//	  ]
+//	}
+//
+// bearer tokens of the Authorization header are checked with the keys and the
+// ones of jwks_file, they must have exp, and iss and aud when issuer and
+// audience are set. the roles and scopes of a token are the claims named by
+// roles_claim and scopes_claim, arrays or space separated strings.
+type authConfig struct {
+	JWT struct {
+		Issuer      string         `json:"issuer"`
+		Audience    string         `json:"audience"`
+		Leeway      int            `json:"leeway"`
+		RolesClaim  string         `json:"roles_claim"`
+		ScopesClaim string         `json:"scopes_claim"`
+		Keys        []jwtKeyConfig `json:"keys"`
+		JWKSFile    string         `json:"jwks_file"`
+	} `json:"jwt"`
+	APIKeyHeader string         `json:"api_key_header"`
+	APIKeys      []apiKeyConfig `json:"api_keys"`
+}
+
+type apiKeyConfig struct {
+	Key     string   `json:"key"`
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles"`
+	Scopes  []string `json:"scopes"`
+}
+
+// Principal is who a request is authenticated as. Claims are the ones of the
+// token, nil for an api key. Method is "jwt", "api_key" or the one set by
+// SetPrincipal.
+type Principal struct {
+	Subject string
+	Roles   []string
+	Scopes  []string
+	Claims  map[string]any
+	Method  string
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return nil != p && contains(p.Roles, role)
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return nil != p && contains(p.Scopes, scope)
+}
+
+// authenticator finds the principal of the requests.
+type authenticator struct {
+	jwt          *jwtVerifier
+	rolesClaim   string
+	scopesClaim  string
+	apiKeyHeader string
+	apiKeys      []apiKey
+}
+
+type apiKey struct {
+	hash      [32]byte
+	principal Principal
+}
+
+func (this *app) newAuthenticator() *authenticator {
+	if _, err := this.configurator.Get("auth"); err != nil {
+		return nil
+	}
+	var c authConfig
+	if err := this.configurator.GetStruct("auth", &c); err != nil {
+		panic(err)
+	}
+
+	var a = &authenticator{rolesClaim: c.JWT.RolesClaim, scopesClaim: c.JWT.ScopesClaim, apiKeyHeader: c.APIKeyHeader}
+	if "" == a.rolesClaim {
+		a.rolesClaim = "roles"
+	}
+	if "" == a.scopesClaim {
+		a.scopesClaim = "scope"
+	}
+	if "" == a.apiKeyHeader {
+		a.apiKeyHeader = "X-API-Key"
+	}
+
+	var keys []*jwtKey
+	for _, kc := range c.JWT.Keys {
+		k, e := kc.key(this.path)
+		if e != nil {
+			log.Panic(e)
+		}
+		keys = append(keys, k)
+	}
+	if "" != c.JWT.JWKSFile {
+		jwks, e := loadJWKS(this.path(c.JWT.JWKSFile))
+		if e != nil {
+			log.Panic(e)
+		}
+		keys = append(keys, jwks...)
+	}
+	if len(keys) > 0 {
+		a.jwt = &jwtVerifier{keys: keys, issuer: c.JWT.Issuer, audience: c.JWT.Audience, leeway: time.Duration(c.JWT.Leeway) * time.Second}
+	}
+
+	for _, kc := range c.APIKeys {
+		if "" == kc.Key {
+			log.Panicf("api key of '%s' is empty", kc.Subject)
+		}
+		a.apiKeys = append(a.apiKeys, apiKey{
+			hash:      sha256.Sum256([]byte(kc.Key)),
+			principal: Principal{Subject: kc.Subject, Roles: kc.Roles, Scopes: kc.Scopes, Method: "api_key"},
+		})
+	}
+	return a
+}
+
+// authenticate returns the principal of the credentials of a request, nil
+// without error when it has none.
+func (a *authenticator) authenticate(r *HttpRequest) (*Principal, error) {
+	if key := r.GetHeader(a.apiKeyHeader); "" != key && len(a.apiKeys) > 0 {
+		var (
+			hash  = sha256.Sum256([]byte(key))
+			found *apiKey
+		)
+		for i := range a.apiKeys {
+			if 1 == subtle.ConstantTimeCompare(hash[:], a.apiKeys[i].hash[:]) {
+				found = &a.apiKeys[i]
+			}
+		}
+		if nil == found {
+			return nil, ErrAPIKeyInvalid
+		}
+		var p = found.principal
+		return &p, nil
+	}
+
+	var authz = r.GetHeader("Authorization")
+	if len(authz) < 7 || !strings.EqualFold(authz[:7], "bearer ") || nil == a.jwt {
+		return nil, nil
+	}
+	claims, e := a.jwt.verify(strings.TrimSpace(authz[7:]), time.Now())
+	if e != nil {
+		return nil, e
+	}
+	var p = &Principal{Roles: stringsClaim(claims[a.rolesClaim]), Scopes: stringsClaim(claims[a.scopesClaim]), Claims: claims, Method: "jwt"}
+	p.Subject, _ = claims["sub"].(string)
+	if "scope" == a.scopesClaim && 0 == len(p.Scopes) {
+		p.Scopes = stringsClaim(claims["scp"])
+	}
+	return p, nil
+}
+
+// Principal returns who the request is authenticated as, nil when it has no
+// valid credentials.
+func (r *HttpRequest) Principal() *Principal {
+	if !r.authDone {
+		r.authDone = true
+		if nil != r.auth {
+			r.principal, r.authErr = r.auth.authenticate(r)
+		}
+	}
+	return r.principal
+}
+
+// SetPrincipal sets who the request is authenticated as, for a global
+// middleware that authenticates it another way. the access of the route is
+// checked before its middlewares run.
+func (r *HttpRequest) SetPrincipal(p *Principal) {
+	r.principal, r.authErr, r.authDone = p, nil, true
+}
+
+// GetPrincipal returns who the request is authenticated as, nil when nobody.
+func (this *WgoController) GetPrincipal() *Principal {
+	return this.Request.Principal()
+}
+
+// checkAccess answers 401 when the route requires roles, scopes or permissions
+// and the request has no valid credentials, 403 when the principal has none of
+// the Roles, not all the Scopes or not all the Permissions, and returns false
+// then.
+func checkAccess(w *HttpResponse, r *HttpRequest, route *Router) bool {
+	if 0 == len(route.Roles) && 0 == len(route.Scopes) && 0 == len(route.Permissions) {
+		return true
+	}
+
+	var p = r.Principal()
+	if nil == p {
+		var challenge = `Bearer realm="api"`
+		if nil != r.authErr {
+			challenge += `, error="invalid_token", error_description="` + r.authErr.Error() + `"`
+		}
+		w.SetHeader("WWW-Authenticate", challenge)
+		writeError(w, r, http.StatusUnauthorized, "authentication required")
+		return false
+	}
+
+	var allowed = 0 == len(route.Roles)
+	for _, role := range route.Roles {
+		if p.HasRole(role) {
+			allowed = true
+			break
+		}
+	}
+	for _, scope := range route.Scopes {
+		if !p.HasScope(scope) {
+			allowed = false
+			break
+		}
+	}
+	if allowed && len(route.Permissions) > 0 {
+		allowed = r.policy.Allows(p, route.Permissions...)
+	}
+	if !allowed {
+		writeError(w, r, http.StatusForbidden, "access denied")
+	}
+	return allowed
+}
+
+var principalType = reflect.TypeOf(&Principal{})
+
+// principalInjector sets the exported *wgo.Principal fields of the
+// controllers to the principal of the request.
+type principalInjector struct{}
+
+func (principalInjector) InjectRequestController(router Router, cve reflect.Value, svc *service.Service) {
+	req, ok := cve.FieldByName("Request").Interface().(*HttpRequest)
+	if !ok || nil == req {
+		return
+	}
+	var t = cve.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if sf := t.Field(i); sf.IsExported() && sf.Type == principalType {
+			cve.Field(i).Set(reflect.ValueOf(req.Principal()))
+		}
+	}
+}
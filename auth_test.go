@@ -0,0 +1,321 @@
+package wgo
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+type testKeys struct {
+	hsSecret []byte
+	rsa      *rsa.PrivateKey
+	ed       ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rk, e := rsa.GenerateKey(rand.Reader, 2048)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, ek, e := ed25519.GenerateKey(rand.Reader)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return &testKeys{hsSecret: []byte("a secret of the tests"), rsa: rk, ed: ek}
+}
+
+// sign makes a token of the claims with alg, signed by the key of alg unless
+// alg is "none".
+func (k *testKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	var header = map[string]any{"alg": alg, "typ": "JWT"}
+	if "" != kid {
+		header["kid"] = kid
+	}
+	hb, _ := json.Marshal(header)
+	cb, _ := json.Marshal(claims)
+	var (
+		signed = b64.EncodeToString(hb) + "." + b64.EncodeToString(cb)
+		sig    []byte
+	)
+	switch alg {
+	case "HS256":
+		m := hmac.New(sha256.New, k.hsSecret)
+		m.Write([]byte(signed))
+		sig = m.Sum(nil)
+	case "RS256":
+		h := sha256.Sum256([]byte(signed))
+		var e error
+		if sig, e = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, h[:]); e != nil {
+			t.Fatal(e)
+		}
+	case "EdDSA":
+		sig = ed25519.Sign(k.ed, []byte(signed))
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func TestJWTVerify(t *testing.T) {
+	var (
+		keys = newTestKeys(t)
+		now  = time.Unix(1700000000, 0)
+		exp  = now.Add(time.Hour).Unix()
+		v    = &jwtVerifier{
+			keys: []*jwtKey{
+				{kid: "hs", alg: "HS256", secret: keys.hsSecret},
+				{kid: "rs", alg: "RS256", rsa: &keys.rsa.PublicKey},
+				{kid: "ed", alg: "EdDSA", ed: keys.ed.Public().(ed25519.PublicKey)},
+			},
+			issuer:   "https://id.example.com",
+			audience: "orders-api",
+			leeway:   30 * time.Second,
+		}
+		claims = func(extra map[string]any) map[string]any {
+			var c = map[string]any{"sub": "u1", "iss": "https://id.example.com", "aud": "orders-api", "exp": exp}
+			for k, i := range extra {
+				if nil == i {
+					delete(c, k)
+				} else {
+					c[k] = i
+				}
+			}
+			return c
+		}
+	)
+
+	// an HS256 token whose secret is the pem of the RSA public key, the way a
+	// verifier trusting the alg of the header is fooled.
+	pub, _ := x509.MarshalPKIXPublicKey(&keys.rsa.PublicKey)
+	var confused = &testKeys{hsSecret: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})}
+	var rsOnly = &jwtVerifier{keys: []*jwtKey{{kid: "rs", alg: "RS256", rsa: &keys.rsa.PublicKey}}}
+
+	var tampered = keys.sign(t, "RS256", "rs", claims(nil))
+	tampered = tampered[:len(tampered)-4] + strings.Map(func(r rune) rune {
+		if 'A' == r {
+			return 'B'
+		}
+		return 'A'
+	}, tampered[len(tampered)-4:])
+
+	var cases = []struct {
+		name     string
+		verifier *jwtVerifier
+		token    string
+		err      error
+	}{
+		{"hs256", v, keys.sign(t, "HS256", "hs", claims(nil)), nil},
+		{"rs256", v, keys.sign(t, "RS256", "rs", claims(nil)), nil},
+		{"eddsa", v, keys.sign(t, "EdDSA", "ed", claims(nil)), nil},
+		{"no kid tries every key of the alg", v, keys.sign(t, "RS256", "", claims(nil)), nil},
+		{"kid of another key", v, keys.sign(t, "RS256", "ed", claims(nil)), ErrTokenInvalid},
+		{"unknown kid", v, keys.sign(t, "HS256", "other", claims(nil)), ErrTokenInvalid},
+		{"hs256 against an rs256 key", rsOnly, confused.sign(t, "HS256", "rs", claims(nil)), ErrTokenInvalid},
+		{"alg none", v, keys.sign(t, "none", "", claims(nil)), ErrTokenInvalid},
+		{"tampered signature", v, tampered, ErrTokenInvalid},
+		{"tampered claims", v, strings.Replace(keys.sign(t, "HS256", "hs", claims(nil)), ".", "."+b64.EncodeToString([]byte(`{"sub":"admin"}`))+"x", 1), ErrTokenInvalid},
+		{"not a token", v, "abc.def", ErrTokenInvalid},
+		{"missing exp", v, keys.sign(t, "HS256", "hs", claims(map[string]any{"exp": nil})), ErrTokenInvalid},
+		{"expired", v, keys.sign(t, "HS256", "hs", claims(map[string]any{"exp": now.Add(-time.Minute).Unix()})), ErrTokenExpired},
+		{"expired within leeway", v, keys.sign(t, "HS256", "hs", claims(map[string]any{"exp": now.Add(-10 * time.Second).Unix()})), nil},
+		{"nbf in the future", v, keys.sign(t, "HS256", "hs", claims(map[string]any{"nbf": now.Add(time.Minute).Unix()})), ErrTokenInvalid},
+		{"nbf within leeway", v, keys.sign(t, "HS256", "hs", claims(map[string]any{"nbf": now.Add(10 * time.Second).Unix()})), nil},
+		{"wrong iss", v, keys.sign(t, "HS256", "hs", claims(map[string]any{"iss": "https://evil.example.com"})), ErrTokenInvalid},
+		{"missing iss", v, keys.sign(t, "HS256", "hs", claims(map[string]any{"iss": nil})), ErrTokenInvalid},
+		{"aud array", v, keys.sign(t, "HS256", "hs", claims(map[string]any{"aud": []string{"billing", "orders-api"}})), nil},
+		{"aud array without the audience", v, keys.sign(t, "HS256", "hs", claims(map[string]any{"aud": []string{"billing"}})), ErrTokenInvalid},
+		{"wrong aud", v, keys.sign(t, "HS256", "hs", claims(map[string]any{"aud": "billing"})), ErrTokenInvalid},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, e := c.verifier.verify(c.token, now)
+			if e != c.err {
+				t.Fatalf("verify error = %v, want %v", e, c.err)
+			}
+			if nil == c.err && "u1" != got["sub"] {
+				t.Fatalf("sub = %v, want u1", got["sub"])
+			}
+		})
+	}
+}
+
+func TestLoadJWKS(t *testing.T) {
+	var (
+		keys = newTestKeys(t)
+		edp  = keys.ed.Public().(ed25519.PublicKey)
+		jwks = map[string]any{"keys": []map[string]any{
+			{"kty": "RSA", "kid": "rs", "use": "sig", "n": b64.EncodeToString(keys.rsa.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(keys.rsa.E)).Bytes())},
+			{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64.EncodeToString(edp)},
+			{"kty": "oct", "kid": "hs", "k": b64.EncodeToString(keys.hsSecret)},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+			{"kty": "EC", "kid": "ec", "crv": "P-256"},
+			{"kty": "OKP", "kid": "x", "crv": "X25519", "x": "AAAA"},
+		}}
+		file = filepath.Join(t.TempDir(), "jwks.json")
+	)
+	b, _ := json.Marshal(jwks)
+	if e := os.WriteFile(file, b, 0600); e != nil {
+		t.Fatal(e)
+	}
+
+	list, e := loadJWKS(file)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var algs []string
+	for _, k := range list {
+		algs = append(algs, k.kid+":"+k.alg)
+	}
+	if "rs:RS256 ed:EdDSA hs:HS256" != strings.Join(algs, " ") {
+		t.Fatalf("keys = %v", algs)
+	}
+
+	var (
+		v   = &jwtVerifier{keys: list}
+		exp = map[string]any{"sub": "u1", "exp": time.Now().Add(time.Hour).Unix()}
+	)
+	for _, alg := range []string{"RS256", "EdDSA", "HS256"} {
+		if _, e := v.verify(keys.sign(t, alg, "", exp), time.Now()); e != nil {
+			t.Errorf("%s token: %v", alg, e)
+		}
+	}
+
+	os.WriteFile(file, []byte(`{"keys":[{"kty":"OKP","kid":"bad","crv":"Ed25519","x":"AAAA"}]}`), 0600)
+	if _, e = loadJWKS(file); nil == e {
+		t.Error("a short ed25519 key was loaded")
+	}
+	os.WriteFile(file, []byte(`{"keys":`), 0600)
+	if _, e = loadJWKS(file); nil == e {
+		t.Error("invalid json was loaded")
+	}
+}
+
+func newTestAuthenticator(keys *testKeys) *authenticator {
+	var a = &authenticator{
+		jwt:          &jwtVerifier{keys: []*jwtKey{{kid: "hs", alg: "HS256", secret: keys.hsSecret}}},
+		rolesClaim:   "roles",
+		scopesClaim:  "scope",
+		apiKeyHeader: "X-API-Key",
+	}
+	for _, kc := range []apiKeyConfig{
+		{Key: "key-of-billing", Subject: "billing", Roles: []string{"admin"}},
+		{Key: "key-of-reports", Subject: "reports", Scopes: []string{"orders:read"}},
+	} {
+		a.apiKeys = append(a.apiKeys, apiKey{hash: sha256.Sum256([]byte(kc.Key)), principal: Principal{Subject: kc.Subject, Roles: kc.Roles, Scopes: kc.Scopes, Method: "api_key"}})
+	}
+	return a
+}
+
+func newTestRequest(method, target string, header map[string]string) (*HttpResponse, *HttpRequest, *httptest.ResponseRecorder) {
+	var (
+		rec = httptest.NewRecorder()
+		r   = httptest.NewRequest(method, target, nil)
+	)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	var req = &HttpRequest{Request: r, writer: rec}
+	req.init()
+	return &HttpResponse{Writer: &responseWriter{ResponseWriter: rec}}, req, rec
+}
+
+func TestAPIKey(t *testing.T) {
+	var a = newTestAuthenticator(newTestKeys(t))
+	var cases = []struct {
+		key     string
+		subject string
+		err     error
+	}{
+		{"key-of-billing", "billing", nil},
+		{"key-of-reports", "reports", nil},
+		{"key-of-billing ", "", ErrAPIKeyInvalid},
+		{"key-of", "", ErrAPIKeyInvalid},
+		{"", "", nil},
+	}
+	for _, c := range cases {
+		_, req, _ := newTestRequest(GET, "/", map[string]string{"X-API-Key": c.key})
+		p, e := a.authenticate(req)
+		if e != c.err {
+			t.Errorf("key %q: error = %v, want %v", c.key, e, c.err)
+			continue
+		}
+		if "" == c.subject {
+			if nil != p {
+				t.Errorf("key %q: principal %s", c.key, p.Subject)
+			}
+		} else if nil == p || c.subject != p.Subject || "api_key" != p.Method {
+			t.Errorf("key %q: principal %+v, want %s", c.key, p, c.subject)
+		}
+	}
+
+	// the principal of a key is a copy, the one of the key can't be changed.
+	_, req, _ := newTestRequest(GET, "/", map[string]string{"X-API-Key": "key-of-billing"})
+	p, _ := a.authenticate(req)
+	p.Subject = "changed"
+	if "billing" != a.apiKeys[0].principal.Subject {
+		t.Error("the principal of the key was changed")
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	var (
+		keys  = newTestKeys(t)
+		a     = newTestAuthenticator(keys)
+		exp   = time.Now().Add(time.Hour).Unix()
+		token = func(claims map[string]any) string {
+			claims["exp"] = exp
+			return "Bearer " + keys.sign(t, "HS256", "hs", claims)
+		}
+		policy = NewPolicy(map[string][]string{"editor": {"orders:*"}, "viewer": {"orders:read"}})
+	)
+	var cases = []struct {
+		name   string
+		route  Router
+		header map[string]string
+		code   int
+	}{
+		{"public route", Router{}, nil, http.StatusOK},
+		{"no credentials", Router{Roles: []string{"admin"}}, nil, http.StatusUnauthorized},
+		{"invalid token", Router{Roles: []string{"admin"}}, map[string]string{"Authorization": "Bearer abc.def.ghi"}, http.StatusUnauthorized},
+		{"invalid api key", Router{Roles: []string{"admin"}}, map[string]string{"X-API-Key": "nope"}, http.StatusUnauthorized},
+		{"role", Router{Roles: []string{"admin"}}, map[string]string{"X-API-Key": "key-of-billing"}, http.StatusOK},
+		{"missing role", Router{Roles: []string{"admin"}}, map[string]string{"X-API-Key": "key-of-reports"}, http.StatusForbidden},
+		{"scope", Router{Scopes: []string{"orders:read"}}, map[string]string{"Authorization": token(map[string]any{"scope": "orders:read orders:write"})}, http.StatusOK},
+		{"missing scope", Router{Scopes: []string{"orders:write"}}, map[string]string{"Authorization": token(map[string]any{"scope": "orders:read"})}, http.StatusForbidden},
+		{"permission", Router{Permissions: []string{"orders:write"}}, map[string]string{"Authorization": token(map[string]any{"roles": []string{"editor"}})}, http.StatusOK},
+		{"missing permission", Router{Permissions: []string{"orders:write"}}, map[string]string{"Authorization": token(map[string]any{"roles": []string{"viewer"}})}, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, req, rec := newTestRequest(GET, "/", c.header)
+			req.auth, req.policy = a, policy
+			var ok = checkAccess(res, req, &c.route)
+			if ok != (http.StatusOK == c.code) {
+				t.Fatalf("checkAccess = %v", ok)
+			}
+			if !ok && c.code != rec.Code {
+				t.Fatalf("status = %d, want %d", rec.Code, c.code)
+			}
+			if http.StatusUnauthorized == c.code && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer") {
+				t.Fatalf("WWW-Authenticate = %q", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
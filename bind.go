@@ -0,0 +1,486 @@
+package wgo
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StrictBinding makes a request value that doesn't convert to the type of its
+// action param a 400 naming the param, instead of the zero value. use it with
+// app.Use for the whole app, or in the Middlewares of a route.
+func StrictBinding() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w *HttpResponse, r *HttpRequest) {
+			r.strict = true
+			next(w, r)
+		}
+	}
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isScalar reports whether a struct type is bound from a single value rather
+// than field by field.
+func isScalar(t reflect.Type) bool {
+	return t == timeType || t == fileHeaderType || reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// convertible reports whether an action param of type t can be bound, by its
+// reflect.Kind the way convert sets it. structs, maps and arrays are bound from
+// a body or field by field.
+func convertible(t reflect.Type) bool {
+	if isScalar(t) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return convertible(t.Elem())
+	case reflect.Map:
+		return convertible(t.Key()) && convertible(t.Elem())
+	case reflect.Interface:
+		return 0 == t.NumMethod()
+	case reflect.String, reflect.Bool, reflect.Struct,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// declaredKind is the kind named by the type of a param in an Action, like
+// "int32" in "Get(id int32)" or "[]*int", "" for the other types.
+func declaredKind(typ string) string {
+	typ = strings.TrimLeft(typ, "*[]")
+	switch typ {
+	case "any", "interface{}":
+		return reflect.Interface.String()
+	case "byte":
+		return reflect.Uint8.String()
+	case "rune":
+		return reflect.Int32.String()
+	}
+	for k := reflect.Bool; k <= reflect.Float64; k++ {
+		if k.String() == typ {
+			return typ
+		}
+	}
+	if reflect.String.String() == typ {
+		return typ
+	}
+	return ""
+}
+
+// binding converts the request values to the types of the action params by
+// their reflect.Kind. a named type binds as its underlying kind, a type
+// implementing encoding.TextUnmarshaler through UnmarshalText, time.Time with
+// timeLayout and a slice from the repeated values of its key. files is set for
+// a multipart form, *multipart.FileHeader and []*multipart.FileHeader bind
+// from it.
+type binding struct {
+	req        *HttpRequest
+	codecs     *codecRegistry
+	strict     bool
+	timeLayout string
+	files      func(string) []*multipart.FileHeader
+}
+
+// values binds the params from query or form values. structGet gives the
+// values of the struct fields without a source tag, they are left zero when
+// it is nil.
+func (b binding) values(params []methodParam, structGet, get func(string) []string) (errs ValidationErrors) {
+	for k, p := range params {
+		if p.IsStruct {
+			val := reflect.New(p.ParamType)
+			_, errs = b.fields(val.Elem(), "", structGet, p.pathValues, errs)
+			params[k].setStruct(val)
+		} else if isFileType(p.argType()) {
+			params[k].Value = b.fileValue(p.argType(), p.Name).Interface()
+		} else if nil == p.Value {
+			errs = append(errs, b.strings(&params[k], get(p.Name))...)
+		}
+	}
+	return
+}
+
+func (b binding) fileValue(t reflect.Type, name string) reflect.Value {
+	if nil == b.files {
+		return reflect.Zero(t)
+	}
+	return bindFiles(t, b.files(name))
+}
+
+// json binds the struct params from the whole json body, then their fields
+// with a source tag, and the other params from its top level keys, or from
+// the query when get is not nil and has the key.
+func (b binding) json(params []methodParam, body []byte, get func(string) []string) (errs ValidationErrors) {
+	var (
+		m   = make(map[string]any)
+		dec = json.NewDecoder(bytes.NewReader(body))
+	)
+	dec.UseNumber()
+	if e := dec.Decode(&m); e != nil && len(body) > 0 && b.strict {
+		errs = append(errs, bodyError(e)...)
+	}
+
+	for k, p := range params {
+		if p.IsStruct {
+			val := reflect.New(p.ParamType)
+			if e := b.codecs.of("application/json").Decode(body, val.Interface()); e != nil && len(body) > 0 && 0 == len(errs) {
+				errs = append(errs, bodyError(e)...)
+			}
+			_, errs = b.fields(val.Elem(), "", nil, p.pathValues, errs)
+			params[k].setStruct(val)
+		} else if nil == p.Value {
+			if nil != get && len(get(p.Name)) > 0 {
+				errs = append(errs, b.strings(&params[k], get(p.Name))...)
+			} else {
+				errs = append(errs, b.any(&params[k], m[p.Name])...)
+			}
+		}
+	}
+	return
+}
+
+// decode binds the struct params from a body decoded by the codec of its
+// Content-Type, then their fields with a source tag, and the other params
+// from get.
+func (b binding) decode(params []methodParam, body []byte, c Codec, get func(string) []string) (errs ValidationErrors) {
+	for k, p := range params {
+		if p.IsStruct {
+			val := reflect.New(p.ParamType)
+			if e := c.Decode(body, val.Interface()); e != nil && len(body) > 0 && 0 == len(errs) {
+				var ve ValidationErrors
+				if errors.As(e, &ve) {
+					errs = append(errs, ve...)
+				} else {
+					errs = append(errs, FieldError{Rule: "body", Message: "invalid request body: " + e.Error()})
+				}
+			}
+			_, errs = b.fields(val.Elem(), "", nil, p.pathValues, errs)
+			params[k].setStruct(val)
+		} else if isFileType(p.argType()) {
+			params[k].Value = reflect.Zero(p.argType()).Interface()
+		} else if nil == p.Value {
+			errs = append(errs, b.strings(&params[k], get(p.Name))...)
+		}
+	}
+	return
+}
+
+func (p *methodParam) setStruct(val reflect.Value) {
+	if p.ParamKind == reflect.Ptr {
+		p.StructValue = val
+	} else {
+		p.StructValue = val.Elem()
+	}
+}
+
+// sourceTags are the struct tags that name where a field is bound from, in
+// the order they are looked up.
+var sourceTags = []string{"path", "query", "header", "cookie", "form"}
+
+// fields sets the exported fields of a struct from the request and reports
+// whether one of them got a value.
+//
+//	type ListReq struct {
+//		ID     int64     `path:"id"`
+//		Page   int       `query:"page" default:"1"`
+//		Tenant string    `header:"X-Tenant"`
+//		Sid    string    `cookie:"sid"`
+//		Name   string    `form:"name"`
+//		Day    time.Time `json:"day" time_format:"2006-01-02"`
+//		Paging
+//		Filter Filter `json:"filter"`
+//	}
+//
+// a field with a source tag is bound from it, form being the post form then
+// the query and the files of a multipart form. the other fields are bound by
+// their json name from get, the source chosen by method and Content-Type.
+// the fields of an embedded struct are bound as fields of the outer one, the
+// ones of a nested struct without source tag are prefixed by its name and a
+// dot, "filter.status". a field left zero takes its default.
+func (b binding) fields(v reflect.Value, prefix string, get func(string) []string, path map[string]string, errs ValidationErrors) (bound bool, _ ValidationErrors) {
+	var t = v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		var (
+			sf = t.Field(i)
+			fv = v.Field(i)
+			ft = sf.Type
+		)
+		if !sf.IsExported() || "-" == sf.Tag.Get("json") && "" == sourceTag(sf) {
+			continue
+		}
+
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct && !isScalar(ft.Elem()) || ft.Kind() == reflect.Struct && !isScalar(ft) {
+			var (
+				nested = fv
+				next   = prefix + fieldName(sf) + "."
+				ok     bool
+			)
+			if sf.Anonymous {
+				next = prefix
+			}
+			if ft.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					nested = reflect.New(ft.Elem())
+				} else {
+					nested = fv.Elem()
+				}
+			}
+			if ok, errs = b.fields(reflect.Indirect(nested), next, get, path, errs); ok && ft.Kind() == reflect.Ptr && fv.IsNil() {
+				fv.Set(nested)
+			}
+			bound = bound || ok
+			continue
+		}
+
+		var values, name, isForm = b.lookup(sf, prefix, get, path)
+		if isFileType(ft) {
+			if isForm {
+				if fhs := b.fileValue(ft, name); !fhs.IsZero() {
+					fv.Set(fhs)
+					bound = true
+				}
+			}
+			continue
+		}
+		if 0 == len(values) || "" == values[0] {
+			if def, ok := sf.Tag.Lookup("default"); !ok || !fv.IsZero() {
+				continue
+			} else {
+				values = []string{def}
+			}
+		}
+
+		var fb = b
+		if layout := sf.Tag.Get("time_format"); "" != layout {
+			fb.timeLayout = layout
+		}
+		cv, e := fb.convert(values, ft)
+		if e != nil {
+			if b.strict {
+				errs = append(errs, FieldError{Field: name, Rule: "type", Message: "must be " + describeType(ft, fb.timeLayout)})
+			}
+			continue
+		}
+		fv.Set(cv)
+		bound = true
+	}
+	return bound, errs
+}
+
+func sourceTag(sf reflect.StructField) string {
+	for _, tag := range sourceTags {
+		if name, _, _ := strings.Cut(sf.Tag.Get(tag), ","); "" != name && "-" != name {
+			return tag
+		}
+	}
+	return ""
+}
+
+// lookup returns the values of a struct field with the name they are sent
+// with, isForm tells the files of a multipart form may be bound to it.
+func (b binding) lookup(sf reflect.StructField, prefix string, get func(string) []string, path map[string]string) (values []string, name string, isForm bool) {
+	var tag = sourceTag(sf)
+	if "" == tag {
+		name = prefix + fieldName(sf)
+		if nil != get {
+			values = get(name)
+		}
+		return values, name, nil != get
+	}
+
+	name, _, _ = strings.Cut(sf.Tag.Get(tag), ",")
+	if nil == b.req {
+		if "form" == tag && nil != get {
+			values = get(name)
+		}
+		return values, name, false
+	}
+	switch tag {
+	case "path":
+		if v, ok := path[name]; ok {
+			values = []string{v}
+		}
+	case "query":
+		values = b.req.GetSlice(name)
+	case "header":
+		values = b.req.Request.Header.Values(name)
+	case "cookie":
+		if c, e := b.req.Request.Cookie(name); nil == e {
+			values = []string{c.Value}
+		}
+	case "form":
+		values = b.req.GetRequestSlice(name)
+	}
+	return values, name, "form" == tag
+}
+
+// strings sets a scalar param from path, query or form values, a missing
+// value leaves the param zero and a pointer param nil.
+func (b binding) strings(p *methodParam, values []string) ValidationErrors {
+	var t = p.argType()
+	if 0 == len(values) || (1 == len(values) && "" == values[0] && t.Kind() != reflect.String) {
+		p.Value = reflect.Zero(t).Interface()
+		return nil
+	}
+
+	v, e := b.convert(values, t)
+	if e != nil {
+		p.Value = reflect.Zero(t).Interface()
+		if b.strict {
+			return ValidationErrors{{Field: p.Name, Rule: "type", Message: "must be " + describeType(t, b.timeLayout)}}
+		}
+		return nil
+	}
+	p.Value = v.Interface()
+	return nil
+}
+
+// any sets a scalar param from a value of a json body decoded with UseNumber,
+// a string is converted like a query value.
+func (b binding) any(p *methodParam, value any) ValidationErrors {
+	var t = p.argType()
+	if nil == value {
+		p.Value = reflect.Zero(t).Interface()
+		return nil
+	}
+
+	var (
+		v reflect.Value
+		e error
+	)
+	if s, ok := value.(string); ok {
+		v, e = b.convert([]string{s}, t)
+	} else if raw, err := json.Marshal(value); err != nil {
+		e = err
+	} else {
+		v = reflect.New(t)
+		e = json.Unmarshal(raw, v.Interface())
+		v = v.Elem()
+	}
+
+	if e != nil {
+		p.Value = reflect.Zero(t).Interface()
+		if b.strict {
+			return ValidationErrors{{Field: p.Name, Rule: "type", Message: "must be " + describeType(t, b.timeLayout)}}
+		}
+		return nil
+	}
+	p.Value = v.Interface()
+	return nil
+}
+
+// convert converts request values to t, a slice takes all of them and the
+// other types the first one.
+func (b binding) convert(values []string, t reflect.Type) (reflect.Value, error) {
+	switch {
+	case t.Kind() == reflect.Ptr:
+		v, e := b.convert(values, t.Elem())
+		if e != nil {
+			return v, e
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(v)
+		return ptr, nil
+	case t.Kind() == reflect.Slice && !reflect.PointerTo(t).Implements(textUnmarshalerType):
+		var v = reflect.MakeSlice(t, len(values), len(values))
+		for i, s := range values {
+			ev, e := b.convertString(s, t.Elem())
+			if e != nil {
+				return v, e
+			}
+			v.Index(i).Set(ev)
+		}
+		return v, nil
+	}
+	return b.convertString(values[0], t)
+}
+
+func (b binding) convertString(s string, t reflect.Type) (reflect.Value, error) {
+	var v = reflect.New(t).Elem()
+	if t == timeType {
+		tm, e := time.Parse(b.timeLayout, s)
+		if e != nil {
+			return v, e
+		}
+		v.Set(reflect.ValueOf(tm))
+		return v, nil
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return v, v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		x, e := strconv.ParseBool(s)
+		if e != nil {
+			return v, e
+		}
+		v.SetBool(x)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, e := strconv.ParseInt(s, 10, t.Bits())
+		if e != nil {
+			return v, e
+		}
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x, e := strconv.ParseUint(s, 10, t.Bits())
+		if e != nil {
+			return v, e
+		}
+		v.SetUint(x)
+	case reflect.Float32, reflect.Float64:
+		x, e := strconv.ParseFloat(s, t.Bits())
+		if e != nil {
+			return v, e
+		}
+		v.SetFloat(x)
+	case reflect.Interface:
+		if !reflect.TypeOf(s).AssignableTo(t) {
+			return v, fmt.Errorf("can't bind string to %s", t)
+		}
+		v.Set(reflect.ValueOf(s))
+	default:
+		return v, errors.New("can't bind a request value to " + t.String())
+	}
+	return v, nil
+}
+
+// describeType names t for the clients in a binding error.
+func describeType(t reflect.Type, timeLayout string) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return "a time like " + timeLayout
+	case reflect.PointerTo(t).Implements(textUnmarshalerType):
+		return "a valid " + t.Name()
+	case t.Kind() == reflect.Slice:
+		return "a list of " + describeType(t.Elem(), timeLayout)
+	}
+	return t.Kind().String()
+}
+
+// argType is the type of the action argument.
+func (p *methodParam) argType() reflect.Type {
+	if p.ParamKind == reflect.Ptr {
+		return reflect.PointerTo(p.ParamType)
+	}
+	return p.ParamType
+}
@@ -0,0 +1,372 @@
+package wgo
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindController struct {
+	WgoController
+}
+
+func (this *bindController) Show(id int64) []byte {
+	return []byte(fmt.Sprint(id))
+}
+
+func (this *bindController) Find(page *int64, q *string) []byte {
+	var out []string
+	for _, p := range []any{page, q} {
+		switch v := p.(type) {
+		case *int64:
+			if nil == v {
+				out = append(out, "nil")
+			} else {
+				out = append(out, fmt.Sprint(*v))
+			}
+		case *string:
+			if nil == v {
+				out = append(out, "nil")
+			} else {
+				out = append(out, fmt.Sprintf("%q", *v))
+			}
+		}
+	}
+	return []byte(strings.Join(out, " "))
+}
+
+func (this *bindController) Sum(a int, b float64, ok bool) []byte {
+	return []byte(fmt.Sprint(a, b, ok))
+}
+
+// newBindTestApp registers the bind routes, the ones under /strict with
+// StrictBinding.
+func newBindTestApp(t *testing.T, global ...Middleware) string {
+	var (
+		c = &bindController{}
+		a = newTestApp(t, nil)
+	)
+	a.Use(global...)
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Get("/users/:id", c, "Show(id int64)")
+			m.Get("/find", c, "Find(page *int64, q *string)")
+			m.Post("/sum", c, "Sum(a int, b float64, ok bool)")
+			um.Get(RouteUnit{Path: "/strict/users/:id", Controller: c, Action: "Show(id int64)", Middlewares: []Middleware{StrictBinding()}})
+			um.Post(RouteUnit{Path: "/strict/sum", Controller: c, Action: "Sum(a int, b float64, ok bool)", Middlewares: []Middleware{StrictBinding()}})
+		})
+	})
+	return serveTestApp(t, a).URL
+}
+
+type bindCase struct {
+	name   string
+	method string
+	path   string
+	body   string
+	code   int
+	want   string
+}
+
+func runBindCases(t *testing.T, url string, cases []bindCase) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(c.method, url+c.path, strings.NewReader(c.body))
+			if "" != c.body {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			code, body := testGet(t, nil, req)
+			if c.code != code || (200 == code && c.want != body) || (200 != code && !strings.Contains(body, c.want)) {
+				t.Fatalf("got %d %s, want %d %s", code, body, c.code, c.want)
+			}
+		})
+	}
+}
+
+func TestStrictBinding(t *testing.T) {
+	runBindCases(t, newBindTestApp(t), []bindCase{
+		{"path", GET, "/users/42", "", 200, "42"},
+		{"path not a number", GET, "/users/abc", "", 200, "0"},
+		{"path overflow", GET, "/users/99999999999999999999", "", 200, "0"},
+		{"strict path", GET, "/strict/users/42", "", 200, "42"},
+		{"strict path not a number", GET, "/strict/users/abc", "", 400, `"field":"id"`},
+		{"strict path overflow", GET, "/strict/users/99999999999999999999", "", 400, `"field":"id"`},
+		{"json", POST, "/sum", `{"a":1,"b":2.5,"ok":true}`, 200, "1 2.5 true"},
+		{"json numbers as strings", POST, "/sum", `{"a":"1","b":"2.5","ok":"true"}`, 200, "1 2.5 true"},
+		{"json type mismatch", POST, "/sum", `{"a":"x","b":true,"ok":1}`, 200, "0 0 false"},
+		{"json fraction", POST, "/sum", `{"a":1.5}`, 200, "0 0 false"},
+		{"strict json", POST, "/strict/sum", `{"a":1,"b":2.5,"ok":true}`, 200, "1 2.5 true"},
+		{"strict json missing keys", POST, "/strict/sum", `{}`, 200, "0 0 false"},
+		{"strict json type mismatch", POST, "/strict/sum", `{"a":1,"b":2,"ok":1}`, 400, `"field":"ok"`},
+		{"strict json fraction", POST, "/strict/sum", `{"a":1.5}`, 400, `"field":"a"`},
+		{"strict json overflow", POST, "/strict/sum", `{"a":1e300}`, 400, `"field":"a"`},
+		{"strict broken json", POST, "/strict/sum", `{"a":`, 400, "invalid json body"},
+	})
+
+	t.Run("app", func(t *testing.T) {
+		runBindCases(t, newBindTestApp(t, StrictBinding()), []bindCase{
+			{"path", GET, "/users/42", "", 200, "42"},
+			{"path not a number", GET, "/users/abc", "", 400, `"field":"id"`},
+			{"json type mismatch", POST, "/sum", `{"b":"x"}`, 400, `"field":"b"`},
+		})
+	})
+}
+
+func TestPointerParams(t *testing.T) {
+	var url = newBindTestApp(t)
+	runBindCases(t, url, []bindCase{
+		{"absent", GET, "/find", "", 200, "nil nil"},
+		{"empty", GET, "/find?page=&q=", "", 200, "nil nil"},
+		{"zero", GET, "/find?page=0&q=0", "", 200, `0 "0"`},
+		{"set", GET, "/find?page=3&q=go", "", 200, `3 "go"`},
+	})
+}
+
+type userID int64
+
+// level is bound through UnmarshalText.
+type level struct {
+	n int
+}
+
+func (l *level) UnmarshalText(b []byte) error {
+	for k, s := range []string{"debug", "info", "warn"} {
+		if s == string(b) {
+			l.n = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown level %q", b)
+}
+
+type kindController struct {
+	WgoController
+}
+
+func (this *kindController) Ints(a int8, b int16, c int32, d uint, e uint8, f uint32) []byte {
+	return []byte(fmt.Sprint(a, b, c, d, e, f))
+}
+
+func (this *kindController) Floats(a float32, b float64) []byte {
+	return []byte(fmt.Sprint(a, b))
+}
+
+func (this *kindController) Named(id userID, ids []userID) []byte {
+	return []byte(fmt.Sprintf("%T %d %T %v", id, id, ids, ids))
+}
+
+func (this *kindController) Slices(ids []int64, names []string) []byte {
+	return []byte(fmt.Sprintf("%v %d %q", ids, len(names), names))
+}
+
+func (this *kindController) At(at time.Time, lv level, lvs []level) []byte {
+	return []byte(fmt.Sprint(at.UTC().Format(time.DateTime), " ", lv.n, " ", len(lvs)))
+}
+
+func TestBindKinds(t *testing.T) {
+	var (
+		c   = &kindController{}
+		url = func(layout string, global ...Middleware) string {
+			var a = newTestApp(t, nil)
+			a.Use(global...)
+			if "" != layout {
+				a.SetTimeLayout(layout)
+			}
+			a.SetRouteCollection(func(r *RouteRegister) {
+				r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+					m.Get("/ints", c, "Ints(a int8, b int16, c int32, d uint, e uint8, f uint32)")
+					m.Get("/floats", c, "Floats(a float32, b float64)")
+					m.Get("/named/:id", c, "Named(id userID, ids []userID)")
+					m.Get("/slices", c, "Slices(ids []int64, names []string)")
+					m.Post("/slices", c, "Slices(ids []int64, names []string)")
+					m.Get("/at", c, "At(at time.Time, lv level, lvs []level)")
+				})
+			})
+			return serveTestApp(t, a).URL
+		}
+		base = url("")
+	)
+
+	runBindCases(t, base, []bindCase{
+		{"ints", GET, "/ints?a=-128&b=32767&c=-5&d=7&e=255&f=4000000000", "", 200, "-128 32767 -5 7 255 4000000000"},
+		{"int8 overflow", GET, "/ints?a=128", "", 200, "0 0 0 0 0 0"},
+		{"uint negative", GET, "/ints?d=-1", "", 200, "0 0 0 0 0 0"},
+		{"floats", GET, "/floats?a=1.5&b=2.25", "", 200, "1.5 2.25"},
+		{"named", GET, "/named/7?ids=1&ids=2", "", 200, "wgo.userID 7 []wgo.userID [1 2]"},
+		{"repeated keys", GET, "/slices?ids=3&ids=1&ids=2&names=a&names=", "", 200, `[3 1 2] 2 ["a" ""]`},
+		{"no key", GET, "/slices", "", 200, "[] 0 []"},
+		{"json arrays", POST, "/slices", `{"ids":[1,2],"names":["x"]}`, 200, `[1 2] 1 ["x"]`},
+		{"time", GET, "/at?at=2026-01-02T03:04:05Z&lv=warn&lvs=info&lvs=debug", "", 200, "2026-01-02 03:04:05 2 2"},
+		{"bad time", GET, "/at?at=yesterday", "", 200, "0001-01-01 00:00:00 0 0"},
+	})
+
+	t.Run("layout", func(t *testing.T) {
+		runBindCases(t, url(time.DateOnly), []bindCase{
+			{"time", GET, "/at?at=2026-01-02", "", 200, "2026-01-02 00:00:00 0 0"},
+		})
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		runBindCases(t, url("", StrictBinding()), []bindCase{
+			{"int8 overflow", GET, "/ints?a=128", "", 400, `"field":"a"`},
+			{"uint negative", GET, "/ints?d=-1", "", 400, `"field":"d"`},
+			{"float", GET, "/floats?b=x", "", 400, `"field":"b"`},
+			{"one of a slice", GET, "/slices?ids=1&ids=x", "", 400, "a list of int64"},
+			{"time", GET, "/at?at=yesterday", "", 400, "a time like 2006-01-02T15:04:05Z07:00"},
+			{"text unmarshaler", GET, "/at?lv=trace", "", 400, "a valid level"},
+		})
+	})
+}
+
+func TestDeclaredKind(t *testing.T) {
+	for typ, want := range map[string]string{
+		"int":           "int",
+		"[]*int32":      "int32",
+		"byte":          "uint8",
+		"rune":          "int32",
+		"string":        "string",
+		"any":           "interface",
+		"interface{}":   "interface",
+		"userID":        "",
+		"time.Time":     "",
+		"[]models.User": "",
+	} {
+		if got := declaredKind(typ); want != got {
+			t.Errorf("declaredKind(%s) = %q, want %q", typ, got, want)
+		}
+	}
+}
+
+func TestConvertible(t *testing.T) {
+	for _, c := range []struct {
+		v    any
+		want bool
+	}{
+		{int8(0), true},
+		{userID(0), true},
+		{[]*level{}, true},
+		{time.Time{}, true},
+		{map[string][]int{}, true},
+		{struct{ A int }{}, true},
+		{[]any{}, true},
+		{make(chan int), false},
+		{func() {}, false},
+		{[]error{}, false},
+		{map[string]chan int{}, false},
+	} {
+		if got := convertible(reflect.TypeOf(c.v)); c.want != got {
+			t.Errorf("convertible(%T) = %v, want %v", c.v, got, c.want)
+		}
+	}
+}
+
+type Paging struct {
+	Page int `query:"page" default:"1"`
+	Size int `query:"size" default:"20"`
+}
+
+type itemFilter struct {
+	Status string   `json:"status"`
+	Tags   []string `json:"tags"`
+}
+
+type listReq struct {
+	ID     int64     `path:"id"`
+	Tenant string    `header:"X-Tenant"`
+	Sid    string    `cookie:"sid"`
+	Name   string    `form:"name"`
+	Day    time.Time `json:"day" time_format:"2006-01-02"`
+	Note   string    `json:"note"`
+	Paging
+	Filter itemFilter  `json:"filter"`
+	Opt    *itemFilter `json:"opt"`
+}
+
+type listController struct {
+	WgoController
+}
+
+func (this *listController) List(r listReq) []byte {
+	var opt = "nil"
+	if nil != r.Opt {
+		opt = r.Opt.Status
+	}
+	return []byte(fmt.Sprintf("%d %q %q %q %s %q %d %d %q %v %s", r.ID, r.Tenant, r.Sid, r.Name, r.Day.Format(time.DateOnly), r.Note, r.Page, r.Size, r.Filter.Status, r.Filter.Tags, opt))
+}
+
+func TestBindSources(t *testing.T) {
+	var (
+		c   = &listController{}
+		url = func(global ...Middleware) string {
+			var a = newTestApp(t, nil)
+			a.Use(global...)
+			a.SetRouteCollection(func(r *RouteRegister) {
+				r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+					m.Get("/teams/:id/items", c, "List(r listReq)")
+					m.Post("/teams/:id/items", c, "List(r listReq)")
+				})
+			})
+			return serveTestApp(t, a).URL
+		}
+		base = url()
+	)
+
+	for _, c := range []struct {
+		name   string
+		method string
+		path   string
+		ctype  string
+		body   string
+		want   string
+	}{
+		{"defaults", GET, "/teams/7/items", "", "", `7 "" "" "" 0001-01-01 "" 1 20 "" [] nil`},
+		{"query", GET, "/teams/7/items?page=3&note=n&day=2026-01-02&filter.status=open&filter.tags=a&filter.tags=b&opt.status=o", "", "",
+			`7 "acme" "s1" "" 2026-01-02 "n" 3 20 "open" [a b] o`},
+		{"form tag reads the query too", GET, "/teams/7/items?name=q", "", "", `7 "acme" "s1" "q" 0001-01-01 "" 1 20 "" [] nil`},
+		{"form", POST, "/teams/8/items?size=5", "application/x-www-form-urlencoded", "name=ann&note=f&filter.status=done",
+			`8 "acme" "s1" "ann" 0001-01-01 "f" 1 5 "done" [] nil`},
+		{"json", POST, "/teams/9/items?page=2", "application/json", `{"note":"j","filter":{"status":"s","tags":["x"]},"opt":{"status":"p"}}`,
+			`9 "acme" "s1" "" 0001-01-01 "j" 2 20 "s" [x] p`},
+		{"a zero field takes its default", POST, "/teams/9/items", "application/json", `{"Page":0}`,
+			`9 "acme" "s1" "" 0001-01-01 "" 1 20 "" [] nil`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(c.method, base+c.path, strings.NewReader(c.body))
+			if "" != c.ctype {
+				req.Header.Set("Content-Type", c.ctype)
+			}
+			if "defaults" != c.name {
+				req.Header.Set("X-Tenant", "acme")
+				req.AddCookie(&http.Cookie{Name: "sid", Value: "s1"})
+			}
+			if code, body := testGet(t, nil, req); 200 != code || c.want != body {
+				t.Fatalf("got %d %s, want %s", code, body, c.want)
+			}
+		})
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		runBindCases(t, url(StrictBinding()), []bindCase{
+			{"query tag", GET, "/teams/1/items?page=x", "", 400, `"field":"page"`},
+			{"path tag", GET, "/teams/x/items", "", 400, `"field":"id"`},
+			{"nested field", GET, "/teams/1/items?day=02/01/2026", "", 400, `"field":"day"`},
+		})
+	})
+}
+
+func TestPathParamOfField(t *testing.T) {
+	defer func() {
+		if nil == recover() {
+			t.Fatal("a path param without param or field was registered")
+		}
+	}()
+	newTestRouter(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Get("/teams/:team/items", &listController{}, "List(r listReq)")
+		})
+	})
+}
@@ -0,0 +1,215 @@
+package wgo
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Codec encodes the values an action renders and decodes the request bodies
+// of its media type into struct params.
+type Codec interface {
+	Encode(v any) ([]byte, error)
+	Decode(data []byte, v any) error
+}
+
+// codecRegistry holds the codecs of an app by media type, a nil one has only
+// the built in codecs.
+type codecRegistry struct {
+	sync.RWMutex
+	m     map[string]Codec
+	order []string
+}
+
+var builtinCodecs = newCodecRegistry()
+
+func newCodecRegistry() *codecRegistry {
+	return &codecRegistry{
+		m: map[string]Codec{
+			"application/json":                  jsonCodec{},
+			"application/xml":                   xmlCodec{},
+			"text/xml":                          xmlCodec{},
+			"application/x-www-form-urlencoded": formCodec{},
+		},
+		order: []string{"application/json", "application/xml", "text/xml", "application/x-www-form-urlencoded"},
+	}
+}
+
+// RegisterCodec sets the codec of a media type, like "application/msgpack",
+// replacing the built in one if any. it is meant to be called before Run.
+func (this *app) RegisterCodec(mediaType string, c Codec) *app {
+	mediaType = strings.ToLower(mediaType)
+	this.codecs.Lock()
+	defer this.codecs.Unlock()
+	if _, ok := this.codecs.m[mediaType]; !ok {
+		this.codecs.order = append(this.codecs.order, mediaType)
+	}
+	this.codecs.m[mediaType] = c
+	return this
+}
+
+// of returns the codec of a Content-Type, nil when none is registered.
+func (cr *codecRegistry) of(contentType string) Codec {
+	if nil == cr {
+		cr = builtinCodecs
+	}
+	mediaType, _, e := mime.ParseMediaType(contentType)
+	if e != nil {
+		return nil
+	}
+	cr.RLock()
+	defer cr.RUnlock()
+	return cr.m[mediaType]
+}
+
+// negotiate picks the codec of the media type the Accept header prefers,
+// json when it accepts anything or none of the registered types.
+func (cr *codecRegistry) negotiate(accept string) (string, Codec) {
+	if nil == cr {
+		cr = builtinCodecs
+	}
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+	var list []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, e := mime.ParseMediaType(strings.TrimSpace(part))
+		if e != nil {
+			continue
+		}
+		var q = 1.0
+		if s, ok := params["q"]; ok {
+			if q, e = strconv.ParseFloat(s, 64); e != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			list = append(list, accepted{mediaType, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].q > list[j].q })
+
+	cr.RLock()
+	defer cr.RUnlock()
+	for _, a := range list {
+		if "*/*" == a.mediaType {
+			break
+		}
+		if c, ok := cr.m[a.mediaType]; ok {
+			return a.mediaType, c
+		}
+		if strings.HasSuffix(a.mediaType, "/*") {
+			for _, mt := range cr.order {
+				if strings.HasPrefix(mt, a.mediaType[:len(a.mediaType)-1]) {
+					return mt, cr.m[mt]
+				}
+			}
+		}
+	}
+	return "application/json", cr.m["application/json"]
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Decode(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Encode(v any) ([]byte, error) {
+	b, e := xml.Marshal(v)
+	if e != nil {
+		return nil, e
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func (xmlCodec) Decode(data []byte, v any) error {
+	return xml.Unmarshal(data, v)
+}
+
+// formCodec encodes url.Values, maps and structs, the struct fields named by
+// their json tag. it decodes into *url.Values or a struct the way a form is
+// bound to a struct param.
+type formCodec struct{}
+
+func (formCodec) Encode(v any) ([]byte, error) {
+	var values = url.Values{}
+	switch t := v.(type) {
+	case url.Values:
+		values = t
+	case map[string]string:
+		for k, s := range t {
+			values.Set(k, s)
+		}
+	default:
+		rv := reflect.Indirect(reflect.ValueOf(v))
+		switch rv.Kind() {
+		case reflect.Map:
+			for _, k := range rv.MapKeys() {
+				addFormValue(values, fmt.Sprint(k.Interface()), rv.MapIndex(k))
+			}
+		case reflect.Struct:
+			for i := 0; i < rv.NumField(); i++ {
+				if sf := rv.Type().Field(i); sf.IsExported() && "-" != sf.Tag.Get("json") {
+					addFormValue(values, fieldName(sf), rv.Field(i))
+				}
+			}
+		default:
+			return nil, fmt.Errorf("can't encode %T as a form", v)
+		}
+	}
+	return []byte(values.Encode()), nil
+}
+
+func addFormValue(values url.Values, key string, v reflect.Value) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if (v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8) || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			addFormValue(values, key, v.Index(i))
+		}
+		return
+	}
+	values.Add(key, fmt.Sprint(v.Interface()))
+}
+
+func (formCodec) Decode(data []byte, v any) error {
+	values, e := url.ParseQuery(string(data))
+	if e != nil {
+		return e
+	}
+	if p, ok := v.(*url.Values); ok {
+		*p = values
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("form can only be decoded into *url.Values or a struct pointer")
+	}
+	var b = binding{strict: true, timeLayout: time.RFC3339}
+	if _, errs := b.fields(rv.Elem(), "", func(key string) []string { return values[key] }, nil, nil); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package wgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type codecUser struct {
+	Name string   `json:"name" xml:"name"`
+	Age  int      `json:"age" xml:"age"`
+	Tags []string `json:"tags" xml:"tag"`
+}
+
+type codecController struct {
+	WgoController
+}
+
+func (this *codecController) Echo(u codecUser) []byte {
+	return this.Render(u)
+}
+
+// kvCodec encodes "name age" and decodes json, for the codecs an app registers.
+type kvCodec struct{}
+
+func (kvCodec) Encode(v any) ([]byte, error) {
+	u := v.(codecUser)
+	return []byte(fmt.Sprintf("%s %d", u.Name, u.Age)), nil
+}
+
+func (kvCodec) Decode(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func newCodecTestApp(t *testing.T, codecs map[string]Codec) string {
+	var a = newTestApp(t, nil)
+	for mt, c := range codecs {
+		a.RegisterCodec(mt, c)
+	}
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Post("/echo", &codecController{}, "Echo(u codecUser)")
+		})
+	})
+	return serveTestApp(t, a).URL
+}
+
+func TestCodecs(t *testing.T) {
+	var (
+		base   = newCodecTestApp(t, nil)
+		custom = newCodecTestApp(t, map[string]Codec{"application/x-kv": kvCodec{}})
+	)
+
+	for _, c := range []struct {
+		name   string
+		url    string
+		ctype  string
+		body   string
+		accept string
+		code   int
+		rtype  string
+		want   string
+	}{
+		{"json", base, "application/json", `{"name":"ann","age":3,"tags":["a"]}`, "", 200, "application/json", `{"name":"ann","age":3,"tags":["a"]}`},
+		{"xml", base, "application/xml; charset=utf-8", `<codecUser><name>ann</name><age>3</age><tag>a</tag><tag>b</tag></codecUser>`, "application/xml", 200,
+			"application/xml", `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<codecUser><name>ann</name><age>3</age><tag>a</tag><tag>b</tag></codecUser>`},
+		{"text/xml", base, "text/xml", `<u><name>bo</name></u>`, "application/json", 200, "application/json", `{"name":"bo","age":0,"tags":null}`},
+		{"form", base, "application/x-www-form-urlencoded", "name=ann&age=3&tags=a&tags=b", "application/x-www-form-urlencoded", 200,
+			"application/x-www-form-urlencoded", "age=3&name=ann&tags=a&tags=b"},
+		{"accept by q", base, "application/json", `{"name":"ann"}`, "application/json;q=0.5, text/xml", 200, "text/xml", `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<codecUser><name>ann</name><age>0</age></codecUser>`},
+		{"accept wildcard subtype", base, "application/json", `{"name":"ann"}`, "application/*", 200, "application/json", `{"name":"ann","age":0,"tags":null}`},
+		{"accept anything", base, "application/json", `{"name":"ann"}`, "*/*", 200, "application/json", `{"name":"ann","age":0,"tags":null}`},
+		{"accept unknown", base, "application/json", `{"name":"ann"}`, "image/png", 200, "application/json", `{"name":"ann","age":0,"tags":null}`},
+		{"bad xml", base, "application/xml", `<codecUser><age>x</age></codecUser>`, "", 400, "", `"rule":"body"`},
+		{"registered codec", custom, "application/x-kv", `{"name":"cy","age":5}`, "application/x-kv", 200, "application/x-kv", "cy 5"},
+		{"not registered in another app", base, "application/json", `{"name":"cy","age":5}`, "application/x-kv", 200, "application/json", `{"name":"cy","age":5,"tags":null}`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(POST, c.url+"/echo", strings.NewReader(c.body))
+			req.Header.Set("Content-Type", c.ctype)
+			if "" != c.accept {
+				req.Header.Set("Accept", c.accept)
+			}
+			resp, e := http.DefaultClient.Do(req)
+			if e != nil {
+				t.Fatal(e)
+			}
+			defer resp.Body.Close()
+			b, _ := io.ReadAll(resp.Body)
+			if c.code != resp.StatusCode || (200 == c.code && c.want != string(b)) || (200 != c.code && !strings.Contains(string(b), c.want)) {
+				t.Fatalf("got %d %s, want %d %s", resp.StatusCode, b, c.code, c.want)
+			}
+			if 200 == c.code && c.rtype != resp.Header.Get("Content-Type") {
+				t.Fatalf("content type %q, want %q", resp.Header.Get("Content-Type"), c.rtype)
+			}
+		})
+	}
+}
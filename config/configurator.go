@@ -14,19 +14,28 @@ type Configurator struct {
 }
 
 func New(file string) *Configurator {
+	c, err := Load(file)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Load is New returning the error instead of panic.
+func Load(file string) (*Configurator, error) {
 	c := &Configurator{}
 	res, err := os.ReadFile(file)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	if len(res) == 0 {
-		panic("app.json is empty")
+		return nil, fmt.Errorf("%s is empty", file)
 	}
 	if err := json.Unmarshal(res, &c.data); err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return c
+	return c, nil
 }
 
 func (c *Configurator) Get(path string) (out any, err error) {
@@ -305,7 +314,7 @@ func (c *Configurator) fillStruct(outType reflect.Type, outValue reflect.Value,
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < INT8_MIN || f > INT8_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo int8 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo int8 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(int8(f)))
 			case reflect.String:
@@ -332,7 +341,7 @@ func (c *Configurator) fillStruct(outType reflect.Type, outValue reflect.Value,
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < INT16_MIN || f > INT16_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo int16 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo int16 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(int16(f)))
 			case reflect.String:
@@ -359,7 +368,7 @@ func (c *Configurator) fillStruct(outType reflect.Type, outValue reflect.Value,
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < INT32_MIN || f > INT32_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo int32 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo int32 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(int32(f)))
 			case reflect.String:
@@ -410,7 +419,7 @@ func (c *Configurator) fillStruct(outType reflect.Type, outValue reflect.Value,
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < 0 {
-					return fmt.Errorf("value %t of '%s' can't assignableTo uint '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo uint '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(uint(f)))
 			case reflect.String:
@@ -437,7 +446,7 @@ func (c *Configurator) fillStruct(outType reflect.Type, outValue reflect.Value,
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < 0 || f > UINT8_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo uint8 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo uint8 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(uint8(f)))
 			case reflect.String:
@@ -464,7 +473,7 @@ func (c *Configurator) fillStruct(outType reflect.Type, outValue reflect.Value,
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < 0 || f > UINT16_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo uint16 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo uint16 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(uint16(f)))
 			case reflect.String:
@@ -491,7 +500,7 @@ func (c *Configurator) fillStruct(outType reflect.Type, outValue reflect.Value,
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < 0 || f > UINT32_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo uint32 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo uint32 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(uint32(f)))
 			case reflect.String:
@@ -518,7 +527,7 @@ func (c *Configurator) fillStruct(outType reflect.Type, outValue reflect.Value,
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < 0 {
-					return fmt.Errorf("value %t of '%s' can't assignableTo uint64 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo uint64 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(uint64(f)))
 			case reflect.String:
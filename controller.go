@@ -1,6 +1,7 @@
 package wgo
 
 import (
+	"context"
 	"github.com/xiaocairen/wgo/config"
 	"github.com/xiaocairen/wgo/service"
 	"github.com/xiaocairen/wgo/tool"
@@ -19,6 +20,11 @@ type WgoController struct {
 	ShareData    []map[string]any
 }
 
+// Context returns the request context, the queries of this.Service run with it.
+func (this *WgoController) Context() context.Context {
+	return this.Request.Context()
+}
+
 func (this *WgoController) GetCookie(name string) string {
 	c, e := this.Request.GetCookie(name)
 	if e != nil {
@@ -39,6 +45,28 @@ func (this *WgoController) DelCookie(name string) {
 	this.Response.DelCookie(name, "/")
 }
 
+// GetSignedCookie returns the value of a cookie set by SetSignedCookie, empty
+// when it is missing or was changed.
+func (this *WgoController) GetSignedCookie(name string) string {
+	v, _ := this.Request.GetSignedCookie(name)
+	return v
+}
+
+func (this *WgoController) SetSignedCookie(name, value string, maxAge int) error {
+	return this.Response.SetSignedCookie(&http.Cookie{Name: name, Value: value, MaxAge: maxAge, HttpOnly: true})
+}
+
+// GetEncryptedCookie returns the value of a cookie set by SetEncryptedCookie,
+// empty when it is missing or can't be decrypted.
+func (this *WgoController) GetEncryptedCookie(name string) string {
+	v, _ := this.Request.GetEncryptedCookie(name)
+	return v
+}
+
+func (this *WgoController) SetEncryptedCookie(name, value string, maxAge int) error {
+	return this.Response.SetEncryptedCookie(&http.Cookie{Name: name, Value: value, MaxAge: maxAge, HttpOnly: true})
+}
+
 func (this *WgoController) AppendBody(body []byte) *WgoController {
 	this.Response.Append(body)
 	return this
@@ -48,8 +76,20 @@ func (this *WgoController) AddShare(data map[string]any) {
 	this.ShareData = append(this.ShareData, data)
 }
 
-func (this *WgoController) Render(body []byte) []byte {
-	return this.Response.Send(body)
+// Render sends body as it is when it is []byte, another value is encoded by
+// the Codec of the media type the Accept header prefers, json by default.
+func (this *WgoController) Render(body any) []byte {
+	if b, ok := body.([]byte); ok || nil == body {
+		return this.Response.Send(b)
+	}
+
+	mediaType, c := this.Request.codecs.negotiate(this.Request.GetHeader("Accept"))
+	b, e := c.Encode(body)
+	if e != nil {
+		log.Panic(e)
+	}
+	this.Response.SetHeader("Content-Type", mediaType)
+	return b
 }
 
 func (this *WgoController) RenderJson(body any) []byte {
@@ -58,7 +98,7 @@ func (this *WgoController) RenderJson(body any) []byte {
 }
 
 func (this *WgoController) RenderHtml(filename string, data any) (string, any) {
-	return filename, mergeShareDatas(data, this.ShareData)
+	return filename, mergeShareDatas(data, this.shareDatas())
 }
 
 func (this *WgoController) RenderHtmlStr(htmlStr string, data any) (*template.Template, any) {
@@ -69,10 +109,18 @@ func (this *WgoController) RenderHtmlStr(htmlStr string, data any) (*template.Te
 		if err != nil {
 			log.Panic(err)
 		}
-		return tpl, mergeShareDatas(data, this.ShareData)
+		return tpl, mergeShareDatas(data, this.shareDatas())
 	} else {
-		return t, mergeShareDatas(data, this.ShareData)
+		return t, mergeShareDatas(data, this.shareDatas())
+	}
+}
+
+// shareDatas adds the csrf token of the request to the share data.
+func (this *WgoController) shareDatas() []map[string]any {
+	if m := this.Request.csrfShare(); nil != m {
+		return append(this.ShareData[:len(this.ShareData):len(this.ShareData)], m)
 	}
+	return this.ShareData
 }
 
 func (this *WgoController) Success(body any) (json []byte) {
@@ -119,36 +167,28 @@ func (this *WgoController) Redirect(url string, code int) []byte {
 }
 
 func mergeShareDatas(dst any, datas []map[string]any) any {
-	n := len(datas)
-	if n == 0 {
+	if 0 == len(datas) {
 		return dst
 	}
 
-	if nil == dst {
-		if n == 1 {
-			return datas[0]
+	var si map[string]any
+	if nil != dst {
+		var ok bool
+		if si, ok = dst.(map[string]any); !ok {
+			return dst
 		}
-
-		for _, m := range datas[1:] {
-			for k, i := range m {
-				datas[0][k] = i
-			}
-		}
-		return datas[0]
 	}
 
-	si, ok := dst.(map[string]any)
-	if !ok {
-		return dst
-	}
-
-	for _, m := range datas {
-		for k, i := range m {
-			_, f := si[k]
-			if !f {
-				si[k] = i
-			}
+	// the maps are merged into a new one, they belong to the controller and
+	// the caller.
+	m := make(map[string]any, len(si))
+	for _, d := range datas {
+		for k, i := range d {
+			m[k] = i
 		}
 	}
-	return si
+	for k, i := range si {
+		m[k] = i
+	}
+	return m
 }
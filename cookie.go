@@ -0,0 +1,259 @@
+package wgo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrCookieKeys      = errors.New("cookie keys are not set")
+	ErrCookieSignature = errors.New("cookie signature is invalid")
+	ErrCookieDecrypt   = errors.New("cookie can't be decrypted")
+)
+
+// cookieConfig is the "cookie" section of app.json
+//
+//	"cookie": {
+//	  "domain": "",
+//	  "secure": false,
+//	  "same_site": "lax",
+//	  "keys": ["newest secret", "older secret"]
+//	}
+//
+// domain, secure and same_site are the defaults of the cookies set by the
+// app, same_site is lax, strict or none, which makes the cookies secure.
+// the signed and encrypted cookies are made with the first key and read with
+// any of them, so a key can be replaced without losing the cookies made with
+// the previous one.
+type cookieConfig struct {
+	Domain   string   `json:"domain"`
+	Secure   bool     `json:"secure"`
+	SameSite string   `json:"same_site"`
+	Keys     []string `json:"keys"`
+}
+
+// cookies applies the defaults of the cookie section and holds its keys.
+type cookies struct {
+	domain   string
+	secure   bool
+	sameSite http.SameSite
+	signKeys [][]byte
+	encKeys  [][]byte
+}
+
+func (this *app) newCookies() *cookies {
+	var c cookieConfig
+	if _, err := this.configurator.Get("cookie"); nil == err {
+		if err = this.configurator.GetStruct("cookie", &c); err != nil {
+			panic(err)
+		}
+	}
+
+	var cs = &cookies{domain: c.Domain, secure: c.Secure}
+	switch strings.ToLower(c.SameSite) {
+	case "":
+	case "lax":
+		cs.sameSite = http.SameSiteLaxMode
+	case "strict":
+		cs.sameSite = http.SameSiteStrictMode
+	case "none":
+		cs.sameSite = http.SameSiteNoneMode
+	default:
+		log.Panicf("unknown cookie same_site '%s'", c.SameSite)
+	}
+	for _, k := range c.Keys {
+		if "" == k {
+			log.Panicf("empty cookie key")
+		}
+		cs.signKeys = append(cs.signKeys, deriveKey(k, "wgo cookie sign"))
+		cs.encKeys = append(cs.encKeys, deriveKey(k, "wgo cookie encrypt"))
+	}
+	return cs
+}
+
+// complete sets the attributes c leaves empty to the defaults.
+func (cs *cookies) complete(c *http.Cookie) {
+	if "" == c.Path {
+		c.Path = "/"
+	}
+	if nil == cs {
+		return
+	}
+	if "" == c.Domain {
+		c.Domain = cs.domain
+	}
+	if 0 == c.SameSite || http.SameSiteDefaultMode == c.SameSite {
+		c.SameSite = cs.sameSite
+	}
+	c.Secure = c.Secure || cs.secure || http.SameSiteNoneMode == c.SameSite
+}
+
+func (cs *cookies) sign(key []byte, name, payload string) string {
+	var m = hmac.New(sha256.New, key)
+	m.Write([]byte(name + "|" + payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func (cs *cookies) signed(name, value string) (string, error) {
+	if nil == cs || 0 == len(cs.signKeys) {
+		return "", ErrCookieKeys
+	}
+	var payload = base64.RawURLEncoding.EncodeToString([]byte(value))
+	return payload + "." + cs.sign(cs.signKeys[0], name, payload), nil
+}
+
+func (cs *cookies) verify(name, value string) (string, error) {
+	if nil == cs || 0 == len(cs.signKeys) {
+		return "", ErrCookieKeys
+	}
+	payload, sig, ok := strings.Cut(value, ".")
+	if ok {
+		for _, key := range cs.signKeys {
+			if hmac.Equal([]byte(sig), []byte(cs.sign(key, name, payload))) {
+				b, e := base64.RawURLEncoding.DecodeString(payload)
+				if e != nil {
+					break
+				}
+				return string(b), nil
+			}
+		}
+	}
+	return "", ErrCookieSignature
+}
+
+// encrypted seals value with AES-GCM, the cookie name is authenticated with
+// it.
+func (cs *cookies) encrypted(name, value string) (string, error) {
+	if nil == cs || 0 == len(cs.encKeys) {
+		return "", ErrCookieKeys
+	}
+	aead, e := newGCM(cs.encKeys[0])
+	if e != nil {
+		return "", e
+	}
+	var nonce = make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, e = rand.Read(nonce); e != nil {
+		return "", e
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(value), []byte(name))), nil
+}
+
+func (cs *cookies) decrypt(name, value string) (string, error) {
+	if nil == cs || 0 == len(cs.encKeys) {
+		return "", ErrCookieKeys
+	}
+	b, e := base64.RawURLEncoding.DecodeString(value)
+	if e != nil {
+		return "", ErrCookieDecrypt
+	}
+	for _, key := range cs.encKeys {
+		aead, e := newGCM(key)
+		if e != nil {
+			return "", e
+		}
+		if len(b) < aead.NonceSize() {
+			break
+		}
+		if plain, e := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], []byte(name)); nil == e {
+			return string(plain), nil
+		}
+	}
+	return "", ErrCookieDecrypt
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, e := aes.NewCipher(key)
+	if e != nil {
+		return nil, e
+	}
+	return cipher.NewGCM(block)
+}
+
+// WriteCookie sets a cookie, the attributes it leaves empty take the defaults
+// of the cookie section and the path is "/" by default. it replaces a cookie
+// of the same name and path set before in the response, and keeps the others.
+func (r *HttpResponse) WriteCookie(c *http.Cookie) {
+	r.cookies.complete(c)
+	var v = c.String()
+	if "" == v {
+		logf(r.logger, "invalid cookie '%s' dropped", c.Name)
+		return
+	}
+
+	var (
+		h    = r.Writer.Header()
+		kept []string
+	)
+	for _, sc := range h.Values("Set-Cookie") {
+		if name, path := setCookieKey(sc); name != c.Name || path != c.Path {
+			kept = append(kept, sc)
+		}
+	}
+	h["Set-Cookie"] = append(kept, v)
+}
+
+// setCookieKey returns the name and path of a Set-Cookie header value.
+func setCookieKey(sc string) (name, path string) {
+	var parts = strings.Split(sc, ";")
+	name, _, _ = strings.Cut(parts[0], "=")
+	for _, attr := range parts[1:] {
+		if k, v, _ := strings.Cut(strings.TrimSpace(attr), "="); strings.EqualFold(k, "path") {
+			path = v
+		}
+	}
+	return strings.TrimSpace(name), path
+}
+
+// SetSignedCookie sets a cookie whose value can be read but not changed by
+// the client, it is signed with HMAC-SHA256 by the first cookie key.
+func (r *HttpResponse) SetSignedCookie(c *http.Cookie) error {
+	v, e := r.cookies.signed(c.Name, c.Value)
+	if e != nil {
+		return e
+	}
+	var sc = *c
+	sc.Value = v
+	r.WriteCookie(&sc)
+	return nil
+}
+
+// SetEncryptedCookie sets a cookie whose value the client can neither read
+// nor change, it is sealed with AES-GCM by the first cookie key.
+func (r *HttpResponse) SetEncryptedCookie(c *http.Cookie) error {
+	v, e := r.cookies.encrypted(c.Name, c.Value)
+	if e != nil {
+		return e
+	}
+	var sc = *c
+	sc.Value = v
+	r.WriteCookie(&sc)
+	return nil
+}
+
+// GetSignedCookie returns the value of a cookie set by SetSignedCookie, it
+// fails with http.ErrNoCookie or ErrCookieSignature.
+func (r *HttpRequest) GetSignedCookie(name string) (string, error) {
+	c, e := r.Request.Cookie(name)
+	if e != nil {
+		return "", e
+	}
+	return r.cookies.verify(name, c.Value)
+}
+
+// GetEncryptedCookie returns the value of a cookie set by SetEncryptedCookie,
+// it fails with http.ErrNoCookie or ErrCookieDecrypt.
+func (r *HttpRequest) GetEncryptedCookie(name string) (string, error) {
+	c, e := r.Request.Cookie(name)
+	if e != nil {
+		return "", e
+	}
+	return r.cookies.decrypt(name, c.Value)
+}
@@ -0,0 +1,177 @@
+package wgo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestCookies(t *testing.T, conf map[string]any) *cookies {
+	return newTestApp(t, map[string]any{"cookie": conf}).newCookies()
+}
+
+// tamper changes the first char of a value.
+func tamper(v string) string {
+	if 'A' == v[0] {
+		return "B" + v[1:]
+	}
+	return "A" + v[1:]
+}
+
+func TestCookieSeal(t *testing.T) {
+	var (
+		cur     = newTestCookies(t, map[string]any{"keys": []string{"k1"}})
+		rotated = newTestCookies(t, map[string]any{"keys": []string{"k2", "k1"}})
+		dropped = newTestCookies(t, map[string]any{"keys": []string{"k2"}})
+		none    = newTestCookies(t, map[string]any{})
+	)
+	type seal struct {
+		name   string
+		seal   func(*cookies, string, string) (string, error)
+		open   func(*cookies, string, string) (string, error)
+		broken error
+	}
+	for _, s := range []seal{
+		{"signed", (*cookies).signed, (*cookies).verify, ErrCookieSignature},
+		{"encrypted", (*cookies).encrypted, (*cookies).decrypt, ErrCookieDecrypt},
+	} {
+		v, e := s.seal(cur, "uid", "42|ann")
+		if e != nil {
+			t.Fatal(e)
+		}
+		if "encrypted" == s.name && strings.Contains(v, "42") {
+			t.Fatalf("encrypted value %q shows the plain one", v)
+		}
+
+		for _, c := range []struct {
+			name  string
+			cs    *cookies
+			cname string
+			value string
+			want  string
+			err   error
+		}{
+			{"same keys", cur, "uid", v, "42|ann", nil},
+			{"an older key", rotated, "uid", v, "42|ann", nil},
+			{"a dropped key", dropped, "uid", v, "", s.broken},
+			{"another cookie name", cur, "gid", v, "", s.broken},
+			{"changed value", cur, "uid", tamper(v), "", s.broken},
+			{"garbage", cur, "uid", "!!", "", s.broken},
+			{"no keys", none, "uid", v, "", ErrCookieKeys},
+			{"nil cookies", nil, "uid", v, "", ErrCookieKeys},
+		} {
+			t.Run(s.name+"/"+c.name, func(t *testing.T) {
+				got, e := s.open(c.cs, c.cname, c.value)
+				if c.err != e || c.want != got {
+					t.Fatalf("got %q %v, want %q %v", got, e, c.want, c.err)
+				}
+			})
+		}
+
+		if _, e = s.seal(none, "uid", "x"); ErrCookieKeys != e {
+			t.Fatalf("%s without keys = %v", s.name, e)
+		}
+	}
+}
+
+func TestCookieDefaults(t *testing.T) {
+	var cs = newTestCookies(t, map[string]any{"domain": "example.com", "same_site": "lax"})
+	for _, c := range []struct {
+		name string
+		in   *http.Cookie
+		want string
+	}{
+		{"defaults", &http.Cookie{Name: "a", Value: "1"}, "a=1; Path=/; Domain=example.com; SameSite=Lax"},
+		{"set attributes are kept", &http.Cookie{Name: "a", Value: "1", Path: "/x", Domain: "other.com", SameSite: http.SameSiteStrictMode}, "a=1; Path=/x; Domain=other.com; SameSite=Strict"},
+		{"same_site none is secure", &http.Cookie{Name: "a", Value: "1", SameSite: http.SameSiteNoneMode}, "a=1; Path=/; Domain=example.com; Secure; SameSite=None"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cs.complete(c.in)
+			if got := c.in.String(); c.want != got {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+
+	var secure = newTestCookies(t, map[string]any{"secure": true})
+	c := &http.Cookie{Name: "a", Value: "1"}
+	secure.complete(c)
+	if !c.Secure || "/" != c.Path {
+		t.Fatalf("got %s", c)
+	}
+}
+
+func TestWriteCookie(t *testing.T) {
+	var (
+		w   = httptest.NewRecorder()
+		res = &HttpResponse{Writer: w, cookies: newTestCookies(t, map[string]any{"domain": "example.com"})}
+	)
+	res.AddCookie("a", "1", "/", 0, false, false)
+	res.AddCookie("b", "1", "/x", 0, false, false)
+	res.SetCookie("b", "2", "/y", 0, false, false)
+	res.WriteCookie(&http.Cookie{Name: "a", Value: "2"})
+	res.WriteCookie(&http.Cookie{Name: "bad name", Value: "1"})
+	res.DelCookie("b", "/x")
+
+	var want = []string{
+		"b=2; Path=/y; Domain=example.com",
+		"a=2; Path=/; Domain=example.com",
+		"b=; Path=/x; Domain=example.com; Max-Age=0",
+	}
+	if got := w.Header().Values("Set-Cookie"); strings.Join(want, "\n") != strings.Join(got, "\n") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+type cookieController struct {
+	WgoController
+}
+
+func (this *cookieController) Set() []byte {
+	if e := this.SetSignedCookie("s", "signed value", 0); e != nil {
+		return []byte(e.Error())
+	}
+	if e := this.SetEncryptedCookie("e", "secret value", 0); e != nil {
+		return []byte(e.Error())
+	}
+	return []byte("ok")
+}
+
+func (this *cookieController) Get() []byte {
+	return []byte(this.GetSignedCookie("s") + "," + this.GetEncryptedCookie("e"))
+}
+
+func TestSignedCookies(t *testing.T) {
+	var a = newTestApp(t, map[string]any{"cookie": map[string]any{"keys": []string{"k1"}}})
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Get("/set", &cookieController{}, "Set()")
+			m.Get("/get", &cookieController{}, "Get()")
+		})
+	})
+	var (
+		ts     = serveTestApp(t, a)
+		client = newJarClient(t)
+	)
+
+	req, _ := http.NewRequest(GET, ts.URL+"/get", nil)
+	if _, body := testGet(t, client, req); "," != body {
+		t.Fatalf("without cookies got %q", body)
+	}
+	req, _ = http.NewRequest(GET, ts.URL+"/set", nil)
+	if _, body := testGet(t, client, req); "ok" != body {
+		t.Fatalf("set got %q", body)
+	}
+	req, _ = http.NewRequest(GET, ts.URL+"/get", nil)
+	if _, body := testGet(t, client, req); "signed value,secret value" != body {
+		t.Fatalf("got %q", body)
+	}
+
+	req, _ = http.NewRequest(GET, ts.URL+"/get", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: "c2lnbmVk.x"})
+	req.AddCookie(&http.Cookie{Name: "e", Value: "x"})
+	if _, body := testGet(t, nil, req); "," != body {
+		t.Fatalf("forged cookies got %q", body)
+	}
+}
@@ -0,0 +1,232 @@
+package wgo
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// CSRFOptions of the CSRF middleware. the secret token is kept in the
+// session when Session is true, else in a signed cookie, CookieName
+// "wgo_csrf" by default, which needs the keys of the cookie section. the
+// token is sent back in the form field FieldName, "csrf_token" by default,
+// or the header HeaderName, "X-CSRF-Token" by default. ErrorHandler replaces
+// the default 403 response.
+type CSRFOptions struct {
+	Session      bool
+	CookieName   string
+	FieldName    string
+	HeaderName   string
+	ErrorHandler func(w *HttpResponse, r *HttpRequest)
+}
+
+// CSRF protects the POST, PUT, PATCH and DELETE requests of the routes it
+// wraps from cross site forgery: their token must match the secret of the
+// client. the check runs once the route is found, before its middlewares, so
+// CSRFExempt on a namespace or a route turns it off there. the innermost CSRF
+// of a route gives its options.
+//
+// the templates get the token with {{csrf_field .}}, which writes the hidden
+// form field, or {{csrf_token .}}, the data being a map or nil. with other
+// data pass this.CSRFToken() to them instead of the dot.
+func CSRF(opts CSRFOptions) Middleware {
+	if "" == opts.CookieName {
+		opts.CookieName = "wgo_csrf"
+	}
+	if "" == opts.FieldName {
+		opts.FieldName = "csrf_token"
+	}
+	if "" == opts.HeaderName {
+		opts.HeaderName = "X-CSRF-Token"
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		declareRoute(func(route *Router) {
+			if nil == route.csrf {
+				route.csrf = &opts
+			}
+		})
+		return func(w *HttpResponse, r *HttpRequest) {
+			if nil == r.csrf {
+				r.csrf = newCSRFState(&opts, w, r)
+			}
+			next(w, r)
+		}
+	}
+}
+
+// CSRFExempt turns off the check of CSRF for the routes it wraps, like the
+// ones of an api authenticated by header.
+func CSRFExempt() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		declareRoute(func(route *Router) {
+			route.csrfExempt = true
+		})
+		return func(w *HttpResponse, r *HttpRequest) {
+			r.csrfExempt = true
+			next(w, r)
+		}
+	}
+}
+
+type csrfState struct {
+	opts   *CSRFOptions
+	w      *HttpResponse
+	r      *HttpRequest
+	check  bool
+	secret []byte
+}
+
+func newCSRFState(opts *CSRFOptions, w *HttpResponse, r *HttpRequest) *csrfState {
+	var c = &csrfState{opts: opts, w: w, r: r}
+	switch r.Request.Method {
+	case GET, HEAD, OPTIONS:
+	default:
+		c.check = true
+	}
+	return c
+}
+
+// CSRFToken returns the token of the request to send back with a form or in
+// the header, empty when the route is not wrapped by CSRF.
+func (this *WgoController) CSRFToken() string {
+	if nil == this.Request.csrf {
+		return ""
+	}
+	return this.Request.csrf.token()
+}
+
+// load returns the secret of the client, a new one is made and stored when
+// create is true.
+func (c *csrfState) load(create bool) []byte {
+	if nil != c.secret {
+		return c.secret
+	}
+
+	var stored string
+	if c.opts.Session {
+		GetSession(c.w, c.r).Get("_csrf", &stored)
+	} else {
+		stored, _ = c.r.GetSignedCookie(c.opts.CookieName)
+	}
+	if b, e := base64.RawURLEncoding.DecodeString(stored); nil == e && 32 == len(b) {
+		c.secret = b
+		return b
+	}
+	if !create {
+		return nil
+	}
+
+	var b = make([]byte, 32)
+	if _, e := rand.Read(b); e != nil {
+		log.Panic(e)
+	}
+	stored = base64.RawURLEncoding.EncodeToString(b)
+	if c.opts.Session {
+		GetSession(c.w, c.r).Set("_csrf", stored)
+	} else if e := c.w.SetSignedCookie(&http.Cookie{Name: c.opts.CookieName, Value: stored, HttpOnly: true, SameSite: http.SameSiteLaxMode}); e != nil {
+		log.Panicf("CSRF needs the keys of the cookie section, or CSRFOptions.Session: %s", e)
+	}
+	c.secret = b
+	return b
+}
+
+// token masks the secret with a random pad, so the token changes with every
+// response and can't be guessed from compressed pages.
+func (c *csrfState) token() string {
+	var (
+		secret = c.load(true)
+		token  = make([]byte, 2*len(secret))
+	)
+	if _, e := rand.Read(token[:len(secret)]); e != nil {
+		log.Panic(e)
+	}
+	for i, b := range secret {
+		token[len(secret)+i] = b ^ token[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// verify reports whether the request carries a token of the secret.
+func (c *csrfState) verify() bool {
+	var secret = c.load(false)
+	if nil == secret {
+		return false
+	}
+
+	var sent = c.r.GetHeader(c.opts.HeaderName)
+	if "" == sent {
+		sent = c.r.GetPost(c.opts.FieldName)
+	}
+	token, e := base64.RawURLEncoding.DecodeString(sent)
+	if e != nil || 2*len(secret) != len(token) {
+		return false
+	}
+	for i := range secret {
+		token[len(secret)+i] ^= token[i]
+	}
+	return 1 == subtle.ConstantTimeCompare(token[len(secret):], secret)
+}
+
+// checkCSRF answers 403 and returns false when the request fails the check
+// of the CSRF middleware, a request is checked once.
+func checkCSRF(w *HttpResponse, r *HttpRequest) bool {
+	if nil == r.csrf || !r.csrf.check || r.csrfExempt || r.csrf.verify() {
+		if nil != r.csrf {
+			r.csrf.check = false
+		}
+		return true
+	}
+	if nil == r.csrf.opts.ErrorHandler {
+		writeError(w, r, http.StatusForbidden, "invalid csrf token")
+	} else {
+		r.csrf.opts.ErrorHandler(w, r)
+	}
+	return false
+}
+
+// csrfToken is the value of csrf_token in the data of a template, it prints
+// as the token.
+type csrfToken struct {
+	field string
+	token string
+}
+
+func (t csrfToken) String() string {
+	return t.token
+}
+
+// csrfShare returns the share data that gives the templates the token.
+func (r *HttpRequest) csrfShare() map[string]any {
+	if nil == r.csrf {
+		return nil
+	}
+	return map[string]any{"csrf_token": csrfToken{field: r.csrf.opts.FieldName, token: r.csrf.token()}}
+}
+
+func csrfOf(data any) csrfToken {
+	switch v := data.(type) {
+	case csrfToken:
+		return v
+	case string:
+		return csrfToken{field: "csrf_token", token: v}
+	case map[string]any:
+		t, _ := v["csrf_token"].(csrfToken)
+		return t
+	}
+	return csrfToken{}
+}
+
+func (this *app) tplCsrfToken(data any) string {
+	return csrfOf(data).token
+}
+
+func (this *app) tplCsrfField(data any) template.HTML {
+	var t = csrfOf(data)
+	if "" == t.token {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(t.field) + `" value="` + template.HTMLEscapeString(t.token) + `">`)
+}
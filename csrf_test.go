@@ -0,0 +1,170 @@
+package wgo
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type csrfController struct {
+	WgoController
+}
+
+func (this *csrfController) Form() (*template.Template, any) {
+	return this.RenderHtmlStr(`<form>{{csrf_field .}}</form>`, nil)
+}
+
+func (this *csrfController) Token() []byte {
+	return []byte(this.CSRFToken())
+}
+
+func (this *csrfController) Save() []byte {
+	return []byte("saved")
+}
+
+var csrfInput = regexp.MustCompile(`<input type="hidden" name="([^"]+)" value="([^"]+)">`)
+
+func newCSRFTestServer(t *testing.T, session bool, ran *int) string {
+	var (
+		a    = newTestApp(t, map[string]any{"cookie": map[string]any{"keys": []string{"a key of the tests"}}})
+		opts = CSRFOptions{Session: session}
+		mark = func(next HandlerFunc) HandlerFunc {
+			return func(w *HttpResponse, r *HttpRequest) {
+				*ran++
+				next(w, r)
+			}
+		}
+	)
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Get("/form", &csrfController{}, "Form()")
+			m.Get("/token", &csrfController{}, "Token()")
+			m.Head("/token", &csrfController{}, "Token()")
+			m.Options("/token", &csrfController{}, "Token()")
+			um.Post(RouteUnit{Path: "/save", Controller: &csrfController{}, Action: "Save()", Middlewares: []Middleware{mark}})
+			um.Put(RouteUnit{Path: "/save", Controller: &csrfController{}, Action: "Save()", Middlewares: []Middleware{mark}})
+			um.Post(RouteUnit{Path: "/hook", Controller: &csrfController{}, Action: "Save()", Middlewares: []Middleware{CSRFExempt()}})
+		}, CSRF(opts))
+		r.Registe("", "/api", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Post("/save", &csrfController{}, "Save()")
+		}, CSRF(opts), CSRFExempt())
+	})
+	return serveTestApp(t, a).URL
+}
+
+func TestCSRF(t *testing.T) {
+	for _, mode := range []struct {
+		name    string
+		session bool
+	}{{"signed cookie", false}, {"session", true}} {
+		t.Run(mode.name, func(t *testing.T) {
+			var (
+				ran    int
+				base   = newCSRFTestServer(t, mode.session, &ran)
+				client = newJarClient(t)
+				send   = func(client *http.Client, method, path, header, form string) int {
+					t.Helper()
+					var req *http.Request
+					if "" == form {
+						req, _ = http.NewRequest(method, base+path, nil)
+					} else {
+						req, _ = http.NewRequest(method, base+path, strings.NewReader(form))
+						req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+					}
+					if "" != header {
+						req.Header.Set("X-CSRF-Token", header)
+					}
+					code, _ := testGet(t, client, req)
+					return code
+				}
+			)
+
+			req, _ := http.NewRequest(GET, base+"/form", nil)
+			code, body := testGet(t, client, req)
+			var m = csrfInput.FindStringSubmatch(body)
+			if http.StatusOK != code || nil == m || "csrf_token" != m[1] {
+				t.Fatalf("form = %d %q", code, body)
+			}
+			var token = m[2]
+
+			req, _ = http.NewRequest(GET, base+"/token", nil)
+			_, other := testGet(t, client, req)
+			if "" == other || other == token {
+				t.Fatalf("tokens are not masked: %q %q", token, other)
+			}
+
+			var cases = []struct {
+				name   string
+				client *http.Client
+				method string
+				path   string
+				header string
+				form   string
+				code   int
+			}{
+				{"header", client, POST, "/save", token, "", http.StatusOK},
+				{"another token of the secret", client, POST, "/save", other, "", http.StatusOK},
+				{"form field", client, POST, "/save", "", "csrf_token=" + url.QueryEscape(token), http.StatusOK},
+				{"put", client, PUT, "/save", token, "", http.StatusOK},
+				{"no token", client, POST, "/save", "", "", http.StatusForbidden},
+				{"wrong token", client, POST, "/save", tamper(token), "", http.StatusForbidden},
+				{"not a token", client, POST, "/save", "abc", "", http.StatusForbidden},
+				{"wrong form field", client, POST, "/save", "", "token=" + url.QueryEscape(token), http.StatusForbidden},
+				{"no secret", newJarClient(t), POST, "/save", token, "", http.StatusForbidden},
+				{"get", client, GET, "/token", "", "", http.StatusOK},
+				{"head", client, HEAD, "/token", "", "", http.StatusOK},
+				{"options", client, OPTIONS, "/token", "", "", http.StatusOK},
+				{"exempt route", newJarClient(t), POST, "/hook", "", "", http.StatusOK},
+				{"exempt namespace", newJarClient(t), POST, "/api/save", "", "", http.StatusOK},
+			}
+			for _, c := range cases {
+				ran = 0
+				if code := send(c.client, c.method, c.path, c.header, c.form); c.code != code {
+					t.Errorf("%s: status = %d, want %d", c.name, code, c.code)
+				}
+				if http.StatusForbidden == c.code && 0 != ran {
+					t.Errorf("%s: the middleware of the route ran for a rejected request", c.name)
+				}
+			}
+		})
+	}
+}
+
+func TestCSRFField(t *testing.T) {
+	var a = &app{}
+	for _, c := range []struct {
+		data any
+		want string
+	}{
+		{map[string]any{"csrf_token": csrfToken{field: "_csrf", token: "t<1>"}}, `<input type="hidden" name="_csrf" value="t&lt;1&gt;">`},
+		{"tok", `<input type="hidden" name="csrf_token" value="tok">`},
+		{map[string]any{}, ""},
+		{nil, ""},
+	} {
+		if got := string(a.tplCsrfField(c.data)); c.want != got {
+			t.Errorf("csrf_field of %v = %q, want %q", c.data, got, c.want)
+		}
+	}
+}
+
+func TestMergeShareDatas(t *testing.T) {
+	var (
+		shared = map[string]any{"site": "shop", "title": "shop"}
+		csrf   = map[string]any{"csrf_token": "t"}
+		data   = map[string]any{"title": "orders"}
+	)
+	got := mergeShareDatas(nil, []map[string]any{shared, csrf}).(map[string]any)
+	if 3 != len(got) || "t" != got["csrf_token"] {
+		t.Errorf("merged = %v", got)
+	}
+	got = mergeShareDatas(data, []map[string]any{shared, csrf}).(map[string]any)
+	if "orders" != got["title"] || "shop" != got["site"] || "t" != got["csrf_token"] {
+		t.Errorf("merged = %v", got)
+	}
+	if 2 != len(shared) || 1 != len(data) {
+		t.Errorf("the maps of the caller were changed: %v %v", shared, data)
+	}
+}
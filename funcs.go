@@ -2,15 +2,19 @@ package wgo
 
 import "html/template"
 
-var tplBuiltins = template.FuncMap{
-	"url": tplUrl,
+func (this *app) tplBuiltins() template.FuncMap {
+	return template.FuncMap{
+		"url":        this.tplUrl,
+		"csrf_token": this.tplCsrfToken,
+		"csrf_field": this.tplCsrfField,
+	}
 }
 
-func tplUrl(args ...string) template.URL {
+func (this *app) tplUrl(args ...string) template.URL {
 	if len(args) != 3 {
 		return "func url need 3 arguments"
 	}
-	r, e := appinst.router.getRouter(args[0], args[1], args[2])
+	r, e := this.router.getRouter(args[0], args[1], args[2])
 	if e != nil {
 		return template.URL(e.Error())
 	}
@@ -1425,7 +1425,8 @@ func (this *projectGenerater) genProjectAppJsonFile() error {
   "http": {
     "addr": "127.0.0.1",
     "port": 8888,
-    "use_websocket": false
+    "use_websocket": false,
+    "shutdown_timeout": 30
   },
   "inet_real_ip": "8.8.8.8",
   "file_host": {
@@ -2,43 +2,144 @@ package wgo
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+
+	"github.com/xiaocairen/wgo/service"
 )
 
 type HttpRequest struct {
 	Request *http.Request
 	query   url.Values
 	body    []byte
+	bodyErr error
+	strict  bool
+	codecs  *codecRegistry
+	logger  *log.Logger
+
+	writer     http.ResponseWriter
+	maxBody    int64
+	maxMemory  int64
+	limited    bool
+	rw         *responseWriter
+	formParsed bool
+	wsOptions  WSOptions
+	websockets *wsSet
+	sessions   *sessions
+	cookies    *cookies
+	csrf       *csrfState
+	csrfExempt bool
+	auth       *authenticator
+	principal  *Principal
+	authErr    error
+	authDone   bool
+	policy     *Policy
+	route      Router
+	params     []methodParam
+	svc        *service.Service
+	match      *routeMatch
+	routeLimit bool
 }
 
 func (r *HttpRequest) init() {
 	r.query = r.Request.URL.Query()
-	if r.Request.Method == POST || r.Request.Method == PUT || r.Request.Method == PATCH {
-		r.Request.ParseForm()
+}
+
+// parseForm parses the post form, or the multipart form, the first time the
+// form values are asked for.
+func (r *HttpRequest) parseForm() error {
+	if r.formParsed {
+		return r.bodyErr
+	}
+	r.formParsed = true
+	if r.Request.Method != POST && r.Request.Method != PUT && r.Request.Method != PATCH {
+		return nil
+	}
+
+	r.BodyReader()
+	var e error
+	if strings.HasPrefix(r.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		e = r.Request.ParseMultipartForm(r.maxMemory)
+	} else {
+		e = r.Request.ParseForm()
 	}
+	if e != nil && !errors.Is(e, http.ErrNotMultipart) && nil == r.bodyErr {
+		r.bodyErr = e
+	}
+	return r.bodyErr
 }
 
-func (r *HttpRequest) Body() []byte {
-	if nil != r.body {
-		return r.body
+// Body reads the whole request body, it fails with a *http.MaxBytesError when
+// the body is over the max body size.
+func (r *HttpRequest) Body() ([]byte, error) {
+	if nil != r.body || nil != r.bodyErr {
+		return r.body, r.bodyErr
 	}
 
-	var buf = make([]byte, 1024)
-	for {
-		n, e := r.Request.Body.Read(buf)
-		if n > 0 {
-			r.body = append(r.body, buf[:n]...)
-		}
-		if e != nil && e == io.EOF {
-			break
+	r.body, r.bodyErr = io.ReadAll(r.BodyReader())
+	if nil == r.body {
+		r.body = []byte{}
+	}
+	return r.body, r.bodyErr
+}
+
+// BodyReader returns the request body limited to the max body size, to decode
+// a large body as it comes in. Body and the form values are not available
+// once it has been read from, and it is already read for an action with
+// params bound from the body.
+func (r *HttpRequest) BodyReader() io.Reader {
+	if !r.limited {
+		r.limited = true
+		if r.maxBody > 0 {
+			r.Request.Body = &limitedBody{ReadCloser: http.MaxBytesReader(r.writer, r.Request.Body, r.maxBody), r: r}
 		}
 	}
+	return r.Request.Body
+}
 
-	return r.body
+// limitedBody is a body with a max size, the request is answered 413 as soon
+// as it is read over the size, whoever reads it.
+type limitedBody struct {
+	io.ReadCloser
+	r *HttpRequest
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, e := b.ReadCloser.Read(p)
+	var me *http.MaxBytesError
+	if nil != e && errors.As(e, &me) {
+		b.r.tooLarge(me)
+	}
+	return n, e
+}
+
+// tooLarge answers 413 unless the response has started, what is written for
+// the request after it is dropped.
+func (r *HttpRequest) tooLarge(e *http.MaxBytesError) {
+	if nil == r.bodyErr {
+		r.bodyErr = e
+	}
+	if nil == r.rw || r.rw.written {
+		return
+	}
+	r.rw.Header().Del("Content-Encoding")
+	r.rw.Header().Del("Content-Length")
+	writeError(&HttpResponse{Writer: r.rw, cookies: r.cookies, logger: r.logger}, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is over %d bytes", e.Limit))
+	r.rw.discard = true
+}
+
+// bodyTooLarge reports whether reading the body failed on the max body size.
+func (r *HttpRequest) bodyTooLarge() bool {
+	var e *http.MaxBytesError
+	return errors.As(r.bodyErr, &e)
 }
 
 func (r *HttpRequest) Get(key string) string {
@@ -86,7 +187,7 @@ func (r *HttpRequest) GetIntSlice(key string) []int64 {
 }
 
 func (r *HttpRequest) GetPost(key string) string {
-	if nil == r.Request.PostForm {
+	if nil != r.parseForm() || nil == r.Request.PostForm {
 		return ""
 	}
 	return r.Request.PostForm.Get(key)
@@ -117,14 +218,14 @@ func (r *HttpRequest) GetPostFloat(key string) float64 {
 }
 
 func (r *HttpRequest) GetPostSlice(key string) []string {
-	if nil == r.Request.PostForm {
+	if nil != r.parseForm() || nil == r.Request.PostForm {
 		return nil
 	}
 	return r.Request.PostForm[key]
 }
 
 func (r *HttpRequest) GetPostIntSlice(key string) []int64 {
-	if nil == r.Request.PostForm {
+	if nil != r.parseForm() || nil == r.Request.PostForm {
 		return nil
 	}
 	ret := make([]int64, len(r.Request.PostForm[key]))
@@ -146,6 +247,14 @@ func (r *HttpRequest) GetRequest(key string) string {
 	return v
 }
 
+func (r *HttpRequest) GetRequestSlice(key string) []string {
+	v := r.GetPostSlice(key)
+	if 0 == len(v) {
+		v = r.GetSlice(key)
+	}
+	return v
+}
+
 func (r *HttpRequest) GetRequestInt(key string) int64 {
 	i := r.GetPostInt(key)
 	if 0 == i {
@@ -214,6 +323,19 @@ func (r *HttpRequest) GetRemoteAddr() string {
 	return r.Request.RemoteAddr
 }
 
+// Context returns the context of the request, it is cancelled when the client
+// goes away or the request deadline is over.
+func (r *HttpRequest) Context() context.Context {
+	return r.Request.Context()
+}
+
+// ListenerName returns the name of the listener the request came in through,
+// as set in the listen list of the http section, "https" for the https one.
+func (r *HttpRequest) ListenerName() string {
+	name, _ := r.Request.Context().Value(listenerNameKey{}).(string)
+	return name
+}
+
 func (r *HttpRequest) IsPost() bool {
 	return POST == r.Request.Method
 }
@@ -229,21 +351,26 @@ type HttpResponse struct {
 	Writer     http.ResponseWriter
 	Body       [][]byte
 	statusCode int
+	sseWriter  *SSEWriter
+	wsConn     *WSConn
+	session    *Session
+	cookies    *cookies
+	logger     *log.Logger
 }
 
 func (r *HttpResponse) SetCookie(name, value, path string, maxAge int, secure, httpOnly bool) {
-	c := http.Cookie{Name: name, Value: value, Path: path, MaxAge: maxAge, Secure: secure, HttpOnly: httpOnly}
-	r.Writer.Header().Set("Set-Cookie", c.String())
+	r.WriteCookie(&http.Cookie{Name: name, Value: value, Path: path, MaxAge: maxAge, Secure: secure, HttpOnly: httpOnly})
 }
 
+// AddCookie adds a cookie even when one of the same name and path is set.
 func (r *HttpResponse) AddCookie(name, value, path string, maxAge int, secure, httpOnly bool) {
-	c := http.Cookie{Name: name, Value: value, Path: path, MaxAge: maxAge, Secure: secure, HttpOnly: httpOnly}
+	c := &http.Cookie{Name: name, Value: value, Path: path, MaxAge: maxAge, Secure: secure, HttpOnly: httpOnly}
+	r.cookies.complete(c)
 	r.Writer.Header().Add("Set-Cookie", c.String())
 }
 
 func (r *HttpResponse) DelCookie(name string, path string) {
-	c := http.Cookie{Name: name, Value: "", Path: path, MaxAge: -1}
-	r.Writer.Header().Set("Set-Cookie", c.String())
+	r.WriteCookie(&http.Cookie{Name: name, Value: "", Path: path, MaxAge: -1})
 }
 
 func (r *HttpResponse) Append(body []byte) *HttpResponse {
@@ -297,3 +424,66 @@ func (r *HttpResponse) WriteHeader(statusCode int) {
 	r.statusCode = statusCode
 	r.Writer.WriteHeader(statusCode)
 }
+
+// Written reports whether the status line has been sent to the client.
+func (r *HttpResponse) Written() bool {
+	if w, ok := r.Writer.(*responseWriter); ok {
+		return w.written
+	}
+	return r.statusCode > 0
+}
+
+// hijacked marks the response as sent once the connection is taken over.
+func (r *HttpResponse) hijacked() {
+	r.statusCode = http.StatusSwitchingProtocols
+	if w, ok := r.Writer.(*responseWriter); ok {
+		w.status = http.StatusSwitchingProtocols
+		w.written = true
+	}
+}
+
+// responseWriter records the status code sent through it, so the framework
+// knows if the header can still be changed. the beforeWrite funcs run just
+// before the header is written, to set the cookies of the session.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	written     bool
+	discard     bool
+	beforeWrite []func()
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if w.written {
+		return
+	}
+	for _, fn := range w.beforeWrite {
+		fn()
+	}
+	w.status = statusCode
+	w.written = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.discard {
+		return len(b), nil
+	}
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.written {
+			w.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
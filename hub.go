@@ -0,0 +1,149 @@
+package wgo
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// Hub groups websockets in rooms to broadcast to them. a connection leaves
+// every room of the hub when it is closed.
+type Hub struct {
+	mu     sync.RWMutex
+	rooms  map[string]map[*WSConn]struct{}
+	joined map[*WSConn]map[string]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		rooms:  make(map[string]map[*WSConn]struct{}),
+		joined: make(map[*WSConn]map[string]struct{}),
+	}
+}
+
+// Join adds c to a room.
+func (h *Hub) Join(room string, c *WSConn) {
+	h.mu.Lock()
+	if nil == h.rooms[room] {
+		h.rooms[room] = make(map[*WSConn]struct{})
+	}
+	h.rooms[room][c] = struct{}{}
+	var first = nil == h.joined[c]
+	if first {
+		h.joined[c] = make(map[string]struct{})
+	}
+	h.joined[c][room] = struct{}{}
+	h.mu.Unlock()
+
+	if first {
+		c.OnClose(h.LeaveAll)
+	}
+}
+
+func (h *Hub) Leave(room string, c *WSConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leave(room, c)
+}
+
+// LeaveAll removes c from every room.
+func (h *Hub) LeaveAll(c *WSConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for room := range h.joined[c] {
+		h.leave(room, c)
+	}
+}
+
+func (h *Hub) leave(room string, c *WSConn) {
+	if conns, ok := h.rooms[room]; ok {
+		delete(conns, c)
+		if 0 == len(conns) {
+			delete(h.rooms, room)
+		}
+	}
+	if rooms, ok := h.joined[c]; ok {
+		delete(rooms, room)
+		if 0 == len(rooms) {
+			delete(h.joined, c)
+		}
+	}
+}
+
+// Broadcast sends a message to the connections of a room but the ones in
+// except, and returns how many got it. the writes run side by side, a slow
+// connection delays the broadcast up to its write timeout, a failed one is
+// closed.
+func (h *Hub) Broadcast(room string, typ int, data []byte, except ...*WSConn) int {
+	h.mu.RLock()
+	var conns = make([]*WSConn, 0, len(h.rooms[room]))
+	for c := range h.rooms[room] {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		sent int
+	)
+next:
+	for _, c := range conns {
+		for _, x := range except {
+			if x == c {
+				continue next
+			}
+		}
+		wg.Add(1)
+		go func(c *WSConn) {
+			defer wg.Done()
+			if nil == c.WriteMessage(typ, data) {
+				mu.Lock()
+				sent++
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	return sent
+}
+
+// BroadcastJSON sends v as a json text message to a room.
+func (h *Hub) BroadcastJSON(room string, v any, except ...*WSConn) (int, error) {
+	b, e := json.Marshal(v)
+	if e != nil {
+		return 0, e
+	}
+	return h.Broadcast(room, WSText, b, except...), nil
+}
+
+// Count returns the number of connections in a room.
+func (h *Hub) Count(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms[room])
+}
+
+// Rooms returns the rooms that have connections, sorted.
+func (h *Hub) Rooms() []string {
+	h.mu.RLock()
+	var rooms = make([]string, 0, len(h.rooms))
+	for room := range h.rooms {
+		rooms = append(rooms, room)
+	}
+	h.mu.RUnlock()
+	sort.Strings(rooms)
+	return rooms
+}
+
+// RoomsOf returns the rooms c is in, sorted.
+func (h *Hub) RoomsOf(c *WSConn) []string {
+	h.mu.RLock()
+	var rooms = make([]string, 0, len(h.joined[c]))
+	for room := range h.joined[c] {
+		rooms = append(rooms, room)
+	}
+	h.mu.RUnlock()
+	sort.Strings(rooms)
+	return rooms
+}
@@ -0,0 +1,309 @@
+package wgo
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenInvalid  = errors.New("token is invalid")
+	ErrTokenExpired  = errors.New("token is expired")
+	ErrAPIKeyInvalid = errors.New("api key is invalid")
+)
+
+// jwtKey is a key tokens are verified with, alg is HS256, RS256 or EdDSA.
+type jwtKey struct {
+	kid    string
+	alg    string
+	secret []byte
+	rsa    *rsa.PublicKey
+	ed     ed25519.PublicKey
+}
+
+// jwtKeyConfig is a key of the jwt section, secret is the one of HS256, the
+// others are given by a pem public key or certificate, inline or in a file.
+type jwtKeyConfig struct {
+	Kid           string `json:"kid"`
+	Alg           string `json:"alg"`
+	Secret        string `json:"secret"`
+	PublicKey     string `json:"public_key"`
+	PublicKeyFile string `json:"public_key_file"`
+}
+
+func (c jwtKeyConfig) key(path func(string) string) (*jwtKey, error) {
+	var k = &jwtKey{kid: c.Kid, alg: c.Alg}
+	if "HS256" == c.Alg {
+		if "" == c.Secret {
+			return nil, fmt.Errorf("jwt key '%s' has no secret", c.Kid)
+		}
+		k.secret = []byte(c.Secret)
+		return k, nil
+	}
+	if "RS256" != c.Alg && "EdDSA" != c.Alg {
+		return nil, fmt.Errorf("jwt key '%s' has unsupported alg '%s'", c.Kid, c.Alg)
+	}
+
+	var data = []byte(c.PublicKey)
+	if "" != c.PublicKeyFile {
+		var e error
+		if data, e = os.ReadFile(path(c.PublicKeyFile)); e != nil {
+			return nil, e
+		}
+	}
+	pub, e := parsePublicKey(data)
+	if e != nil {
+		return nil, fmt.Errorf("jwt key '%s': %s", c.Kid, e)
+	}
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		if "RS256" == c.Alg {
+			k.rsa = p
+			return k, nil
+		}
+	case ed25519.PublicKey:
+		if "EdDSA" == c.Alg {
+			k.ed = p
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("jwt key '%s' is not a %s key", c.Kid, c.Alg)
+}
+
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if nil == block {
+		return nil, errors.New("no pem block")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, e := x509.ParseCertificate(block.Bytes)
+		if e != nil {
+			return nil, e
+		}
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unsupported pem block '%s'", block.Type)
+}
+
+// loadJWKS reads the RSA, Ed25519 and symmetric keys of a JWKS file, the
+// keys without alg take the one of their type.
+func loadJWKS(file string) ([]*jwtKey, error) {
+	data, e := os.ReadFile(file)
+	if e != nil {
+		return nil, e
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if e = json.Unmarshal(data, &set); e != nil {
+		return nil, fmt.Errorf("jwks %s: %s", file, e)
+	}
+
+	var keys []*jwtKey
+	for _, jk := range set.Keys {
+		if "" != jk.Use && "sig" != jk.Use {
+			continue
+		}
+		var (
+			k   = &jwtKey{kid: jk.Kid, alg: jk.Alg}
+			err error
+		)
+		switch jk.Kty {
+		case "RSA":
+			var n, ex []byte
+			if n, err = base64.RawURLEncoding.DecodeString(jk.N); nil == err {
+				ex, err = base64.RawURLEncoding.DecodeString(jk.E)
+			}
+			if nil == err && len(ex) > 0 && len(ex) <= 4 {
+				k.rsa = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(ex).Int64())}
+			} else if nil == err {
+				err = errors.New("invalid exponent")
+			}
+			if "" == k.alg {
+				k.alg = "RS256"
+			}
+		case "OKP":
+			if "Ed25519" != jk.Crv {
+				continue
+			}
+			var x []byte
+			if x, err = base64.RawURLEncoding.DecodeString(jk.X); nil == err && ed25519.PublicKeySize != len(x) {
+				err = errors.New("invalid ed25519 key")
+			}
+			k.ed = ed25519.PublicKey(x)
+			if "" == k.alg {
+				k.alg = "EdDSA"
+			}
+		case "oct":
+			k.secret, err = base64.RawURLEncoding.DecodeString(jk.K)
+			if "" == k.alg {
+				k.alg = "HS256"
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwks %s key '%s': %s", file, jk.Kid, err)
+		}
+		if "HS256" == k.alg || "RS256" == k.alg || "EdDSA" == k.alg {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (k *jwtKey) verify(signed, sig []byte) bool {
+	switch k.alg {
+	case "HS256":
+		var m = hmac.New(sha256.New, k.secret)
+		m.Write(signed)
+		return nil != k.secret && hmac.Equal(sig, m.Sum(nil))
+	case "RS256":
+		var h = sha256.Sum256(signed)
+		return nil != k.rsa && nil == rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, h[:], sig)
+	case "EdDSA":
+		return nil != k.ed && ed25519.Verify(k.ed, signed, sig)
+	}
+	return false
+}
+
+// jwtVerifier checks the signature and the registered claims of tokens.
+type jwtVerifier struct {
+	keys     []*jwtKey
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+// verify returns the claims of a valid token. the alg of the header must be
+// the one of the key, a token can't pick another way to be checked.
+func (v *jwtVerifier) verify(token string, now time.Time) (map[string]any, error) {
+	var parts = strings.Split(token, ".")
+	if 3 != len(parts) {
+		return nil, ErrTokenInvalid
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if e := decodeSegment(parts[0], &header); e != nil {
+		return nil, ErrTokenInvalid
+	}
+	sig, e := base64.RawURLEncoding.DecodeString(parts[2])
+	if e != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	var (
+		signed = []byte(parts[0] + "." + parts[1])
+		ok     bool
+	)
+	for _, k := range v.keys {
+		if k.alg == header.Alg && ("" == header.Kid || "" == k.kid || k.kid == header.Kid) && k.verify(signed, sig) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+
+	var claims map[string]any
+	if e = decodeSegment(parts[1], &claims); e != nil {
+		return nil, ErrTokenInvalid
+	}
+	exp, hasExp := numericClaim(claims, "exp")
+	if !hasExp {
+		return nil, ErrTokenInvalid
+	} else if now.After(exp.Add(v.leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if nbf, has := numericClaim(claims, "nbf"); has && now.Add(v.leeway).Before(nbf) {
+		return nil, ErrTokenInvalid
+	}
+	if "" != v.issuer && v.issuer != claims["iss"] {
+		return nil, ErrTokenInvalid
+	}
+	if "" != v.audience && !contains(stringsClaim(claims["aud"]), v.audience) {
+		return nil, ErrTokenInvalid
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, out any) error {
+	b, e := base64.RawURLEncoding.DecodeString(seg)
+	if e != nil {
+		return e
+	}
+	var d = json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(out)
+}
+
+func numericClaim(claims map[string]any, name string) (time.Time, bool) {
+	n, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, e := n.Float64()
+	if e != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// stringsClaim reads a claim that is a string array, or a string of space
+// separated values like scope.
+func stringsClaim(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return strings.Fields(t)
+	case []any:
+		var list = make([]string, 0, len(t))
+		for _, i := range t {
+			if s, ok := i.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, i := range list {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+package wgo
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/xiaocairen/wgo/reuse"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpConfig is the "http" section of app.json, the timeouts are seconds
+//
+//	"http": {
+//	  "addr": "127.0.0.1",
+//	  "port": 8888,
+//	  "use_websocket": false,
+//	  "read_timeout": 30,
+//	  "read_header_timeout": 0,
+//	  "write_timeout": 30,
+//	  "idle_timeout": 0,
+//	  "max_header_bytes": 1048576,
+//	  "shutdown_timeout": 30,
+//	  "request_timeout": 0,
+//	  "max_body_bytes": 0,
+//	  "max_multipart_memory": 33554432,
+//	  "websocket_read_limit": 1048576,
+//	  "websocket_ping_interval": 30,
+//	  "reuse_port": false,
+//	  "listen": [
+//	    {"name": "public", "addr": "0.0.0.0:8888"},
+//	    {"name": "admin", "addr": "unix:/run/app/admin.sock"}
+//	  ]
+//	}
+//
+// when listen is set addr and port are not used. a timeout set to 0 means no
+// timeout, a missing one takes the default. request_timeout is the deadline
+// of the request context, the queries of the action Service are cancelled
+// when it is over. a body over max_body_bytes is answered with 413, 0 means
+// no limit. max_multipart_memory is the bytes of a multipart body kept
+// in memory, the files over it go to temporary files. reuse_port opens the
+// tcp listeners with SO_REUSEADDR and SO_REUSEPORT, so a new process can bind
+// the same port while the old one is still draining. websocket_read_limit
+// is the bytes a websocket message may have, a ping is sent on the
+// websockets every websocket_ping_interval, 0 disables it.
+type httpConfig struct {
+	Addr               string         `json:"addr"`
+	Port               int            `json:"port"`
+	UseWebsocket       bool           `json:"use_websocket"`
+	ReadTimeout        *int           `json:"read_timeout"`
+	ReadHeaderTimeout  *int           `json:"read_header_timeout"`
+	WriteTimeout       *int           `json:"write_timeout"`
+	IdleTimeout        *int           `json:"idle_timeout"`
+	MaxHeaderBytes     int            `json:"max_header_bytes"`
+	ShutdownTimeout    int            `json:"shutdown_timeout"`
+	RequestTimeout     int            `json:"request_timeout"`
+	MaxBodyBytes       int64          `json:"max_body_bytes"`
+	MaxMultipartMemory int64          `json:"max_multipart_memory"`
+	WSReadLimit        int64          `json:"websocket_read_limit"`
+	WSPingInterval     *int           `json:"websocket_ping_interval"`
+	ReusePort          bool           `json:"reuse_port"`
+	Listen             []listenConfig `json:"listen"`
+}
+
+type listenConfig struct {
+	Name string `json:"name"`
+	Addr string `json:"addr"`
+}
+
+func (this *app) getHttpConfig() *httpConfig {
+	var c httpConfig
+	if err := this.configurator.GetStruct("http", &c); err != nil {
+		panic(err)
+	}
+	if 0 == len(c.Listen) {
+		c.Listen = []listenConfig{{Name: "http", Addr: c.Addr + ":" + strconv.Itoa(c.Port)}}
+	}
+	if c.MaxHeaderBytes <= 0 {
+		c.MaxHeaderBytes = 1 << 20
+	}
+	if c.MaxMultipartMemory <= 0 {
+		c.MaxMultipartMemory = 32 << 20
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = 30
+	}
+	return &c
+}
+
+func (c *httpConfig) newServer(name string, handler http.Handler, logger *log.Logger) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ErrorLog:          logger,
+		ReadTimeout:       seconds(c.ReadTimeout, 30),
+		ReadHeaderTimeout: seconds(c.ReadHeaderTimeout, 0),
+		WriteTimeout:      seconds(c.WriteTimeout, 30),
+		IdleTimeout:       seconds(c.IdleTimeout, 0),
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+		ConnContext: func(ctx context.Context, _ net.Conn) context.Context {
+			return context.WithValue(ctx, listenerNameKey{}, name)
+		},
+	}
+}
+
+// wsOptions are the websocket options of every route, the Websocket
+// middleware overrides them.
+func (c *httpConfig) wsOptions() WSOptions {
+	var o = WSOptions{ReadLimit: c.WSReadLimit, PingInterval: seconds(c.WSPingInterval, 30)}
+	if 0 == o.PingInterval {
+		o.PingInterval = -1
+	}
+	return o
+}
+
+func seconds(v *int, def int) time.Duration {
+	if nil == v {
+		return time.Duration(def) * time.Second
+	}
+	return time.Duration(*v) * time.Second
+}
+
+type listenerNameKey struct{}
+
+// newServers opens the listeners and creates a server for every listen
+// address of the http section, and one for https when it is enabled. it
+// returns the functions serving them, for wait.
+func (this *app) newServers(handler http.Handler) (serves []func() error, err error) {
+	var (
+		hc       = this.getHttpConfig()
+		tc       = this.getHttpsConfig()
+		redirect http.Handler
+	)
+	// the listeners opened before an error are closed, the unix ones remove
+	// their socket file.
+	defer func() {
+		if nil != err {
+			for _, l := range this.listeners {
+				l.ln.Close()
+			}
+			this.listeners, this.servers, this.certReloader = nil, nil, nil
+		}
+	}()
+
+	if nil != tc {
+		tlsConfig, reloader, err := newTLSConfig(tc)
+		if err != nil {
+			return nil, err
+		}
+		this.certReloader = reloader
+
+		ln, err := this.listen("https", tc.Addr+":"+strconv.Itoa(tc.Port), hc.ReusePort)
+		if err != nil {
+			return nil, err
+		}
+		srv := hc.newServer("https", handler, this.logger)
+		srv.TLSConfig = tlsConfig
+		if nil != tc.Http2 && !*tc.Http2 {
+			srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		}
+		this.servers = append(this.servers, srv)
+		serves = append(serves, func() error { return srv.ServeTLS(ln, "", "") })
+
+		if tc.RedirectHttp {
+			redirect = redirectToHttps(tc.Port)
+		}
+	}
+
+	for _, l := range hc.Listen {
+		ln, err := this.listen(l.Name, l.Addr, hc.ReusePort)
+		if err != nil {
+			return nil, err
+		}
+		var h = handler
+		if nil != redirect && !strings.HasPrefix(l.Addr, "unix:") && contains(tc.RedirectListen, l.Name) {
+			h = redirect
+		}
+		srv := hc.newServer(l.Name, h, this.logger)
+		this.servers = append(this.servers, srv)
+		serves = append(serves, func() error { return srv.Serve(ln) })
+	}
+	return serves, nil
+}
+
+// wait runs the servers and returns the first error of one that stops without
+// Shutdown.
+func (this *app) wait(serves []func() error) error {
+	var errc = make(chan error, len(serves))
+	for _, serve := range serves {
+		go func(serve func() error) {
+			if e := serve(); e != nil && e != http.ErrServerClosed {
+				errc <- e
+			}
+		}(serve)
+	}
+
+	select {
+	case e := <-errc:
+		return e
+	case <-this.done:
+		return nil
+	}
+}
+
+// listen takes the listener inherited for name or addr, or opens a tcp
+// listener, or a unix socket for an address written as "unix:/path/to.sock".
+// a socket file left by a previous process is removed.
+func (this *app) listen(name, addr string, reusePort bool) (ln net.Listener, err error) {
+	defer func() {
+		if nil == err {
+			this.listeners = append(this.listeners, namedListener{name: name, ln: ln})
+		}
+	}()
+
+	if ln = this.inherited.take(name, addr); nil != ln {
+		return ln, nil
+	}
+
+	if strings.HasPrefix(addr, "unix:") {
+		path := addr[len("unix:"):]
+		if fi, err := os.Stat(path); nil == err && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	if reusePort && reuse.Enabled {
+		return reuse.Listen("tcp", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Timeout overrides the read and write deadlines of the server for the routes
+// it wraps, a zero duration removes the deadline, which long polling and large
+// uploads need.
+func Timeout(read, write time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w *HttpResponse, r *HttpRequest) {
+			rc := http.NewResponseController(w.Writer)
+			rc.SetReadDeadline(deadline(read))
+			rc.SetWriteDeadline(deadline(write))
+			next(w, r)
+		}
+	}
+}
+
+// RequestTimeout sets a deadline on the request context, the controller and
+// its Service see it through Context. the http section sets one for every
+// request with request_timeout, a route can shorten it with this middleware.
+func RequestTimeout(d time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w *HttpResponse, r *HttpRequest) {
+			ctx, cancel := context.WithTimeout(r.Request.Context(), d)
+			defer cancel()
+			r.Request = r.Request.WithContext(ctx)
+			next(w, r)
+		}
+	}
+}
+
+// MaxBodySize sets the max body size of the requests it wraps, replacing the
+// max_body_bytes of the http section. 0 means no limit. the one of a route or
+// a namespace applies from the start of the request, the global middlewares
+// read the body within it, and the innermost one of a route wins.
+func MaxBodySize(n int64) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		declareRoute(func(route *Router) {
+			if !route.hasMaxBody {
+				route.maxBody, route.hasMaxBody = n, true
+			}
+		})
+		return func(w *HttpResponse, r *HttpRequest) {
+			if !r.routeLimit {
+				r.maxBody = n
+			}
+			next(w, r)
+		}
+	}
+}
+
+func deadline(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
+// OnlyListener answers 404 to requests that did not come in through one of
+// the named listeners, to keep admin routes off the public port.
+func OnlyListener(names ...string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w *HttpResponse, r *HttpRequest) {
+			var name = r.ListenerName()
+			for _, n := range names {
+				if n == name {
+					next(w, r)
+					return
+				}
+			}
+			writeError(w, r, http.StatusNotFound, RouteNotFoundError{path: r.GetHost() + r.GetRequestURI()}.Error())
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package wgo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type contextController struct {
+	WgoController
+}
+
+// Deadline answers the time left to the deadline of the request context.
+func (this *contextController) Deadline() []byte {
+	if this.Service.Context() != this.Context() {
+		return []byte("the service has another context")
+	}
+	d, ok := this.Context().Deadline()
+	if !ok {
+		return []byte("none")
+	}
+	return []byte(time.Until(d).Round(time.Second).String())
+}
+
+func TestRequestTimeout(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		timeout int
+		path    string
+		want    string
+	}{
+		{"no request_timeout", 0, "/deadline", "none"},
+		{"request_timeout", 10, "/deadline", "10s"},
+		{"route without middleware", 0, "/short", "2s"},
+		{"route shortens request_timeout", 10, "/short", "2s"},
+		{"route can't extend request_timeout", 1, "/short", "1s"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var (
+				ctrl = &contextController{}
+				a    = newTestApp(t, map[string]any{"http": map[string]any{"request_timeout": c.timeout}})
+			)
+			a.SetRouteCollection(func(r *RouteRegister) {
+				r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+					m.Get("/deadline", ctrl, "Deadline()")
+					um.Get(RouteUnit{Path: "/short", Controller: ctrl, Action: "Deadline()", Middlewares: []Middleware{RequestTimeout(2 * time.Second)}})
+				})
+			})
+			req, _ := http.NewRequest(GET, serveTestApp(t, a).URL+c.path, nil)
+			if code, body := testGet(t, nil, req); 200 != code || c.want != body {
+				t.Fatalf("got %d %q, want %q", code, body, c.want)
+			}
+		})
+	}
+}
+
+func TestNewServers(t *testing.T) {
+	var a = newTestApp(t, map[string]any{"http": map[string]any{"listen": []map[string]any{
+		{"name": "public", "addr": "127.0.0.1:0"},
+		{"name": "admin", "addr": "127.0.0.1:0"},
+	}}})
+	serves, e := a.newServers(http.NotFoundHandler())
+	if e != nil {
+		t.Fatal(e)
+	}
+	if 2 != len(serves) || 2 != len(a.servers) || 2 != len(a.listeners) {
+		t.Fatalf("%d serves, %d servers and %d listeners before serving", len(serves), len(a.servers), len(a.listeners))
+	}
+
+	var done = make(chan error, 1)
+	go func() { done <- a.wait(serves) }()
+	for _, l := range a.listeners {
+		conn, e := net.Dial("tcp", l.ln.Addr().String())
+		if e != nil {
+			t.Fatalf("%s: %v", l.name, e)
+		}
+		conn.Close()
+	}
+	if e = a.Shutdown(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+	if e = <-done; e != nil {
+		t.Fatalf("wait = %v", e)
+	}
+	for _, l := range a.listeners {
+		if _, e := net.Dial("tcp", l.ln.Addr().String()); nil == e {
+			t.Fatalf("%s still accepts after Shutdown", l.name)
+		}
+	}
+}
+
+func TestNewServersError(t *testing.T) {
+	taken, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer taken.Close()
+
+	var (
+		sock = filepath.Join(t.TempDir(), "app.sock")
+		a    = newTestApp(t, map[string]any{"http": map[string]any{"listen": []map[string]any{
+			{"name": "local", "addr": "unix:" + sock},
+			{"name": "public", "addr": "127.0.0.1:0"},
+			{"name": "taken", "addr": taken.Addr().String()},
+		}}})
+	)
+	if _, e = a.newServers(http.NotFoundHandler()); nil == e {
+		t.Fatal("listened on a taken address")
+	}
+	if 0 != len(a.listeners) || 0 != len(a.servers) {
+		t.Fatalf("%d listeners and %d servers kept", len(a.listeners), len(a.servers))
+	}
+	if _, e = os.Stat(sock); !os.IsNotExist(e) {
+		t.Fatalf("socket file left: %v", e)
+	}
+}
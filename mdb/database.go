@@ -1,6 +1,7 @@
 package mdb
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
@@ -57,104 +58,112 @@ type DB struct {
 	dynamic sync.Map
 }
 
+// NewDB opens the process wide DB on the first call, later calls return it
+// whatever dbcs they pass.
 func NewDB(dbcs []*DBConfig, testPing bool) (*DB, error) {
 	var err error
 	onceNewDB.Do(func() {
-		if nil == dbcs || 0 == len(dbcs) {
-			dbInstance = &DB{empty: true}
-			return
-		}
+		dbInstance, err = Open(dbcs, testPing)
+	})
+	return dbInstance, err
+}
 
-		var (
-			dres  *dbres
-			rwres []*dbres
-			rres  []*dbres
-			wres  []*dbres
-		)
+// Open opens a new DB on every call, an empty DB is returned with the error.
+func Open(dbcs []*DBConfig, testPing bool) (*DB, error) {
+	if nil == dbcs || 0 == len(dbcs) {
+		return &DB{empty: true}, nil
+	}
 
-		if 1 == len(dbcs) {
-			db, dsn, e := openDB(dbcs[0], testPing)
-			if e != nil {
-				dbInstance = &DB{empty: true}
-				err = e
-				return
-			}
-			dres = &dbres{
-				db:     db,
-				dbname: dbcs[0].HostDBName,
-				dsn:    dsn,
-			}
+	var (
+		dres  *dbres
+		rwres []*dbres
+		rres  []*dbres
+		wres  []*dbres
+	)
 
-			dbInstance = &DB{
-				alone: true,
-				dres:  dres,
-				rwres: nil,
-				rres:  nil,
-				wres:  nil,
-				rwlen: 0,
-				rlen:  0,
-				wlen:  0,
-			}
-		} else {
-			for _, dbc := range dbcs {
-				db, dsn, e := openDB(dbc, testPing)
-				if e != nil {
-					dbInstance = &DB{empty: true}
-					err = e
-					return
-				}
-				switch dbc.ReadOrWrite {
-				case READ_WRITE:
-					rwres = append(rwres, &dbres{
-						db:     db,
-						dbname: dbc.HostDBName,
-						dsn:    dsn,
-					})
-				case ONLY_READ:
-					rres = append(rres, &dbres{
-						db:     db,
-						dbname: dbc.HostDBName,
-						dsn:    dsn,
-					})
-				case ONLY_WRITE:
-					wres = append(wres, &dbres{
-						db:     db,
-						dbname: dbc.HostDBName,
-						dsn:    dsn,
-					})
-				default:
-					dbInstance = &DB{empty: true}
-					err = fmt.Errorf("database tag read_or_write must be 0, 1, 2; 0:rw, 1:r, 2:w")
-					return
-				}
-			}
+	if 1 == len(dbcs) {
+		db, dsn, e := openDB(dbcs[0], testPing)
+		if e != nil {
+			return &DB{empty: true}, e
+		}
+		dres = &dbres{
+			db:     db,
+			dbname: dbcs[0].HostDBName,
+			dsn:    dsn,
+		}
 
-			var (
-				rwlen = len(rwres)
-				wlen  = len(wres)
-				rlen  = len(rres)
-			)
-			if rwlen > 0 {
-				dres = rwres[0]
-			} else if wlen > 0 {
-				dres = wres[0]
-			} else {
-				dres = rres[0]
-			}
+		return &DB{
+			alone: true,
+			dres:  dres,
+			rwres: nil,
+			rres:  nil,
+			wres:  nil,
+			rwlen: 0,
+			rlen:  0,
+			wlen:  0,
+		}, nil
+	}
 
-			dbInstance = &DB{
-				alone: false,
-				dres:  dres,
-				rwres: rwres,
-				rres:  rres,
-				wres:  wres,
-				rwlen: rwlen,
-				rlen:  rlen,
-				wlen:  wlen,
-			}
+	// the pools opened before a config that fails are closed.
+	var fail = func(e error) (*DB, error) {
+		for _, r := range append(append(rwres, rres...), wres...) {
+			r.db.Close()
 		}
-	})
-	return dbInstance, err
+		return &DB{empty: true}, e
+	}
+	for _, dbc := range dbcs {
+		db, dsn, e := openDB(dbc, testPing)
+		if e != nil {
+			return fail(e)
+		}
+		switch dbc.ReadOrWrite {
+		case READ_WRITE:
+			rwres = append(rwres, &dbres{
+				db:     db,
+				dbname: dbc.HostDBName,
+				dsn:    dsn,
+			})
+		case ONLY_READ:
+			rres = append(rres, &dbres{
+				db:     db,
+				dbname: dbc.HostDBName,
+				dsn:    dsn,
+			})
+		case ONLY_WRITE:
+			wres = append(wres, &dbres{
+				db:     db,
+				dbname: dbc.HostDBName,
+				dsn:    dsn,
+			})
+		default:
+			db.Close()
+			return fail(fmt.Errorf("database tag read_or_write must be 0, 1, 2; 0:rw, 1:r, 2:w"))
+		}
+	}
+
+	var (
+		rwlen = len(rwres)
+		wlen  = len(wres)
+		rlen  = len(rres)
+	)
+	if rwlen > 0 {
+		dres = rwres[0]
+	} else if wlen > 0 {
+		dres = wres[0]
+	} else {
+		dres = rres[0]
+	}
+
+	return &DB{
+		alone: false,
+		dres:  dres,
+		rwres: rwres,
+		rres:  rres,
+		wres:  wres,
+		rwlen: rwlen,
+		rlen:  rlen,
+		wlen:  wlen,
+	}, nil
 }
 
 func openDB(dbc *DBConfig, testPing bool) (db *sql.DB, dsn string, err error) {
@@ -170,6 +179,8 @@ func openDB(dbc *DBConfig, testPing bool) (db *sql.DB, dsn string, err error) {
 
 	if testPing {
 		if err = db.Ping(); err != nil {
+			db.Close()
+			db = nil
 			return
 		}
 	}
@@ -302,8 +313,35 @@ func (db *DB) NewConn(dbc *DBConfig) (*Conn, error) {
 	}
 }
 
+// Close closes every pool of the DB, including the ones opened by NewConn.
+func (db *DB) Close() error {
+	var (
+		err    error
+		closed = make(map[*sql.DB]bool)
+		res    = append(append(append([]*dbres{db.dres}, db.rwres...), db.rres...), db.wres...)
+	)
+	db.dynamic.Range(func(key, value any) bool {
+		if c, ok := value.(*Conn); ok {
+			res = append(res, c.rdb)
+		}
+		return true
+	})
+
+	for _, r := range res {
+		if nil == r || closed[r.db] {
+			continue
+		}
+		closed[r.db] = true
+		if e := r.db.Close(); e != nil && nil == err {
+			err = e
+		}
+	}
+	return err
+}
+
 // wrap select, insert, update, delete query
 type selectQuery struct {
+	ctx context.Context
 	res *dbres
 	sql msql.SqlStatement
 }
@@ -313,7 +351,7 @@ func (s selectQuery) Query() *Rows {
 		return &Rows{lerr: s.sql.Err}
 	}
 
-	rows, err := s.res.db.Query(s.sql.Sql, s.sql.Params...)
+	rows, err := s.res.db.QueryContext(s.ctx, s.sql.Sql, s.sql.Params...)
 	return &Rows{rows: rows, lerr: err}
 }
 
@@ -322,11 +360,12 @@ func (s selectQuery) QueryRow() *Row {
 		return &Row{rows: &Rows{lerr: s.sql.Err}}
 	}
 
-	rows, err := s.res.db.Query(s.sql.Sql, s.sql.Params...)
+	rows, err := s.res.db.QueryContext(s.ctx, s.sql.Sql, s.sql.Params...)
 	return &Row{rows: &Rows{rows: rows, lerr: err}}
 }
 
 type modifyQuery struct {
+	ctx context.Context
 	res *dbres
 	sql msql.SqlStatement
 }
@@ -336,18 +375,36 @@ func (m modifyQuery) Exec() (sql.Result, error) {
 		return nil, m.sql.Err
 	}
 
-	return m.res.db.Exec(m.sql.Sql, m.sql.Params...)
+	return m.res.db.ExecContext(m.ctx, m.sql.Sql, m.sql.Params...)
 }
 
 type Conn struct {
 	rdb *dbres
 	wdb *dbres
 	one bool
+	ctx context.Context
+}
+
+// WithContext returns a copy of the Conn, the queries, statements and
+// transactions of the copy are cancelled when ctx is done.
+func (dc *Conn) WithContext(ctx context.Context) *Conn {
+	c := *dc
+	c.ctx = ctx
+	return &c
+}
+
+func (dc *Conn) Context() context.Context {
+	if nil == dc.ctx {
+		return context.Background()
+	}
+	return dc.ctx
 }
 
 func (dc *Conn) Begin() *Tx {
-	tx, err := dc.wdb.db.Begin()
+	ctx := dc.Context()
+	tx, err := dc.wdb.db.BeginTx(ctx, nil)
 	return &Tx{
+		ctx:  ctx,
 		tx:   tx,
 		lerr: err,
 	}
@@ -355,6 +412,7 @@ func (dc *Conn) Begin() *Tx {
 
 func (dc *Conn) Select(sql msql.Select) *selectQuery {
 	return &selectQuery{
+		ctx: dc.Context(),
 		res: dc.rdb,
 		sql: sql.Build(),
 	}
@@ -362,6 +420,7 @@ func (dc *Conn) Select(sql msql.Select) *selectQuery {
 
 func (dc *Conn) Insert(sql msql.Insert) *modifyQuery {
 	return &modifyQuery{
+		ctx: dc.Context(),
 		res: dc.wdb,
 		sql: sql.Build(),
 	}
@@ -369,6 +428,7 @@ func (dc *Conn) Insert(sql msql.Insert) *modifyQuery {
 
 func (dc *Conn) Update(sql msql.Update) *modifyQuery {
 	return &modifyQuery{
+		ctx: dc.Context(),
 		res: dc.wdb,
 		sql: sql.Build(),
 	}
@@ -376,18 +436,19 @@ func (dc *Conn) Update(sql msql.Update) *modifyQuery {
 
 func (dc *Conn) Delete(sql msql.Delete) *modifyQuery {
 	return &modifyQuery{
+		ctx: dc.Context(),
 		res: dc.wdb,
 		sql: sql.Build(),
 	}
 }
 
 func (dc *Conn) Exec(query string, args ...any) (sql.Result, error) {
-	return dc.wdb.db.Exec(query, args...)
+	return dc.wdb.db.ExecContext(dc.Context(), query, args...)
 }
 
 func (dc *Conn) Prepare(query string) *dbStmt {
 	if len(query) < 6 {
-		return &dbStmt{lerr: fmt.Errorf("prepare sql too short '%s'", query)}
+		return &dbStmt{ctx: dc.Context(), lerr: fmt.Errorf("prepare sql too short '%s'", query)}
 	}
 
 	var (
@@ -395,20 +456,20 @@ func (dc *Conn) Prepare(query string) *dbStmt {
 		err  error
 	)
 	if strings.Contains(strings.ToUpper(query[0:6]), "select") {
-		stmt, err = dc.rdb.db.Prepare(query)
+		stmt, err = dc.rdb.db.PrepareContext(dc.Context(), query)
 	} else {
-		stmt, err = dc.wdb.db.Prepare(query)
+		stmt, err = dc.wdb.db.PrepareContext(dc.Context(), query)
 	}
-	return &dbStmt{stmt: stmt, lerr: err}
+	return &dbStmt{ctx: dc.Context(), stmt: stmt, lerr: err}
 }
 
 func (dc *Conn) Query(query string, args ...any) *Rows {
-	rows, err := dc.rdb.db.Query(query, args...)
+	rows, err := dc.rdb.db.QueryContext(dc.Context(), query, args...)
 	return &Rows{rows: rows, lerr: err}
 }
 
 func (dc *Conn) QueryRow(query string, args ...any) *Row {
-	rows, err := dc.rdb.db.Query(query, args...)
+	rows, err := dc.rdb.db.QueryContext(dc.Context(), query, args...)
 	return &Row{rows: &Rows{rows: rows, lerr: err}}
 }
 
@@ -421,6 +482,7 @@ func (dc *Conn) GetDSN() string {
 }
 
 type dbStmt struct {
+	ctx  context.Context
 	stmt *sql.Stmt
 	lerr error
 }
@@ -436,7 +498,7 @@ func (s *dbStmt) Exec(args ...any) (sql.Result, error) {
 	if s.lerr != nil {
 		return nil, s.lerr
 	}
-	return s.stmt.Exec(args...)
+	return s.stmt.ExecContext(s.ctx, args...)
 }
 
 func (s *dbStmt) Query(args ...any) *Rows {
@@ -444,7 +506,7 @@ func (s *dbStmt) Query(args ...any) *Rows {
 		return &Rows{lerr: s.lerr}
 	}
 
-	rows, err := s.stmt.Query(args...)
+	rows, err := s.stmt.QueryContext(s.ctx, args...)
 	return &Rows{rows: rows, lerr: err}
 }
 
@@ -453,7 +515,7 @@ func (s *dbStmt) QueryRow(args ...any) *Row {
 		return &Row{rows: &Rows{lerr: s.lerr}}
 	}
 
-	rows, err := s.stmt.Query(args...)
+	rows, err := s.stmt.QueryContext(s.ctx, args...)
 	return &Row{rows: &Rows{rows: rows, lerr: err}}
 }
 
@@ -746,6 +808,7 @@ func (r *Rows) scanStruct(ote reflect.Type, ove reflect.Value, coltype []*sql.Co
 
 // database transaction wrape *sql.Tx
 type Tx struct {
+	ctx  context.Context
 	tx   *sql.Tx
 	lerr error
 }
@@ -772,20 +835,20 @@ func (dt *Tx) Delete(sql msql.Delete) *txModifyQuery {
 }
 
 func (dt *Tx) Prepare(query string) *dbStmt {
-	stmt, err := dt.tx.Prepare(query)
-	return &dbStmt{stmt: stmt, lerr: err}
+	stmt, err := dt.tx.PrepareContext(dt.ctx, query)
+	return &dbStmt{ctx: dt.ctx, stmt: stmt, lerr: err}
 }
 
 func (dt *Tx) Exec(query string, args ...any) (sql.Result, error) {
-	return dt.tx.Exec(query, args...)
+	return dt.tx.ExecContext(dt.ctx, query, args...)
 }
 
 func (dt *Tx) Query(query string, args ...any) (*sql.Rows, error) {
-	return dt.tx.Query(query, args...)
+	return dt.tx.QueryContext(dt.ctx, query, args...)
 }
 
 func (dt *Tx) QueryRow(query string, args ...any) *sql.Row {
-	return dt.tx.QueryRow(query, args...)
+	return dt.tx.QueryRowContext(dt.ctx, query, args...)
 }
 
 func (dt *Tx) Commit() error {
@@ -812,7 +875,7 @@ func (m txModifyQuery) Exec() (sql.Result, error) {
 		return nil, m.sql.Err
 	}
 
-	return m.tx.tx.Exec(m.sql.Sql, m.sql.Params...)
+	return m.tx.tx.ExecContext(m.tx.ctx, m.sql.Sql, m.sql.Params...)
 }
 
 const (
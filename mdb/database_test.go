@@ -0,0 +1,42 @@
+package mdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestConnWithContext(t *testing.T) {
+	// nothing listens on port 1, a query that got to the server would fail
+	// with another error than the one of the context.
+	db, err := Open([]*DBConfig{{Driver: "mysql", Host: "127.0.0.1", Port: 1, User: "wgo", Dbname: "wgo"}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	conn, err := db.GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if context.Background() != conn.Context() {
+		t.Fatal("a Conn without context has no background context")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var c = conn.WithContext(ctx)
+	if ctx != c.Context() || context.Background() != conn.Context() {
+		t.Fatal("WithContext changed the Conn instead of a copy")
+	}
+
+	for name, fn := range map[string]func() error{
+		"exec":    func() error { _, e := c.Exec("DELETE FROM t"); return e },
+		"query":   func() error { return c.Query("SELECT 1").lerr },
+		"prepare": func() error { return c.Prepare("SELECT 1").lerr },
+		"begin":   func() error { return c.Begin().lerr },
+	} {
+		if err := fn(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s = %v, want context.Canceled", name, err)
+		}
+	}
+}
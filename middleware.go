@@ -0,0 +1,52 @@
+package wgo
+
+import "sync"
+
+// HandlerFunc handles one request, a Middleware wraps the next HandlerFunc and
+// decides itself when, or whether, to call it.
+//
+//	func Timing(next wgo.HandlerFunc) wgo.HandlerFunc {
+//		return func(w *wgo.HttpResponse, r *wgo.HttpRequest) {
+//			start := time.Now()
+//			next(w, r)
+//			log.Printf("%s %s %s", r.GetMethod(), r.GetRequestURI(), time.Since(start))
+//		}
+//	}
+//
+// a middleware can replace w.Writer before calling next to change the response
+// written by the action.
+type HandlerFunc func(w *HttpResponse, r *HttpRequest)
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// chainMiddlewares wraps h so that middlewares[0] is the outermost one.
+func chainMiddlewares(middlewares []Middleware, h HandlerFunc) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// building is the route whose middlewares are being chained, nil for the
+// global ones.
+var building struct {
+	sync.Mutex
+	route *Router
+}
+
+// chainRoute chains the middlewares of a route, they may declare on it what
+// has to be checked before any of them runs.
+func chainRoute(route *Router, middlewares []Middleware, h HandlerFunc) HandlerFunc {
+	building.Lock()
+	defer building.Unlock()
+	building.route = route
+	defer func() { building.route = nil }()
+	return chainMiddlewares(middlewares, h)
+}
+
+// declareRoute calls fn with the route a middleware wraps, when it is called
+// by the middleware while it is chained for a route.
+func declareRoute(fn func(route *Router)) {
+	if nil != building.route {
+		fn(building.route)
+	}
+}
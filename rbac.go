@@ -0,0 +1,309 @@
+package wgo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaocairen/wgo/config"
+	"github.com/xiaocairen/wgo/service"
+)
+
+// rbacConfig is the "rbac" section of app.json, reload is seconds
+//
+//	"rbac": {
+//	  "roles": {
+//	    "admin": ["*"],
+//	    "editor": ["orders:read", "orders:write"],
+//	    "viewer": ["orders:read"]
+//	  },
+//	  "store": "mysql",
+//	  "table": "wgo_role_permission",
+//	  "db": "",
+//	  "reload": 300
+//	}
+//
+// store is "config" by default, the roles are the ones of the section. with
+// "mysql" the rows of table are added to them, they are read from db, the
+// default database when empty, at start and then every reload seconds when it
+// is not 0. see LoadPolicy for the table.
+type rbacConfig struct {
+	Roles  map[string][]string `json:"roles"`
+	Store  string              `json:"store"`
+	Table  string              `json:"table"`
+	DB     string              `json:"db"`
+	Reload int                 `json:"reload"`
+}
+
+// Policy maps the roles to the permissions they grant. a permission "*"
+// grants all of them, "orders:*" the ones starting with "orders:".
+type Policy struct {
+	mu    sync.RWMutex
+	roles map[string][]string
+}
+
+func NewPolicy(roles map[string][]string) *Policy {
+	var p = &Policy{}
+	p.Set(roles)
+	return p
+}
+
+// Set replaces the roles of the policy.
+func (p *Policy) Set(roles map[string][]string) {
+	var m = make(map[string][]string, len(roles))
+	for role, perms := range roles {
+		m[role] = append([]string(nil), perms...)
+	}
+	p.mu.Lock()
+	p.roles = m
+	p.mu.Unlock()
+}
+
+// Roles returns a copy of the roles of the policy.
+func (p *Policy) Roles() map[string][]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var m = make(map[string][]string, len(p.roles))
+	for role, perms := range p.roles {
+		m[role] = append([]string(nil), perms...)
+	}
+	return m
+}
+
+// Permissions returns the permissions granted by the roles.
+func (p *Policy) Permissions(roles ...string) []string {
+	if nil == p {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var perms []string
+	for _, role := range roles {
+		for _, perm := range p.roles[role] {
+			if !contains(perms, perm) {
+				perms = append(perms, perm)
+			}
+		}
+	}
+	return perms
+}
+
+// Allows reports whether the roles of the principal grant all the perms.
+func (p *Policy) Allows(pr *Principal, perms ...string) bool {
+	if nil == p || nil == pr {
+		return false
+	}
+	return grants(p.Permissions(pr.Roles...), perms)
+}
+
+func grants(granted, perms []string) bool {
+	for _, perm := range perms {
+		var ok bool
+		for _, g := range granted {
+			if g == perm || "*" == g || (strings.HasSuffix(g, ":*") && strings.HasPrefix(perm, g[:len(g)-1])) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadPolicy reads the roles of a mysql table, one row for each permission of
+// a role
+//
+//	CREATE TABLE wgo_role_permission (
+//	  role VARCHAR(64) NOT NULL,
+//	  permission VARCHAR(128) NOT NULL,
+//	  PRIMARY KEY (role, permission)
+//	) ENGINE=InnoDB;
+func LoadPolicy(ctx context.Context, svc *service.Service, table string) (map[string][]string, error) {
+	if !tableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid rbac table name '%s'", table)
+	}
+	if e := svc.Err(); e != nil {
+		return nil, e
+	}
+	var rows = svc.Conn().WithContext(ctx).Query("SELECT role, permission FROM `" + strings.ReplaceAll(table, ".", "`.`") + "`")
+	defer rows.Close()
+
+	var roles = make(map[string][]string)
+	for rows.Next() {
+		var role, perm string
+		if e := rows.Scan(&role, &perm); e != nil {
+			return nil, e
+		}
+		roles[role] = append(roles[role], perm)
+	}
+	if e := rows.Err(); e != nil {
+		return nil, e
+	}
+	return roles, nil
+}
+
+// SetPolicy sets the policy of the Permissions of the routes, it replaces the
+// one of the rbac section.
+func (this *app) SetPolicy(p *Policy) *app {
+	if nil == this.policy {
+		this.policy = p
+	}
+	return this
+}
+
+func (this *app) newPolicy() *Policy {
+	if nil != this.policy {
+		return this.policy
+	}
+	if _, err := this.configurator.Get("rbac"); err != nil {
+		return nil
+	}
+	var c rbacConfig
+	if err := this.configurator.GetStruct("rbac", &c); err != nil {
+		panic(err)
+	}
+
+	var p = NewPolicy(c.Roles)
+	switch c.Store {
+	case "", "config":
+	case "mysql":
+		if "" == c.Table {
+			c.Table = "wgo_role_permission"
+		}
+		var load = func(ctx context.Context, svc *service.Service) error {
+			if "" != c.DB {
+				svc = svc.NewServiceByHostname(c.DB)
+			}
+			roles, e := LoadPolicy(ctx, svc, c.Table)
+			if e != nil {
+				return e
+			}
+			for role, perms := range c.Roles {
+				roles[role] = append(roles[role], perms...)
+			}
+			p.Set(roles)
+			return nil
+		}
+		if e := load(context.Background(), this.servicer.New()); e != nil {
+			log.Panicf("load rbac table '%s': %s", c.Table, e)
+		}
+		if c.Reload > 0 {
+			this.AddContextTasker(func(ctx context.Context, _ *config.Configurator, svc *service.Service) {
+				var t = time.NewTicker(time.Duration(c.Reload) * time.Second)
+				defer t.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-t.C:
+						if e := load(ctx, svc); e != nil && nil == ctx.Err() {
+							this.logger.Printf("reload rbac table '%s': %s", c.Table, e)
+						}
+					}
+				}
+			})
+		}
+	default:
+		log.Panicf("unknown rbac store '%s'", c.Store)
+	}
+	return p
+}
+
+// checkPolicy makes sure the routes with Permissions have a policy to be
+// checked by.
+func (this *app) checkPolicy() {
+	if nil != this.policy {
+		return
+	}
+	this.router.RouteRegister.each(func(method, subdomain string, r *Router) {
+		if len(r.Permissions) > 0 {
+			log.Panicf("route %s %s requires permissions, set the rbac section or SetPolicy", method, r.Path)
+		}
+	})
+}
+
+// Can reports whether the principal of the request has all the perms.
+func (this *WgoController) Can(perms ...string) bool {
+	return this.Request.policy.Allows(this.Request.Principal(), perms...)
+}
+
+// AccessRule is a row of the access matrix. GrantedTo are the roles of the
+// policy that pass the Roles and Permissions of the route. the Scopes are
+// given by the credentials, not the roles, a role in GrantedTo still needs
+// them and a route requiring only Scopes has no GrantedTo.
+type AccessRule struct {
+	Method      string   `json:"method"`
+	Subdomain   string   `json:"subdomain"`
+	Path        string   `json:"path"`
+	Controller  string   `json:"controller"`
+	Action      string   `json:"action"`
+	Public      bool     `json:"public"`
+	Roles       []string `json:"roles,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	GrantedTo   []string `json:"granted_to,omitempty"`
+}
+
+// AccessMatrix lists what every route requires, sorted by path.
+func (this *WgoController) AccessMatrix() []AccessRule {
+	var (
+		policy = this.Request.policy
+		roles  map[string][]string
+		rules  []AccessRule
+	)
+	if nil != policy {
+		roles = policy.Roles()
+	}
+	this.Router.register.each(func(method, subdomain string, r *Router) {
+		var rule = AccessRule{
+			Method:      method,
+			Subdomain:   subdomain,
+			Path:        r.Path,
+			Controller:  r.ControllerName,
+			Action:      r.Method.Name,
+			Public:      0 == len(r.Roles) && 0 == len(r.Scopes) && 0 == len(r.Permissions),
+			Roles:       r.Roles,
+			Scopes:      r.Scopes,
+			Permissions: r.Permissions,
+		}
+		if len(r.Roles) > 0 || len(r.Permissions) > 0 {
+			for role, perms := range roles {
+				if (0 == len(r.Roles) || contains(r.Roles, role)) && grants(perms, r.Permissions) {
+					rule.GrantedTo = append(rule.GrantedTo, role)
+				}
+			}
+			for _, role := range r.Roles {
+				if _, ok := roles[role]; !ok && 0 == len(r.Permissions) {
+					rule.GrantedTo = append(rule.GrantedTo, role)
+				}
+			}
+			sort.Strings(rule.GrantedTo)
+		}
+		rules = append(rules, rule)
+	})
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Path != rules[j].Path {
+			return rules[i].Path < rules[j].Path
+		}
+		return rules[i].Method < rules[j].Method
+	})
+	return rules
+}
+
+// AccessController serves the access matrix of the routes for a security
+// review, it should be registered with a permission of its own
+//
+//	um.Get(wgo.RouteUnit{Path: "/_access", Controller: &wgo.AccessController{}, Action: "Matrix()", Permissions: []string{"rbac:inspect"}})
+type AccessController struct {
+	WgoController
+}
+
+func (this *AccessController) Matrix() []byte {
+	return this.Render(this.AccessMatrix())
+}
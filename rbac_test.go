@@ -0,0 +1,67 @@
+package wgo
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/xiaocairen/wgo/mdb"
+	"github.com/xiaocairen/wgo/service"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	var policy = NewPolicy(map[string][]string{
+		"admin":  {"*"},
+		"editor": {"orders:*", "users:read"},
+		"viewer": {"orders:read"},
+	})
+	for _, c := range []struct {
+		name  string
+		roles []string
+		perms []string
+		want  bool
+	}{
+		{"exact", []string{"viewer"}, []string{"orders:read"}, true},
+		{"not granted", []string{"viewer"}, []string{"orders:write"}, false},
+		{"prefix", []string{"editor"}, []string{"orders:write", "orders:refund"}, true},
+		{"prefix of another resource", []string{"editor"}, []string{"ordersx:write"}, false},
+		{"all of them", []string{"editor"}, []string{"orders:write", "users:write"}, false},
+		{"from any role", []string{"viewer", "editor"}, []string{"orders:read", "users:read"}, true},
+		{"everything", []string{"admin"}, []string{"users:delete"}, true},
+		{"unknown role", []string{"guest"}, []string{"orders:read"}, false},
+		{"nothing asked", []string{"guest"}, nil, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if got := policy.Allows(&Principal{Roles: c.roles}, c.perms...); c.want != got {
+				t.Fatalf("Allows = %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	if policy.Allows(nil, "orders:read") || (*Policy)(nil).Allows(&Principal{Roles: []string{"admin"}}) {
+		t.Fatal("allowed without principal or policy")
+	}
+	if got := strings.Join(policy.Permissions("viewer", "editor"), " "); "orders:read orders:* users:read" != got {
+		t.Fatalf("Permissions = %q", got)
+	}
+
+	policy.Roles()["viewer"][0] = "changed"
+	if !policy.Allows(&Principal{Roles: []string{"viewer"}}, "orders:read") {
+		t.Fatal("the roles of the policy were changed through Roles")
+	}
+	policy.Set(map[string][]string{"viewer": {"users:read"}})
+	if !policy.Allows(&Principal{Roles: []string{"viewer"}}, "users:read") || policy.Allows(&Principal{Roles: []string{"admin"}}, "users:read") {
+		t.Fatalf("roles after Set = %v", policy.Roles())
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	db, _ := mdb.Open(nil, false)
+	var svc = service.Open(db).New()
+	if _, e := LoadPolicy(context.Background(), svc, "roles; DROP TABLE x"); nil == e || !strings.Contains(e.Error(), "invalid rbac table name") {
+		t.Fatalf("bad table name = %v", e)
+	}
+	if _, e := LoadPolicy(context.Background(), svc, "wgo_role_permission"); nil == e {
+		t.Fatal("loaded without a database")
+	}
+}
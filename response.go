@@ -0,0 +1,161 @@
+package wgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// File is returned by an action to serve a file with http.ServeContent, which
+// answers Range, If-Modified-Since and If-None-Match requests.
+//
+// Content is served when it is not nil, else the file at Path. Name is the
+// file name sent in Content-Disposition and gives the Content-Type, the base
+// of Path by default. ETag is made of the size and modification time of the
+// file at Path when it is empty.
+type File struct {
+	Path       string
+	Content    io.ReadSeeker
+	Name       string
+	ModTime    time.Time
+	ETag       string
+	Attachment bool
+}
+
+// Stream is returned by an action to write the response as it goes, like a
+// large export. the write deadline of the server doesn't apply to it, it
+// should stop when the context of the writer is done, the client has gone
+// away.
+type Stream func(w *StreamWriter) error
+
+// StreamWriter is the writer of a Stream.
+type StreamWriter struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	ctx context.Context
+}
+
+func (s *StreamWriter) Write(p []byte) (int, error) {
+	if e := s.ctx.Err(); e != nil {
+		return 0, e
+	}
+	return s.w.Write(p)
+}
+
+// Flush sends what has been written to the client.
+func (s *StreamWriter) Flush() error {
+	return s.rc.Flush()
+}
+
+// Context is done when the client goes away or the request deadline is over.
+func (s *StreamWriter) Context() context.Context {
+	return s.ctx
+}
+
+var (
+	readerType  = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	fileType    = reflect.TypeOf(File{})
+	filePtrType = reflect.TypeOf(&File{})
+	streamType  = reflect.TypeOf(Stream(nil))
+	eventsType  = reflect.TypeOf(EventStream(nil))
+	wsType      = reflect.TypeOf(WebSocket(nil))
+)
+
+// isStreamedReturn reports whether an action return type is sent by stream.
+func isStreamedReturn(t reflect.Type) bool {
+	return t == fileType || t == filePtrType || t == streamType || t == eventsType || t == wsType || t.Implements(readerType)
+}
+
+// stream sends an action return that isn't buffered.
+func (this *server) stream(res *HttpResponse, req *HttpRequest, ret any) {
+	switch v := ret.(type) {
+	case File:
+		this.serveFile(res, req, &v)
+	case *File:
+		this.serveFile(res, req, v)
+	case Stream:
+		var sw = &StreamWriter{w: res.Writer, rc: http.NewResponseController(res.Writer), ctx: req.Context()}
+		sw.rc.SetWriteDeadline(time.Time{})
+		if e := v(sw); e != nil {
+			if res.Written() {
+				logf(req.logger, "stream of %s stopped: %s", req.GetRequestPath(), e)
+			} else {
+				writeError(res, req, http.StatusInternalServerError, e.Error())
+			}
+		}
+	case EventStream:
+		if e := v(res.sse(req)); e != nil && e != ErrSSEClosed {
+			logf(req.logger, "event stream of %s stopped: %s", req.GetRequestPath(), e)
+		}
+	case WebSocket:
+		if c, e := res.websocket(req); nil == e {
+			c.serve(v)
+		}
+	case io.Reader:
+		if c, ok := v.(io.Closer); ok {
+			defer c.Close()
+		}
+		if _, e := io.Copy(res.Writer, v); e != nil {
+			logf(req.logger, "copy response of %s: %s", req.GetRequestPath(), e)
+		}
+	}
+}
+
+func (this *server) serveFile(res *HttpResponse, req *HttpRequest, f *File) {
+	var (
+		name    = f.Name
+		modTime = f.ModTime
+		content = f.Content
+	)
+	if nil == content {
+		file, e := os.Open(f.Path)
+		if e != nil {
+			if os.IsNotExist(e) {
+				writeError(res, req, http.StatusNotFound, "file not found")
+				return
+			}
+			log.Panic(e)
+		}
+		defer file.Close()
+
+		fi, e := file.Stat()
+		if e != nil {
+			log.Panic(e)
+		}
+		if fi.IsDir() {
+			writeError(res, req, http.StatusNotFound, "file not found")
+			return
+		}
+		if modTime.IsZero() {
+			modTime = fi.ModTime()
+		}
+		if "" == f.ETag {
+			res.SetHeader("ETag", fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()))
+		}
+		if "" == name {
+			name = filepath.Base(f.Path)
+		}
+		content = file
+	} else if c, ok := content.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	if "" != f.ETag {
+		res.SetHeader("ETag", f.ETag)
+	}
+	if "" != name {
+		var disposition = "inline"
+		if f.Attachment {
+			disposition = "attachment"
+		}
+		res.SetHeader("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	}
+	http.ServeContent(res.Writer, req.Request, name, modTime, content)
+}
@@ -0,0 +1,25 @@
+package reuse
+
+import (
+	"syscall"
+)
+
+func init() {
+	Enabled = true
+}
+
+// See net.RawConn.Control
+func Control(network, address string, c syscall.RawConn) (err error) {
+	e := c.Control(func(fd uintptr) {
+		// SO_REUSEADDR
+		if err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+			return
+		}
+		// SO_REUSEPORT
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if e != nil {
+		return e
+	}
+	return
+}
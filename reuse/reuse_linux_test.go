@@ -0,0 +1,38 @@
+package reuse
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	a, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, opt := range []int{syscall.SO_REUSEADDR, soReusePort} {
+		f, err := a.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := syscall.GetsockoptInt(int(f.Fd()), syscall.SOL_SOCKET, opt)
+		f.Close()
+		if err != nil || 1 != v {
+			t.Fatalf("option %#x = %d %v", opt, v, err)
+		}
+	}
+
+	b, err := Listen("tcp", a.Addr().String())
+	if err != nil {
+		t.Fatalf("second listener on %s: %v", a.Addr(), err)
+	}
+	defer b.Close()
+
+	if c, err := net.Listen("tcp", a.Addr().String()); nil == err {
+		c.Close()
+		t.Fatal("a listener without SO_REUSEPORT shared the port")
+	}
+}
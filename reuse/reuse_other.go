@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package reuse
+
+import (
+	"syscall"
+)
+
+// See net.RawConn.Control
+func Control(network, address string, c syscall.RawConn) (err error) {
+	return
+}
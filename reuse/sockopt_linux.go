@@ -0,0 +1,6 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package reuse
+
+// syscall does not define SO_REUSEPORT for every linux arch
+const soReusePort = 0xf
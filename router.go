@@ -4,9 +4,9 @@ import (
 	"fmt"
 	"github.com/xiaocairen/wgo/service"
 	"log"
+	"net"
 	"net/http"
 	"reflect"
-	"regexp"
 	"strings"
 )
 
@@ -18,6 +18,16 @@ func (nf RouteNotFoundError) Error() string {
 	return fmt.Sprintf("not found route of path '%s'", nf.path)
 }
 
+type MethodNotAllowedError struct {
+	method string
+	path   string
+	Allow  []string
+}
+
+func (na MethodNotAllowedError) Error() string {
+	return fmt.Sprintf("method '%s' not allowed on path '%s'", na.method, na.path)
+}
+
 type RouteCollection func(register *RouteRegister)
 
 func (fn RouteCollection) call(register *RouteRegister) {
@@ -30,247 +40,139 @@ func (fn RouteCollection) call(register *RouteRegister) {
 type router struct {
 	RouteRegister   *RouteRegister
 	RouteCollection RouteCollection
+	trees           map[string][]*routeTree
 }
 
-func (this *router) init(chain []RouteControllerInjector) {
+// init registers the routes and wraps action with the middlewares of each one.
+func (this *router) init(chain []RouteControllerInjector, action HandlerFunc) {
 	this.RouteRegister = &RouteRegister{injectChain: chain}
 	this.RouteCollection.call(this.RouteRegister)
+	this.RouteRegister.each(func(method, subdomain string, r *Router) {
+		r.handler = chainRoute(r, r.middlewares, action)
+	})
+	this.buildTrees()
 }
 
+func (this *router) buildTrees() {
+	this.trees = map[string][]*routeTree{}
+	for method, rns := range this.RouteRegister.namespaces {
+		for _, ns := range rns {
+			this.trees[method] = append(this.trees[method], newRouteTree(ns))
+		}
+	}
+}
+
+// getHandler finds the route of the request. HEAD is served by the GET route
+// when it has no route of its own, GET, HEAD and POST fall back to ANY routes.
+// a path that is registered for other methods only gives a MethodNotAllowedError.
 func (this *router) getHandler(r *http.Request) (Router, []methodParam, error) {
+	var methods []string
 	switch r.Method {
-	case GET:
-		route, params, err := this.searchRoute(this.RouteRegister.get, r)
-		if nil == err {
-			return *route, params, nil
-		}
+	case HEAD:
+		// net/http drops the body written for a HEAD request, so HEAD served
+		// by the GET route only sends the headers.
+		methods = []string{HEAD, GET, ANY}
+	case GET, POST:
+		methods = []string{r.Method, ANY}
+	default:
+		methods = []string{r.Method}
+	}
 
-		route, params, err = this.searchRoute(this.RouteRegister.any, r)
-		if nil == err {
-			return *route, params, nil
-		} else {
-			return Router{}, nil, err
-		}
-	case POST:
-		route, params, err := this.searchRoute(this.RouteRegister.post, r)
-		if nil == err {
+	for _, method := range methods {
+		if route, params, err := this.searchRoute(this.trees[method], r); nil == err {
 			return *route, params, nil
 		}
+	}
 
-		route, params, err = this.searchRoute(this.RouteRegister.any, r)
-		if nil == err {
-			return *route, params, nil
-		} else {
-			return Router{}, nil, err
-		}
-	case PUT:
-		route, params, err := this.searchRoute(this.RouteRegister.put, r)
-		if nil == err {
-			return *route, params, nil
-		} else {
-			return Router{}, nil, err
+	if allow := this.allowedMethods(r); len(allow) > 0 {
+		return Router{}, nil, MethodNotAllowedError{method: r.Method, path: r.URL.Path, Allow: allow}
+	}
+	return Router{}, nil, RouteNotFoundError{path: r.Host + r.RequestURI}
+}
+
+// allowedMethods lists the methods that have a route matching the request path,
+// OPTIONS is always included when there is any.
+func (this *router) allowedMethods(r *http.Request) []string {
+	var found = make(map[string]bool)
+	for _, method := range allMethods {
+		if _, _, err := this.searchRoute(this.trees[method], r); nil == err {
+			found[method] = true
 		}
-	case DELETE:
-		route, params, err := this.searchRoute(this.RouteRegister.delete, r)
-		if nil == err {
-			return *route, params, nil
-		} else {
-			return Router{}, nil, err
+	}
+	if found[ANY] {
+		found[GET] = true
+		found[POST] = true
+	}
+	if found[GET] {
+		found[HEAD] = true
+	}
+
+	var allow []string
+	for _, method := range allMethods {
+		if found[method] && ANY != method {
+			allow = append(allow, method)
 		}
-	default:
-		return Router{}, nil, fmt.Errorf("not support http method '%s'", r.Method)
 	}
+	if len(allow) > 0 && !found[OPTIONS] {
+		allow = append(allow, OPTIONS)
+	}
+	return allow
 }
 
-func (this *router) searchRoute(routes []*routeNamespace, req *http.Request) (route *Router, params []methodParam, err error) {
-	if 0 == len(routes) {
-		err = RouteNotFoundError{path: req.RequestURI}
-		return
+func (this *router) searchRoute(trees []*routeTree, req *http.Request) (*Router, []methodParam, error) {
+	if 0 == len(trees) {
+		return nil, nil, RouteNotFoundError{path: req.RequestURI}
 	}
 
-	var (
-		urlpathlen          = len(req.URL.Path)
-		domain, isIpOrLocal = this.parseHost(req)
-	)
+	var domain, isIpOrLocal = this.parseHost(req)
 	if isIpOrLocal {
-		for _, rns := range routes {
-			route, params, err = this.findRouter(rns, req, urlpathlen)
-			if nil == err && nil != route {
-				return
+		for _, t := range trees {
+			if route, values := t.lookup(req.URL.Path); nil != route {
+				return route, route.buildParams(values), nil
 			}
 		}
-	} else {
-		var (
-			routeIt *routeNamespace
-			routeSp *routeNamespace
-		)
-
-		for _, rns := range routes {
-			if strings.Contains(domain, rns.subdomain+".") {
-				routeIt = rns
-				break
-			} else if rns.subdomain == "*" {
-				routeSp = rns
-			}
-		}
-		if nil == routeIt {
-			if nil == routeSp {
-				err = RouteNotFoundError{path: req.Host + req.RequestURI}
-				return
-			}
-			routeIt = routeSp
-		}
-
-		route, params, err = this.findRouter(routeIt, req, urlpathlen)
+		return nil, nil, RouteNotFoundError{path: req.Host + req.RequestURI}
 	}
-	return
-}
 
-func (this *router) findRouter(rns *routeNamespace, req *http.Request, urlpathlen int) (*Router, []methodParam, error) {
 	var (
-		routerThe *Router
-		routerAll *Router
-		params    []methodParam
-		routelist = make([]*Router, 0)
-		paramlist = make([][]string, 0)
+		treeIt *routeTree
+		treeSp *routeTree
 	)
-	for key, route := range rns.routers {
-		if route.Path == req.URL.Path {
-			routerThe = route
-			for _, mp := range route.MethodParams {
-				params = append(params, methodParam{
-					Name:        mp.Name,
-					Type:        mp.Type,
-					ParamKind:   mp.ParamKind,
-					ParamType:   mp.ParamType,
-					IsStruct:    mp.IsStruct,
-					Value:       nil,
-					StructValue: mp.StructValue,
-				})
-			}
-			return routerThe, params, nil
-		}
-
-		if route.Path == "/*" {
-			routerAll = route
-			continue
-		}
-
-		if route.PathIsRegexp {
-			if route.PathRegexp.MatchString(req.URL.Path) {
-				values := route.PathRegexp.FindStringSubmatch(req.URL.Path)
-				paramlist = append(paramlist, values[1:])
-				routelist = append(routelist, rns.routers[key])
-			}
-			continue
+	for _, t := range trees {
+		if strings.Contains(domain, t.subdomain+".") {
+			treeIt = t
+			break
+		} else if t.subdomain == "*" {
+			treeSp = t
 		}
-
-		if urlpathlen < route.Pathlen || route.Path != req.URL.Path[0:route.Pathlen] ||
-			(urlpathlen > route.Pathlen && '/' != req.URL.Path[route.Pathlen]) ||
-			(route.Pathlen > 1 && '/' != req.URL.Path[route.Pathlen]) {
-			continue
-		}
-
-		paramlist = append(paramlist, nil)
-		routelist = append(routelist, rns.routers[key])
 	}
-
-	var parameters []string
-	switch len(routelist) {
-	case 0:
-		if nil == routerAll {
+	if nil == treeIt {
+		if nil == treeSp {
 			return nil, nil, RouteNotFoundError{path: req.Host + req.RequestURI}
-		} else {
-			routerThe = routerAll
-		}
-	case 1:
-		routerThe = routelist[0]
-		parameters = paramlist[0]
-	default:
-		routerThe = routelist[0]
-		parameters = paramlist[0]
-		for k, r := range routelist {
-			if r.Pathlen > routerThe.Pathlen {
-				routerThe = r
-				parameters = paramlist[k]
-			}
 		}
+		treeIt = treeSp
 	}
 
-	if nil != parameters {
-		for _, mp := range routerThe.MethodParams {
-			var found = false
-			for k, pp := range routerThe.PathParams {
-				if mp.Name == pp {
-					found = true
-					params = append(params, methodParam{
-						Name:      mp.Name,
-						Type:      mp.Type,
-						ParamKind: mp.ParamKind,
-						ParamType: mp.ParamType,
-						IsStruct:  mp.IsStruct,
-						Value:     convertParam2Value(parameters[k], mp.Type),
-					})
-
-					break
-				}
-			}
-
-			if !found {
-				params = append(params, methodParam{
-					Name:        mp.Name,
-					Type:        mp.Type,
-					ParamKind:   mp.ParamKind,
-					ParamType:   mp.ParamType,
-					IsStruct:    mp.IsStruct,
-					Value:       nil,
-					StructValue: mp.StructValue,
-				})
-			}
-		}
-	} else {
-		for _, mp := range routerThe.MethodParams {
-			params = append(params, methodParam{
-				Name:        mp.Name,
-				Type:        mp.Type,
-				ParamKind:   mp.ParamKind,
-				ParamType:   mp.ParamType,
-				IsStruct:    mp.IsStruct,
-				Value:       nil,
-				StructValue: mp.StructValue,
-			})
-		}
+	route, values := treeIt.lookup(req.URL.Path)
+	if nil == route {
+		return nil, nil, RouteNotFoundError{path: req.Host + req.RequestURI}
 	}
-
-	return routerThe, params, nil
+	return route, route.buildParams(values), nil
 }
 
 func (this *router) parseHost(r *http.Request) (string, bool) {
-	reg := regexp.MustCompile(`^(?i:\d+\.\d+\.\d+\.\d+|localhost)(:\d+)?$`)
-	if reg.MatchString(r.Host) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); nil == err {
+		host = h
+	}
+	if "localhost" == host || nil != net.ParseIP(strings.Trim(host, "[]")) {
 		return "www.wgo.cn", true
 	}
 	return r.Host, false
 }
 
 func (this *router) getRouter(method string, controller string, action string) (Router, error) {
-	var rns []*routeNamespace
-	switch strings.ToUpper(method) {
-	case GET:
-		rns = this.RouteRegister.get
-	case POST:
-		rns = this.RouteRegister.post
-	case PUT:
-		rns = this.RouteRegister.put
-	case DELETE:
-		rns = this.RouteRegister.delete
-	case "ANY":
-		rns = this.RouteRegister.any
-	default:
-		return Router{}, fmt.Errorf("no router %s to %s:%s", method, controller, action)
-	}
-
-	for _, rn := range rns {
+	for _, rn := range this.RouteRegister.namespaces[strings.ToUpper(method)] {
 		for _, r := range rn.routers {
 			if r.ControllerName == controller && r.Method.Name == action {
 				return *r, nil
@@ -288,6 +190,9 @@ type methodParam struct {
 	IsStruct    bool
 	Value       any
 	StructValue reflect.Value
+	path        string
+	inPath      bool
+	pathValues  map[string]string
 }
 
 // --------------------------------------------------------------------------------
@@ -296,8 +201,6 @@ type methodParam struct {
 type Router struct {
 	Path           string
 	Pathlen        int
-	PathIsRegexp   bool
-	PathRegexp     *regexp.Regexp
 	PathParams     []string
 	pathParamsNum  int
 	Controller     any
@@ -305,28 +208,64 @@ type Router struct {
 	Method         reflect.Method
 	MethodParams   []methodParam
 	HasInit        bool
+	Roles          []string
+	Scopes         []string
+	Permissions    []string
 	interceptor    RouteInterceptor
+	middlewares    []Middleware
+	handler        HandlerFunc
+	csrf           *CSRFOptions
+	csrfExempt     bool
+	maxBody        int64
+	hasMaxBody     bool
 	register       *RouteRegister
 }
 
-func (r Router) GetRouter(method string, controller string, action string) *Router {
-	var rns []*routeNamespace
-	switch strings.ToUpper(method) {
-	case GET:
-		rns = r.register.get
-	case POST:
-		rns = r.register.post
-	case PUT:
-		rns = r.register.put
-	case DELETE:
-		rns = r.register.delete
-	case "ANY":
-		rns = r.register.any
-	default:
-		return nil
+// buildParams copies the method params of the route, the ones named by a path
+// param keep the matched path segment, it is bound with the request. struct
+// params get all the path params for their fields with a path tag.
+func (r *Router) buildParams(values []string) []methodParam {
+	var (
+		params     = make([]methodParam, 0, len(r.MethodParams))
+		pathValues map[string]string
+	)
+	for _, mp := range r.MethodParams {
+		if mp.IsStruct {
+			pathValues = make(map[string]string, len(values))
+			for k, pp := range r.PathParams {
+				if k < len(values) {
+					pathValues[pp] = values[k]
+				}
+			}
+			break
+		}
 	}
+	for _, mp := range r.MethodParams {
+		var p = methodParam{
+			Name:        mp.Name,
+			Type:        mp.Type,
+			ParamKind:   mp.ParamKind,
+			ParamType:   mp.ParamType,
+			IsStruct:    mp.IsStruct,
+			Value:       nil,
+			StructValue: mp.StructValue,
+			pathValues:  pathValues,
+		}
+		for k, pp := range r.PathParams {
+			if mp.Name == pp && k < len(values) {
+				p.path = values[k]
+				p.inPath = true
+				p.StructValue = reflect.Value{}
+				break
+			}
+		}
+		params = append(params, p)
+	}
+	return params
+}
 
-	for _, rn := range rns {
+func (r Router) GetRouter(method string, controller string, action string) *Router {
+	for _, rn := range r.register.namespaces[strings.ToUpper(method)] {
 		for _, route := range rn.routers {
 			if route.ControllerName == controller && route.Method.Name == action {
 				return route
@@ -346,17 +285,48 @@ type routeNamespace struct {
 
 type RouteRegister struct {
 	domains     []string
-	get         []*routeNamespace
-	post        []*routeNamespace
-	put         []*routeNamespace
-	delete      []*routeNamespace
-	any         []*routeNamespace
+	namespaces  map[string][]*routeNamespace
 	injectChain []RouteControllerInjector
 }
 
-func (this *RouteRegister) Registe(subdomain, namespace string, interceptor RouteInterceptor, fn func(um UnitHttpMethod, m HttpMethod)) {
-	sd := strings.TrimSpace(subdomain)
-	ns := strings.TrimLeft(strings.TrimSpace(namespace), "/")
+func (this *RouteRegister) each(fn func(method, subdomain string, r *Router)) {
+	for _, method := range allMethods {
+		for _, rns := range this.namespaces[method] {
+			for _, r := range rns.routers {
+				fn(method, rns.subdomain, r)
+			}
+		}
+	}
+}
+
+// Registe registers the routes of a namespace, the middlewares wrap every route
+// of the namespace, inside the global ones and outside the ones of RouteUnit.
+func (this *RouteRegister) Registe(subdomain, namespace string, interceptor RouteInterceptor, fn func(um UnitHttpMethod, m HttpMethod), middlewares ...Middleware) {
+	this.RegisteUnit(NamespaceUnit{
+		Subdomain:   subdomain,
+		Namespace:   namespace,
+		Interceptor: interceptor,
+		Middlewares: middlewares,
+	}, fn)
+}
+
+// NamespaceUnit is a namespace of Registe, the routes of which require one of
+// the Roles, all the Scopes and all the Permissions, unless a RouteUnit sets
+// its own.
+type NamespaceUnit struct {
+	Subdomain   string
+	Namespace   string
+	Interceptor RouteInterceptor
+	Middlewares []Middleware
+	Roles       []string
+	Scopes      []string
+	Permissions []string
+}
+
+// RegisteUnit registers the routes of a namespace like Registe.
+func (this *RouteRegister) RegisteUnit(unit NamespaceUnit, fn func(um UnitHttpMethod, m HttpMethod)) {
+	sd := strings.TrimSpace(unit.Subdomain)
+	ns := strings.TrimLeft(strings.TrimSpace(unit.Namespace), "/")
 	if 0 == len(sd) {
 		sd = "www"
 	}
@@ -368,16 +338,28 @@ func (this *RouteRegister) Registe(subdomain, namespace string, interceptor Rout
 	uhm := routeUnitHttpMethod{
 		sd:          sd,
 		ns:          ns,
-		interceptor: interceptor,
+		interceptor: unit.Interceptor,
+		middlewares: unit.Middlewares,
+		roles:       unit.Roles,
+		scopes:      unit.Scopes,
+		permissions: unit.Permissions,
 		register:    this,
 	}
 	fn(uhm, routeHttpMethod{uhm: uhm})
 }
 
+// RouteUnit is a route, Roles, Scopes and Permissions replace the ones of the
+// namespace: the request must be authenticated as a principal with one of the
+// Roles, all the Scopes, and roles granting all the Permissions by the policy
+// of the rbac section, else it gets 401 or 403.
 type RouteUnit struct {
-	Path       string
-	Controller any
-	Action     string
+	Path        string
+	Controller  any
+	Action      string
+	Middlewares []Middleware
+	Roles       []string
+	Scopes      []string
+	Permissions []string
 }
 
 type routeHttpMethod struct {
@@ -412,6 +394,27 @@ func (this routeHttpMethod) Delete(p string, c any, a string) {
 		Action:     a,
 	})
 }
+func (this routeHttpMethod) Patch(p string, c any, a string) {
+	this.uhm.Patch(RouteUnit{
+		Path:       p,
+		Controller: c,
+		Action:     a,
+	})
+}
+func (this routeHttpMethod) Head(p string, c any, a string) {
+	this.uhm.Head(RouteUnit{
+		Path:       p,
+		Controller: c,
+		Action:     a,
+	})
+}
+func (this routeHttpMethod) Options(p string, c any, a string) {
+	this.uhm.Options(RouteUnit{
+		Path:       p,
+		Controller: c,
+		Action:     a,
+	})
+}
 func (this routeHttpMethod) Any(p string, c any, a string) {
 	this.uhm.Any(RouteUnit{
 		Path:       p,
@@ -425,73 +428,50 @@ type routeUnitHttpMethod struct {
 	ns          string
 	register    *RouteRegister
 	interceptor RouteInterceptor
+	middlewares []Middleware
+	roles       []string
+	scopes      []string
+	permissions []string
 }
 
 func (this routeUnitHttpMethod) Get(unit RouteUnit) {
-	for _, s := range this.register.get {
-		if this.sd == s.subdomain {
-			this.parseRouteMethod(s, unit)
-			return
-		}
-	}
-
-	rns := &routeNamespace{subdomain: this.sd}
-	this.register.get = append(this.register.get, rns)
-
-	this.parseRouteMethod(rns, unit)
+	this.parseRouteMethod(this.namespace(GET), unit)
 }
 func (this routeUnitHttpMethod) Post(unit RouteUnit) {
-	for _, s := range this.register.post {
-		if this.sd == s.subdomain {
-			this.parseRouteMethod(s, unit)
-			return
-		}
-	}
-
-	rns := &routeNamespace{subdomain: this.sd}
-	this.register.post = append(this.register.post, rns)
-
-	this.parseRouteMethod(rns, unit)
+	this.parseRouteMethod(this.namespace(POST), unit)
 }
 func (this routeUnitHttpMethod) Put(unit RouteUnit) {
-	for _, s := range this.register.put {
-		if this.sd == s.subdomain {
-			this.parseRouteMethod(s, unit)
-			return
-		}
-	}
-
-	rns := &routeNamespace{subdomain: this.sd}
-	this.register.put = append(this.register.put, rns)
-
-	this.parseRouteMethod(rns, unit)
+	this.parseRouteMethod(this.namespace(PUT), unit)
 }
 func (this routeUnitHttpMethod) Delete(unit RouteUnit) {
-	for _, s := range this.register.delete {
-		if this.sd == s.subdomain {
-			this.parseRouteMethod(s, unit)
-			return
-		}
-	}
-
-	rns := &routeNamespace{subdomain: this.sd}
-	this.register.delete = append(this.register.delete, rns)
-
-	this.parseRouteMethod(rns, unit)
+	this.parseRouteMethod(this.namespace(DELETE), unit)
+}
+func (this routeUnitHttpMethod) Patch(unit RouteUnit) {
+	this.parseRouteMethod(this.namespace(PATCH), unit)
+}
+func (this routeUnitHttpMethod) Head(unit RouteUnit) {
+	this.parseRouteMethod(this.namespace(HEAD), unit)
+}
+func (this routeUnitHttpMethod) Options(unit RouteUnit) {
+	this.parseRouteMethod(this.namespace(OPTIONS), unit)
 }
-
 func (this routeUnitHttpMethod) Any(unit RouteUnit) {
-	for _, s := range this.register.any {
+	this.parseRouteMethod(this.namespace(ANY), unit)
+}
+
+func (this routeUnitHttpMethod) namespace(method string) *routeNamespace {
+	for _, s := range this.register.namespaces[method] {
 		if this.sd == s.subdomain {
-			this.parseRouteMethod(s, unit)
-			return
+			return s
 		}
 	}
 
+	if nil == this.register.namespaces {
+		this.register.namespaces = make(map[string][]*routeNamespace)
+	}
 	rns := &routeNamespace{subdomain: this.sd}
-	this.register.any = append(this.register.any, rns)
-
-	this.parseRouteMethod(rns, unit)
+	this.register.namespaces[method] = append(this.register.namespaces[method], rns)
+	return rns
 }
 
 func (this routeUnitHttpMethod) parseRouteMethod(m *routeNamespace, unit RouteUnit) {
@@ -502,15 +482,24 @@ func (this routeUnitHttpMethod) parseRouteMethod(m *routeNamespace, unit RouteUn
 		path = "/" + this.ns + unit.Path
 	}
 
-	pathIsRegexp, queryPath, pathRegexp, pathParams := parseRoutePath(path)
+	queryPath, pathParams := parseRoutePath(path)
 	actName, actParam := parseRouteAction(unit.Action)
 	ctlName, method, methodParams, hasInit := parseRouteController(unit.Controller, actName, actParam, pathParams, this.register.injectChain)
 
+	roles, scopes, permissions := this.roles, this.scopes, this.permissions
+	if nil != unit.Roles {
+		roles = unit.Roles
+	}
+	if nil != unit.Scopes {
+		scopes = unit.Scopes
+	}
+	if nil != unit.Permissions {
+		permissions = unit.Permissions
+	}
+
 	m.routers = append(m.routers, &Router{
 		Path:           queryPath,
 		Pathlen:        len(queryPath),
-		PathIsRegexp:   pathIsRegexp,
-		PathRegexp:     pathRegexp,
 		PathParams:     pathParams,
 		pathParamsNum:  len(pathParams),
 		Controller:     unit.Controller,
@@ -518,45 +507,22 @@ func (this routeUnitHttpMethod) parseRouteMethod(m *routeNamespace, unit RouteUn
 		Method:         method,
 		MethodParams:   methodParams,
 		HasInit:        hasInit,
+		Roles:          roles,
+		Scopes:         scopes,
+		Permissions:    permissions,
 		interceptor:    this.interceptor,
+		middlewares:    append(this.middlewares[:len(this.middlewares):len(this.middlewares)], unit.Middlewares...),
 		register:       this.register,
 	})
 }
 
-func parseRoutePath(routePath string) (pathIsRegexp bool, path string, pathRegexp *regexp.Regexp, params []string) {
-	if routePath == "/*" {
-		pathIsRegexp = false
-		path = "/*"
-		return
-	}
-
-	var n = strings.Index(routePath, "/:")
-	if -1 == n {
-		pathIsRegexp = false
-		path = routePath
-		return
-	}
-
-	pathIsRegexp = true
-
-	r := regexp.MustCompile(`/:([^/]+)`)
-	all := r.FindAllStringSubmatch(routePath, -1)
-	var exp = routePath
-	for _, v := range all {
-		params = append(params, v[1])
-		exp = strings.Replace(exp, v[0], "/([^/]+)", -1)
+func parseRoutePath(routePath string) (path string, params []string) {
+	path = routePath
+	for _, seg := range strings.Split(routePath, "/") {
+		if len(seg) > 1 && (':' == seg[0] || '*' == seg[0]) {
+			params = append(params, seg[1:])
+		}
 	}
-
-	// replace ^+*$
-	exp = strings.ReplaceAll(exp, `^`, `\^`)
-	exp = strings.ReplaceAll(exp, `\^/]`, `^/]`)
-	exp = strings.ReplaceAll(exp, `+`, `\+`)
-	exp = strings.ReplaceAll(exp, `]\+)`, `]+)`)
-	exp = strings.ReplaceAll(exp, `*`, `\*`)
-	exp = strings.ReplaceAll(exp, `$`, `\$`)
-
-	path = "^" + exp
-	pathRegexp = regexp.MustCompile(path)
 	return
 }
 
@@ -601,14 +567,21 @@ func parseRouteController(controller any, action string, actParams [][]string, p
 	}
 	ctlName = rtc.Elem().String()
 
-	var ok bool
+	var (
+		ok bool
+		mt = reflect.ValueOf(controller).MethodByName(action)
+	)
 	for _, param := range pathParams {
 		ok = false
-		for _, ap := range actParams {
+		for i, ap := range actParams {
 			if ap[0] == param {
 				ok = true
 				break
 			}
+			if mt.IsValid() && i < mt.Type().NumIn() && hasPathField(mt.Type().In(i), param, map[reflect.Type]bool{}) {
+				ok = true
+				break
+			}
 		}
 		if !ok {
 			log.Panicf("path param '%s' not found in method '%s:%s'", param, ctlName, action)
@@ -630,38 +603,16 @@ func parseRouteController(controller any, action string, actParams [][]string, p
 	for i := 0; i < n; i++ {
 		var (
 			actPt = actParams[i][1]
-			tlen  = len(actPt)
 			pt    = m.In(i)
 		)
-		if pt.Kind() == reflect.Ptr {
-			if pt.Elem().Kind() == reflect.Struct {
-				var (
-					name = pt.Elem().Name()
-					pos  = tlen - len(name)
-				)
-				if pos < 0 {
-					log.Panicf("type of param[%d] of method '%s:%s' mismatch router", i, rtc.String(), action)
-				}
-				if actPt[pos:] != name {
-					log.Panicf("type of param[%d] of method '%s:%s' mismatch router", i, rtc.String(), action)
-				}
-			} else if pt.Name() != actPt {
-				log.Panicf("type of param[%d] of method '%s:%s' mismatch router", i, rtc.String(), action)
-			}
-		} else if pt.Kind() == reflect.Struct {
-			var (
-				name = pt.Name()
-				pos  = tlen - len(name)
-			)
-			if pos < 0 {
-				log.Panicf("type of param[%d] of method '%s:%s' mismatch router", i, rtc.String(), action)
-			}
-			if actPt[pos:] != name {
-				log.Panicf("type of param[%d] of method '%s:%s' mismatch router", i, rtc.String(), action)
-			}
-		} else if ("any" == actPt || "interface{}" == actPt) && "interface {}" == fmt.Sprintf("%s", pt) {
-			continue
-		} else if pt.Name() != actPt {
+		if !convertible(pt) {
+			log.Panicf("type %s of param[%d] of method '%s:%s' can't be bound", pt, i, rtc.String(), action)
+		}
+		var et = pt
+		for et.Kind() == reflect.Ptr || et.Kind() == reflect.Slice || et.Kind() == reflect.Array {
+			et = et.Elem()
+		}
+		if k := declaredKind(actPt); "" != k && k != et.Kind().String() {
 			log.Panicf("type of param[%d] of method '%s:%s' mismatch router", i, rtc.String(), action)
 		}
 	}
@@ -675,19 +626,22 @@ func parseRouteController(controller any, action string, actParams [][]string, p
 			actParam  = actParams[i]
 		)
 		if pk == reflect.Ptr {
-			if pt.Elem().Kind() == reflect.Struct {
+			if pt.Elem().Kind() == reflect.Struct && !isScalar(pt.Elem()) {
 				isStruct = true
 				structVal = reflect.New(pt.Elem())
 			}
 			pt = pt.Elem()
-		} else if pk == reflect.Struct {
+		} else if pk == reflect.Struct && !isScalar(pt) {
 			isStruct = true
 			structVal = reflect.Zero(pt)
 		}
+		if isStruct {
+			checkValidateTags(pt, map[reflect.Type]bool{})
+		}
 
 		methodParams = append(methodParams, methodParam{
 			Name:        actParam[0],
-			Type:        actParam[1],
+			Type:        strings.TrimPrefix(actParam[1], "*"),
 			ParamKind:   pk,
 			ParamType:   pt,
 			IsStruct:    isStruct,
@@ -703,27 +657,57 @@ func parseRouteController(controller any, action string, actParams [][]string, p
 	return
 }
 
+// hasPathField reports whether a struct param has a field bound from the path
+// param name.
+func hasPathField(t reflect.Type, name string, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || isScalar(t) || seen[t] {
+		return false
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		var sf = t.Field(i)
+		if p, _, _ := strings.Cut(sf.Tag.Get("path"), ","); p == name || hasPathField(sf.Type, name, seen) {
+			return true
+		}
+	}
+	return false
+}
+
 type RouteControllerInjector interface {
 	InjectRouteController(controller any)
 }
 
+// RouteInterceptor is the interceptor of a namespace, Before runs once the
+// params are bound and valid, just before the action, a copy of it is made
+// for every request.
 type RouteInterceptor interface {
 	Before(router Router, svc *service.Service, r *HttpRequest, w *HttpResponse) (pass bool, res []byte)
 }
 
 const (
-	GET    = "GET"
-	POST   = "POST"
-	PUT    = "PUT"
-	DELETE = "DELETE"
-	PATCH  = "PATCH"
+	GET     = "GET"
+	POST    = "POST"
+	PUT     = "PUT"
+	DELETE  = "DELETE"
+	PATCH   = "PATCH"
+	HEAD    = "HEAD"
+	OPTIONS = "OPTIONS"
+	ANY     = "ANY"
 )
 
+var allMethods = []string{GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS, ANY}
+
 type HttpMethod interface {
 	Get(path string, controller any, action string)
 	Post(path string, controller any, action string)
 	Put(path string, controller any, action string)
 	Delete(path string, controller any, action string)
+	Patch(path string, controller any, action string)
+	Head(path string, controller any, action string)
+	Options(path string, controller any, action string)
 	Any(path string, controller any, action string)
 }
 
@@ -732,5 +716,8 @@ type UnitHttpMethod interface {
 	Post(unit RouteUnit)
 	Put(unit RouteUnit)
 	Delete(unit RouteUnit)
+	Patch(unit RouteUnit)
+	Head(unit RouteUnit)
+	Options(unit RouteUnit)
 	Any(unit RouteUnit)
 }
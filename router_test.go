@@ -0,0 +1,267 @@
+package wgo
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type routeController struct {
+	WgoController
+}
+
+func (this *routeController) Index() []byte              { return nil }
+func (this *routeController) Me() []byte                 { return nil }
+func (this *routeController) Show(id int) []byte         { return nil }
+func (this *routeController) Update(id int) []byte       { return nil }
+func (this *routeController) Files(path string) []byte   { return nil }
+func (this *routeController) Rest(rest string) []byte    { return nil }
+func (this *routeController) Docs() []byte               { return nil }
+func (this *routeController) Fallback() []byte           { return nil }
+func (this *routeController) ApiShow(id int) []byte      { return nil }
+func (this *routeController) Comment(id, cid int) []byte { return nil }
+
+func newTestRouter(rc RouteCollection) *router {
+	var r = &router{RouteCollection: rc}
+	r.init(nil, func(w *HttpResponse, req *HttpRequest) {})
+	return r
+}
+
+func TestRouter(t *testing.T) {
+	var c = &routeController{}
+	var r = newTestRouter(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Get("/", c, "Index()")
+			m.Get("/users", c, "Index()")
+			m.Post("/users", c, "Index()")
+			m.Get("/users/me", c, "Me()")
+			m.Get("/users/:id", c, "Show(id int)")
+			m.Put("/users/:id", c, "Update(id int)")
+			m.Get("/users/:id/comments/:cid", c, "Comment(id int, cid int)")
+			m.Get("/files/*path", c, "Files(path string)")
+			m.Get("/docs", c, "Docs()")
+			m.Any("/any", c, "Index()")
+		})
+		r.Registe("api", "/v1", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Get("/users/:id", c, "ApiShow(id int)")
+		})
+		r.Registe("api", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Get("/*", c, "Fallback()")
+		})
+		r.Registe("*", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Get("/wild", c, "Index()")
+		})
+	})
+
+	var cases = []struct {
+		host   string
+		method string
+		path   string
+		action string
+		values string
+		code   int
+		allow  string
+	}{
+		{"www.example.com", GET, "/", "Index", "", 200, ""},
+		{"www.example.com", GET, "/users", "Index", "", 200, ""},
+		{"www.example.com", POST, "/users", "Index", "", 200, ""},
+		{"www.example.com", GET, "/users/me", "Me", "", 200, ""},
+		{"www.example.com", GET, "/users/42", "Show", "42", 200, ""},
+		{"www.example.com", HEAD, "/users/42", "Show", "42", 200, ""},
+		{"www.example.com", PUT, "/users/7", "Update", "7", 200, ""},
+		{"www.example.com", GET, "/users/7/comments/9", "Comment", "7 9", 200, ""},
+		{"www.example.com", GET, "/files/a/b.txt", "Files", "a/b.txt", 200, ""},
+		{"www.example.com", GET, "/files/", "Files", "", 200, ""},
+		{"www.example.com", GET, "/docs/intro/setup", "Docs", "", 200, ""},
+		{"www.example.com", GET, "/any", "Index", "", 200, ""},
+		{"www.example.com", POST, "/any", "Index", "", 200, ""},
+		{"www.example.com", DELETE, "/users/7", "", "", 405, "GET, HEAD, POST, PUT, OPTIONS"},
+		{"www.example.com", PATCH, "/users", "", "", 405, "GET, HEAD, POST, OPTIONS"},
+		{"www.example.com", GET, "/nothing", "", "", 404, ""},
+		{"www.example.com", GET, "/docsx", "", "", 404, ""},
+		{"api.example.com", GET, "/v1/users/1", "ApiShow", "1", 200, ""},
+		{"api.example.com", GET, "/users/1", "Fallback", "", 200, ""},
+		{"api.example.com:8080", GET, "/anything/else", "Fallback", "", 200, ""},
+		{"other.example.com", GET, "/wild", "Index", "", 200, ""},
+		{"other.example.com", GET, "/users", "", "", 404, ""},
+		{"127.0.0.1:8080", GET, "/users/5", "Show", "5", 200, ""},
+		{"localhost", GET, "/v1/users/5", "ApiShow", "5", 200, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.method+" "+c.host+c.path, func(t *testing.T) {
+			var req = httptest.NewRequest(c.method, "http://"+c.host+c.path, nil)
+			route, params, e := r.getHandler(req)
+			if 200 != c.code {
+				var code, allow = 404, ""
+				if na, ok := e.(MethodNotAllowedError); ok {
+					code, allow = 405, strings.Join(na.Allow, ", ")
+				}
+				if nil == e || c.code != code || c.allow != allow {
+					t.Fatalf("got %s %v, want %d %s", route.Method.Name, e, c.code, c.allow)
+				}
+				return
+			}
+			if e != nil {
+				t.Fatal(e)
+			}
+			if c.action != route.Method.Name {
+				t.Fatalf("action = %s, want %s", route.Method.Name, c.action)
+			}
+			var values []string
+			for _, p := range params {
+				if p.inPath {
+					values = append(values, p.path)
+				}
+			}
+			if got := strings.Join(values, " "); c.values != got {
+				t.Fatalf("path values = %q, want %q", got, c.values)
+			}
+		})
+	}
+}
+
+func TestRouterConflict(t *testing.T) {
+	var c = &routeController{}
+	for _, paths := range [][][2]string{
+		{{"/users/:id", "Show(id int)"}, {"/users/:id", "Update(id int)"}},
+		{{"/files/*path", "Files(path string)"}, {"/files/*rest", "Rest(rest string)"}},
+		{{"/files/*path/x", "Files(path string)"}},
+		{{"/users/:", "Index()"}},
+		{{"/*", "Index()"}, {"/*", "Docs()"}},
+	} {
+		func() {
+			defer func() {
+				if nil == recover() {
+					t.Errorf("%v registered", paths)
+				}
+			}()
+			newTestRouter(func(r *RouteRegister) {
+				r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+					for _, p := range paths {
+						m.Get(p[0], c, p[1])
+					}
+				})
+			})
+		}()
+	}
+}
+
+// linearRoute is a route of the linear scan the tree replaced, the paths with
+// params matched by a regexp.
+type linearRoute struct {
+	path string
+	re   *regexp.Regexp
+}
+
+var linearParam = regexp.MustCompile(`/:([^/]+)`)
+
+func newLinearRoute(path string) linearRoute {
+	if !strings.Contains(path, "/:") {
+		return linearRoute{path: path}
+	}
+	return linearRoute{path: path, re: regexp.MustCompile("^" + linearParam.ReplaceAllString(path, "/([^/]+)"))}
+}
+
+// linearLookup is the scan of the routes of a namespace the router did before
+// the tree: an equal path wins, else the longest of the routes whose regexp or
+// leading part matches.
+func linearLookup(routes []linearRoute, path string) (int, []string) {
+	var (
+		found  = -1
+		values []string
+	)
+	for k, r := range routes {
+		if r.path == path {
+			return k, nil
+		}
+		if nil != r.re {
+			if m := r.re.FindStringSubmatch(path); nil != m && (-1 == found || len(r.path) > len(routes[found].path)) {
+				found, values = k, m[1:]
+			}
+			continue
+		}
+		if len(path) < len(r.path) || r.path != path[:len(r.path)] || (len(path) > len(r.path) && '/' != path[len(r.path)]) {
+			continue
+		}
+		if -1 == found || len(r.path) > len(routes[found].path) {
+			found, values = k, nil
+		}
+	}
+	return found, values
+}
+
+func BenchmarkRouter(b *testing.B) {
+	var (
+		paths    []string
+		requests []string
+	)
+	for _, res := range []string{"users", "orders", "products", "invoices", "teams", "projects", "issues", "repos", "events", "files"} {
+		paths = append(paths,
+			"/"+res,
+			"/"+res+"/search",
+			"/"+res+"/:id",
+			"/"+res+"/:id/history",
+			"/"+res+"/:id/members/:mid",
+		)
+		requests = append(requests, "/"+res, "/"+res+"/search", "/"+res+"/42", "/"+res+"/42/history", "/"+res+"/42/members/7")
+	}
+
+	var (
+		linear = make([]linearRoute, 0, len(paths))
+		rns    = &routeNamespace{subdomain: "www"}
+	)
+	for _, p := range paths {
+		linear = append(linear, newLinearRoute(p))
+		rns.routers = append(rns.routers, &Router{Path: p})
+	}
+	var tree = newRouteTree(rns)
+	for _, p := range requests {
+		k, _ := linearLookup(linear, p)
+		route, _ := tree.lookup(p)
+		if -1 == k || nil == route || linear[k].path != route.Path {
+			b.Fatalf("%s: linear %d, tree %v", p, k, route)
+		}
+	}
+
+	b.Run(fmt.Sprintf("linear/%d", len(paths)), func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			linearLookup(linear, requests[i%len(requests)])
+		}
+	})
+	b.Run(fmt.Sprintf("tree/%d", len(paths)), func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tree.lookup(requests[i%len(requests)])
+		}
+	})
+}
+
+func TestServerAllow(t *testing.T) {
+	var c = &routeController{}
+	var s = &server{app: &app{}, Router: newTestRouter(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Get("/users", c, "Index()")
+			m.Patch("/users", c, "Index()")
+		})
+	})}
+	s.handler = s.handle
+
+	for _, c := range []struct {
+		method string
+		code   int
+		allow  string
+	}{
+		{OPTIONS, http.StatusNoContent, "GET, HEAD, PATCH, OPTIONS"},
+		{DELETE, http.StatusMethodNotAllowed, "GET, HEAD, PATCH, OPTIONS"},
+	} {
+		var w = httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(c.method, "http://www.example.com/users", nil))
+		if c.code != w.Code || c.allow != w.Header().Get("Allow") {
+			t.Errorf("%s = %d %q, want %d %q", c.method, w.Code, w.Header().Get("Allow"), c.code, c.allow)
+		}
+	}
+}
@@ -11,35 +11,128 @@ import (
 	"net/http"
 	"reflect"
 	"runtime/debug"
-	"strconv"
 	"strings"
+	"time"
 )
 
 type server struct {
 	app          *app
 	Configurator *config.Configurator
 	Router       *router
+	handler      HandlerFunc
+
+	maxBodyBytes       int64
+	maxMultipartMemory int64
+	wsOptions          WSOptions
 }
 
 func (this *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	req := &HttpRequest{Request: r}
-	res := &HttpResponse{Writer: w}
+	req := &HttpRequest{Request: r, writer: w, maxBody: this.maxBodyBytes, maxMemory: this.maxMultipartMemory, wsOptions: this.wsOptions, websockets: &this.app.websockets, sessions: this.app.sessions, cookies: this.app.cookies, auth: this.app.auth, policy: this.app.policy, logger: this.app.logger, codecs: this.app.codecs}
+	req.rw = &responseWriter{ResponseWriter: w}
+	res := &HttpResponse{Writer: req.rw, cookies: this.app.cookies, logger: this.app.logger}
 	req.init()
-	if nil == this.app.finally {
-		defer this.finally(res, req)
-	} else {
-		defer this.app.finally(res, req)
+	defer this.finally(res, req)
+	defer func() {
+		if nil != res.sseWriter {
+			res.sseWriter.close()
+		}
+		if nil != res.wsConn {
+			res.wsConn.finish()
+		}
+		if nil != res.session {
+			res.session.commit()
+		}
+		// net/http only removes the files of the form it parsed itself, not
+		// the ones of a request a middleware replaced.
+		if nil != req.Request.MultipartForm {
+			req.Request.MultipartForm.RemoveAll()
+		}
+	}()
+
+	// the route is found before the global middlewares for its max body size
+	// to apply to them.
+	req.match = this.match(req)
+	this.handler(res, req)
+}
+
+// routeMatch is the route found for a request, handle finds it again when a
+// global middleware changed the method, host or path.
+type routeMatch struct {
+	key    string
+	route  Router
+	params []methodParam
+	err    error
+}
+
+func matchKey(r *http.Request) string {
+	return r.Method + " " + r.Host + r.URL.Path
+}
+
+func (this *server) match(req *HttpRequest) *routeMatch {
+	var m = &routeMatch{key: matchKey(req.Request)}
+	m.route, m.params, m.err = this.Router.getHandler(req.Request)
+	if nil == m.err && m.route.hasMaxBody && !req.limited {
+		req.maxBody, req.routeLimit = m.route.maxBody, true
 	}
+	return m
+}
 
-	route, params, notfound := this.Router.getHandler(r)
+// handle is the innermost handler of the global middlewares, it finds the
+// route, checks the access to it and runs the action wrapped by the
+// middlewares of the route.
+func (this *server) handle(res *HttpResponse, req *HttpRequest) {
+	var m = req.match
+	if nil == m || m.key != matchKey(req.Request) {
+		m = this.match(req)
+	}
+	route, params, notfound := m.route, m.params, m.err
 	if nil != notfound {
-		_, _ = w.Write([]byte(notfound.Error()))
+		if na, ok := notfound.(MethodNotAllowedError); ok {
+			res.SetHeader("Allow", strings.Join(na.Allow, ", "))
+			if OPTIONS == req.Request.Method {
+				res.WriteHeader(http.StatusNoContent)
+			} else if nil == this.app.methodNotAllowed {
+				writeError(res, req, http.StatusMethodNotAllowed, notfound.Error())
+			} else {
+				this.app.methodNotAllowed(res, req, na.Allow)
+			}
+		} else if nil == this.app.notFound {
+			writeError(res, req, http.StatusNotFound, notfound.Error())
+		} else {
+			this.app.notFound(res, req)
+		}
+		return
+	}
+	// nothing of the route runs for a request it doesn't accept.
+	if nil != route.csrf {
+		req.csrf = newCSRFState(route.csrf, res, req)
+	}
+	req.csrfExempt = req.csrfExempt || route.csrfExempt
+	if !checkAccess(res, req, &route) || !checkCSRF(res, req) {
 		return
 	}
 
-	var svc = this.app.servicer.New()
+	req.route, req.params, req.svc = route, params, this.app.servicer.New()
+	route.handler(res, req)
+}
+
+// action is the innermost handler of the middlewares of a route, it binds the
+// params and calls the action of the controller.
+func (this *server) action(res *HttpResponse, req *HttpRequest) {
+	var (
+		route  = req.route
+		params = req.params
+		svc    = req.svc
+	)
+	// a route middleware may have replaced the request context.
+	svc.SetContext(req.Request.Context())
+	// a CSRF the route couldn't declare, made while the request runs, is
+	// checked here.
+	if !checkCSRF(res, req) {
+		return
+	}
 
 	controller := tool.StructCopy(route.Controller)
 	cv := reflect.ValueOf(controller)
@@ -54,251 +147,96 @@ func (this *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		iface.InjectRequestController(route, cve, svc)
 	}
 
-	this.parseRequestParam(req, params)
-
-	if nil == route.interceptor {
-		this.render(w, cv, &route, params)
-	} else {
-		var (
-			result   bool
-			resData  []byte
-			inp      = tool.StructCopy(route.interceptor)
-			inpValue = reflect.ValueOf(inp)
-			inpParam = []reflect.Value{
-				reflect.ValueOf(route),
-				reflect.ValueOf(svc),
-				reflect.ValueOf(req),
-				reflect.ValueOf(res),
-			}
-		)
-		result, resData = this.callInterceptor(inpValue, inpParam)
-		if !result {
-			w.Write(resData)
+	var errs = this.parseRequestParam(req, params)
+	if req.bodyTooLarge() {
+		// answered 413 when the body was read.
+		return
+	} else if nil != req.bodyErr {
+		writeError(res, req, http.StatusBadRequest, req.bodyErr.Error())
+		return
+	}
+	if 0 == len(errs) {
+		errs = validateParams(params)
+	}
+	if len(errs) > 0 {
+		if nil == this.app.validationFormatter {
+			writeValidationErrors(res, req, errs)
 		} else {
-			this.render(w, cv, &route, params)
+			this.app.validationFormatter(res, req, errs)
+		}
+		return
+	}
+
+	if nil != route.interceptor {
+		inp := tool.StructCopy(route.interceptor).(RouteInterceptor)
+		if pass, b := inp.Before(route, svc, req, res); !pass {
+			res.Writer.Write(b)
+			return
 		}
 	}
+	this.render(res, req, cv, &route, params)
 }
 
-func (this *server) parseRequestParam(r *HttpRequest, params []methodParam) {
-	switch r.Request.Method {
-	case GET:
-		for k, p := range params {
-			if p.IsStruct {
-				var qmap = make(map[string]any)
-				for i := 0; i < p.ParamType.NumField(); i++ {
-					var (
-						pt      = p.ParamType.Field(i)
-						name    = pt.Name
-						tagJson = pt.Tag.Get("json")
-					)
-					if "" != tagJson {
-						name = tagJson
-					}
-
-					qmap[name] = convertParam2Value(r.Get(name), pt.Type.Name())
-				}
-
-				if tmp, e := json.Marshal(qmap); e == nil {
-					val := reflect.New(p.ParamType)
-					ifa := val.Interface()
-					json.Unmarshal(tmp, ifa)
-
-					if p.ParamKind == reflect.Ptr {
-						params[k].StructValue = val
-					} else {
-						params[k].StructValue = val.Elem()
-					}
-				}
+// parseRequestParam binds the request to the action params, a body of a type
+// other than json and forms is decoded by its registered Codec. it returns the
+// errors of a body that doesn't decode into a struct param, and with
+// StrictBinding the values that don't convert to the type of their param.
+func (this *server) parseRequestParam(r *HttpRequest, params []methodParam) (errs ValidationErrors) {
+	if 0 == len(params) {
+		return
+	}
 
-			} else if nil == p.Value {
-				params[k].Value = convertParam2Value(r.Get(p.Name), p.Type)
-			}
+	var b = binding{req: r, codecs: r.codecs, strict: r.strict, timeLayout: this.app.timeLayout}
+	if "" == b.timeLayout {
+		b.timeLayout = time.RFC3339
+	}
+	for k, p := range params {
+		if p.inPath {
+			errs = append(errs, b.strings(&params[k], []string{p.path})...)
 		}
+	}
+
+	switch r.Request.Method {
+	case GET, HEAD, OPTIONS:
+		errs = append(errs, b.values(params, r.GetSlice, r.GetSlice)...)
 	case DELETE:
 		var (
-			body        = r.Body()
+			body, _     = r.Body()
 			contentType = r.GetHeader("Content-Type")
 		)
 		if 0 == len(body) {
-			for k, p := range params {
-				if p.IsStruct {
-					var qmap = make(map[string]any)
-					for i := 0; i < p.ParamType.NumField(); i++ {
-						var (
-							pt      = p.ParamType.Field(i)
-							name    = pt.Name
-							tagJson = pt.Tag.Get("json")
-						)
-						if "" != tagJson {
-							name = tagJson
-						}
-
-						qmap[name] = convertParam2Value(r.Get(name), pt.Type.Name())
-					}
-
-					if tmp, e := json.Marshal(qmap); e == nil {
-						val := reflect.New(p.ParamType)
-						ifa := val.Interface()
-						json.Unmarshal(tmp, ifa)
-
-						if p.ParamKind == reflect.Ptr {
-							params[k].StructValue = val
-						} else {
-							params[k].StructValue = val.Elem()
-						}
-					}
-
-				} else if nil == p.Value {
-					params[k].Value = convertParam2Value(r.Get(p.Name), p.Type)
-				}
-			}
+			errs = append(errs, b.values(params, r.GetSlice, r.GetSlice)...)
+		} else if strings.Contains(contentType, "application/json") {
+			errs = append(errs, b.json(params, body, r.GetSlice)...)
+		} else if strings.Contains(contentType, "application/x-www-form-urlencoded") {
+			errs = append(errs, b.values(params, r.GetPostSlice, r.GetRequestSlice)...)
+		} else if c := r.codecs.of(contentType); nil != c {
+			errs = append(errs, b.decode(params, body, c, r.GetSlice)...)
 		} else {
-			if strings.Contains(contentType, "application/json") {
-				var m = make(map[string]any)
-				json.Unmarshal(body, &m)
-				for k, p := range params {
-					if p.IsStruct {
-						val := reflect.New(p.ParamType)
-						ifa := val.Interface()
-						json.Unmarshal(body, ifa)
-						if p.ParamKind == reflect.Ptr {
-							params[k].StructValue = val
-						} else {
-							params[k].StructValue = val.Elem()
-						}
-					} else if nil == p.Value {
-						var queryVal = r.Get(p.Name)
-						if "" != queryVal {
-							params[k].Value = convertParam2Value(queryVal, p.Type)
-						} else {
-							params[k].Value = convertAny2Value(m[p.Name], p.Type)
-						}
-					}
-				}
-			} else if strings.Contains(contentType, "application/x-www-form-urlencoded") {
-				for k, p := range params {
-					if p.IsStruct {
-						var qmap = make(map[string]any)
-						for i := 0; i < p.ParamType.NumField(); i++ {
-							var (
-								pt      = p.ParamType.Field(i)
-								name    = pt.Name
-								tagJson = pt.Tag.Get("json")
-							)
-							if "" != tagJson {
-								name = tagJson
-							}
-
-							qmap[name] = convertParam2Value(r.GetPost(name), pt.Type.Name())
-						}
-
-						if tmp, e := json.Marshal(qmap); e == nil {
-							var (
-								val = reflect.New(p.ParamType)
-								ifa = val.Interface()
-							)
-							json.Unmarshal(tmp, ifa)
-							if p.ParamKind == reflect.Ptr {
-								params[k].StructValue = val
-							} else {
-								params[k].StructValue = val.Elem()
-							}
-						}
-					} else if nil == p.Value {
-						params[k].Value = convertParam2Value(r.GetRequest(p.Name), p.Type)
-					}
-				}
-			} else {
-				for k, p := range params {
-					if !p.IsStruct && nil == p.Value {
-						params[k].Value = convertParam2Value(r.GetRequest(p.Name), p.Type)
-					}
-				}
-			}
+			errs = append(errs, b.values(params, nil, r.GetRequestSlice)...)
 		}
 	case POST, PUT, PATCH:
 		var contentType = r.GetHeader("Content-Type")
 		if strings.Contains(contentType, "application/json") {
-			var (
-				m    = make(map[string]any)
-				body = r.Body()
-			)
-			json.Unmarshal(body, &m)
-			for k, p := range params {
-				if p.IsStruct {
-					val := reflect.New(p.ParamType)
-					ifa := val.Interface()
-					json.Unmarshal(body, ifa)
-					if p.ParamKind == reflect.Ptr {
-						params[k].StructValue = val
-					} else {
-						params[k].StructValue = val.Elem()
-					}
-				} else if nil == p.Value {
-					params[k].Value = convertAny2Value(m[p.Name], p.Type)
-				}
-			}
+			body, _ := r.Body()
+			errs = append(errs, b.json(params, body, nil)...)
 		} else if strings.Contains(contentType, "application/x-www-form-urlencoded") {
-			for k, p := range params {
-				if p.IsStruct {
-					var qmap = make(map[string]any)
-					for i := 0; i < p.ParamType.NumField(); i++ {
-						var (
-							pt      = p.ParamType.Field(i)
-							name    = pt.Name
-							tagJson = pt.Tag.Get("json")
-						)
-						if "" != tagJson {
-							name = tagJson
-						}
-
-						qmap[name] = convertParam2Value(r.GetPost(name), pt.Type.Name())
-					}
-
-					if tmp, e := json.Marshal(qmap); e == nil {
-						var (
-							val = reflect.New(p.ParamType)
-							ifa = val.Interface()
-						)
-						json.Unmarshal(tmp, ifa)
-						if p.ParamKind == reflect.Ptr {
-							params[k].StructValue = val
-						} else {
-							params[k].StructValue = val.Elem()
-						}
-					}
-				} else if nil == p.Value {
-					params[k].Value = convertParam2Value(r.GetRequest(p.Name), p.Type)
-				}
-			}
+			errs = append(errs, b.values(params, r.GetPostSlice, r.GetRequestSlice)...)
+		} else if strings.Contains(contentType, "multipart/form-data") {
+			b.files = r.GetFiles
+			errs = append(errs, b.values(params, r.GetPostSlice, r.GetRequestSlice)...)
+		} else if c := r.codecs.of(contentType); nil != c {
+			body, _ := r.Body()
+			errs = append(errs, b.decode(params, body, c, r.GetSlice)...)
 		} else {
-			for k, p := range params {
-				if !p.IsStruct && nil == p.Value {
-					params[k].Value = convertParam2Value(r.GetRequest(p.Name), p.Type)
-				}
-			}
+			errs = append(errs, b.values(params, nil, r.GetRequestSlice)...)
 		}
 	}
+	return
 }
 
-func (this *server) callInterceptor(inp reflect.Value, params []reflect.Value) (bool, []byte) {
-	ret := inp.MethodByName("Before").Call(params)
-	if 2 != len(ret) {
-		log.Panicf("controller interceptor '%s' return must be (bool, []byte)", inp.Type().Kind().String())
-	}
-
-	res := ret[0]
-	dat := ret[1]
-	rtp := res.Type()
-	dtp := dat.Type()
-	if rtp.Kind() != reflect.Bool || dtp.Kind() != reflect.Slice || dtp.Elem().Kind() != reflect.Uint8 {
-		log.Panicf("controller interceptor '%s' return must be (bool, []byte)", inp.Type().Kind().String())
-	}
-	return res.Bool(), dat.Bytes()
-}
-
-func (this *server) render(w http.ResponseWriter, cv reflect.Value, router *Router, params []methodParam) {
+func (this *server) render(res *HttpResponse, req *HttpRequest, cv reflect.Value, router *Router, params []methodParam) {
+	var w = res.Writer
 	if router.HasInit {
 		cv.MethodByName("Init").Call(nil)
 	}
@@ -311,6 +249,8 @@ func (this *server) render(w http.ResponseWriter, cv reflect.Value, router *Rout
 		for k, p := range params {
 			if p.IsStruct {
 				values[k] = p.StructValue
+			} else if nil == p.Value {
+				values[k] = reflect.Zero(p.argType())
 			} else {
 				values[k] = reflect.ValueOf(p.Value)
 			}
@@ -320,18 +260,27 @@ func (this *server) render(w http.ResponseWriter, cv reflect.Value, router *Rout
 	}
 
 	switch len(ret) {
+	case 0:
+		// the action wrote the response itself, like a stream of SSE.
 	default:
-		log.Panicf("%s of %s return must be []byte or (string, interface{}) or (*template.Template, interface{})", router.Method.Name, router.ControllerName)
+		log.Panicf("%s of %s return must be []byte, io.Reader, wgo.File, wgo.Stream, wgo.EventStream, wgo.WebSocket or (string, interface{}) or (*template.Template, interface{})", router.Method.Name, router.ControllerName)
 
 	case 1:
 		rt := ret[0].Type()
-		if rt.Kind() != reflect.Slice || rt.Elem().Kind() != reflect.Uint8 {
-			log.Panicf("%s of %s first return must be []byte, '%s' given", router.Method.Name, router.ControllerName, rt.Kind())
+		if rt.Kind() == reflect.Slice && rt.Elem().Kind() == reflect.Uint8 {
+			if ret[0].IsNil() {
+				log.Panicf("%s of %s first return is nil", router.Method.Name, router.ControllerName)
+			}
+			w.Write(ret[0].Bytes())
+			return
+		}
+		if !isStreamedReturn(rt) {
+			log.Panicf("%s of %s first return must be []byte, io.Reader, wgo.File, wgo.Stream, wgo.EventStream or wgo.WebSocket, '%s' given", router.Method.Name, router.ControllerName, rt)
 		}
-		if ret[0].IsNil() {
+		if (rt.Kind() == reflect.Ptr || rt.Kind() == reflect.Interface || rt.Kind() == reflect.Func) && ret[0].IsNil() {
 			log.Panicf("%s of %s first return is nil", router.Method.Name, router.ControllerName)
 		}
-		w.Write(ret[0].Bytes())
+		this.stream(res, req, ret[0].Interface())
 
 	case 2:
 		var (
@@ -359,12 +308,24 @@ func (this *server) render(w http.ResponseWriter, cv reflect.Value, router *Rout
 	}
 }
 
+// finally answers the panic of the request, if any, and runs the Finally of
+// the app.
 func (this *server) finally(res *HttpResponse, req *HttpRequest) {
-	var e = recover()
-	if e == nil {
-		return
+	if e := recover(); e != nil {
+		if nil == this.app.panicHandler {
+			this.panic(res, req, e)
+		} else {
+			this.app.panicHandler(res, req, e)
+		}
+	}
+	if nil != this.app.finally {
+		this.app.finally(res, req)
 	}
+}
 
+// panic is the default PanicHandler, it answers 500 unless the action has
+// already started the response.
+func (this *server) panic(res *HttpResponse, req *HttpRequest, e any) {
 	var msg string
 	if this.app.debug {
 		debug.PrintStack()
@@ -379,28 +340,48 @@ func (this *server) finally(res *HttpResponse, req *HttpRequest) {
 		}
 
 		if key < 2 {
-			res.Writer.Write(tool.String2Bytes(fmt.Sprintf("%s\n\n%s", e, debug.Stack())))
-			return
+			msg = fmt.Sprintf("%s\n\n%s", e, debug.Stack())
+		} else {
+			var (
+				fnPos   = strings.LastIndex(stacks[key-1], "/")
+				lastPos = strings.LastIndex(stacks[key], "/")
+				nextPos = strings.LastIndex(stacks[key][:lastPos], "/")
+			)
+			msg = fmt.Sprintf("%s at file %s func %s", e, stacks[key][nextPos:], stacks[key-1][fnPos:])
 		}
-
-		var (
-			fnPos   = strings.LastIndex(stacks[key-1], "/")
-			lastPos = strings.LastIndex(stacks[key], "/")
-			nextPos = strings.LastIndex(stacks[key][:lastPos], "/")
-		)
-		msg = fmt.Sprintf("%s at file %s func %s", e, stacks[key][nextPos:], stacks[key-1][fnPos:])
 	} else {
 		msg = fmt.Sprintf("%s", e)
 	}
 
-	var code = -1
-	if res.statusCode > 0 {
-		code = res.statusCode
+	if res.Written() {
+		logf(req.logger, "panic after response started: %s", msg)
+		return
+	}
+	writeError(res, req, http.StatusInternalServerError, msg)
+}
+
+// writeError sends the status code with a {"code":..,"msg":..} json body, or
+// a small html page when the client asks for html.
+func writeError(res *HttpResponse, req *HttpRequest, code int, msg string) {
+	if acceptsHtml(req) {
+		res.SetHeader("Content-Type", "text/html; charset=utf-8")
+		res.WriteHeader(code)
+		res.Writer.Write(tool.String2Bytes(fmt.Sprintf("<!DOCTYPE html>\n<html><head><title>%d %s</title></head><body><h1>%d %s</h1><pre>%s</pre></body></html>",
+			code, http.StatusText(code), code, http.StatusText(code), template.HTMLEscapeString(msg))))
+		return
 	}
+
 	b, _ := json.Marshal(map[string]any{"code": code, "msg": msg})
+	res.SetHeader("Content-Type", "application/json")
+	res.WriteHeader(code)
 	res.Writer.Write(b)
 }
 
+func acceptsHtml(req *HttpRequest) bool {
+	var accept = req.GetHeader("Accept")
+	return strings.Contains(accept, "text/html") && !strings.Contains(accept, "application/json") && !req.IsAjax()
+}
+
 func (this *server) InjectRouteController(controller any) {
 	var (
 		objt = reflect.TypeOf(controller).Elem()
@@ -471,15 +452,14 @@ func (this *server) assigTemplate(objt reflect.Type, objv reflect.Value, name st
 		log.Panicf("Template of %s must be ptr to struct template.Template", name)
 	}
 
-	if nil != this.app.templateFuncs {
-		for n, f := range this.app.templateFuncs {
-			tplBuiltins[n] = f
-		}
+	var funcs = this.app.tplBuiltins()
+	for n, f := range this.app.templateFuncs {
+		funcs[n] = f
 	}
 
-	this.app.template = template.New("WgoTemplateEngine").Funcs(tplBuiltins)
+	this.app.template = template.New("WgoTemplateEngine").Funcs(funcs)
 	if len(this.app.templatePath) > 0 {
-		this.app.template = template.Must(this.app.template.ParseGlob(this.app.templatePath))
+		this.app.template = template.Must(this.app.template.ParseGlob(this.app.path(this.app.templatePath)))
 	}
 
 	src := reflect.ValueOf(this.app.template)
@@ -490,134 +470,6 @@ func (this *server) assigTemplate(objt reflect.Type, objv reflect.Value, name st
 	dst.Set(src)
 }
 
-func convertParam2Value(value string, typ string) any {
-	var (
-		val any
-		e   error
-	)
-	switch typ {
-	case "int":
-		val, e = strconv.Atoi(value)
-		if e != nil {
-			val = 0
-		}
-	case "int64":
-		val, e = strconv.ParseInt(value, 10, 64)
-		if e != nil {
-			val = int64(0)
-		}
-	case "uint64":
-		val, e = strconv.ParseUint(value, 10, 64)
-		if e != nil {
-			val = uint64(0)
-		}
-	case "float64":
-		val, e = strconv.ParseFloat(value, 64)
-		if e != nil {
-			val = float64(0)
-		}
-	case "string":
-		val = value
-	case "bool":
-		val, e = strconv.ParseBool(value)
-		if e != nil {
-			val = false
-		}
-	}
-	return val
-}
-
-func convertAny2Value(value any, typ string) any {
-	if nil == value {
-		switch typ {
-		case "int":
-			return 0
-		case "int64":
-			return int64(0)
-		case "uint64":
-			return uint64(0)
-		case "float64":
-			return float64(0)
-		case "string":
-			return ""
-		default:
-			return nil
-		}
-	}
-	var (
-		val any
-		e   error
-	)
-	switch typ {
-	case "int":
-		v, ok := value.(float64)
-		if ok {
-			val = int(v)
-		} else {
-			s, yes := value.(string)
-			if yes {
-				if val, e = strconv.Atoi(s); e != nil {
-					val = 0
-				}
-			} else {
-				val = 0
-			}
-		}
-	case "int64":
-		v, ok := value.(float64)
-		if ok {
-			val = int64(v)
-		} else {
-			s, yes := value.(string)
-			if yes {
-				if val, e = strconv.ParseInt(s, 10, 64); e != nil {
-					val = int64(0)
-				}
-			} else {
-				val = int64(0)
-			}
-		}
-	case "uint64":
-		v, ok := value.(float64)
-		if ok {
-			val = uint64(v)
-		} else {
-			s, yes := value.(string)
-			if yes {
-				if val, e = strconv.ParseUint(s, 10, 64); e != nil {
-					val = uint64(0)
-				}
-			} else {
-				val = uint64(0)
-			}
-		}
-	case "float64":
-		v, ok := value.(float64)
-		if ok {
-			val = v
-		} else {
-			s, yes := value.(string)
-			if yes {
-				if val, e = strconv.ParseFloat(s, 64); e != nil {
-					val = float64(0)
-				}
-			} else {
-				val = float64(0)
-			}
-		}
-	case "string":
-		v, ok := value.(string)
-		if ok {
-			val = v
-		} else {
-			val = ""
-		}
-	default:
-		val = value
-	}
-	return val
-}
-
 type RequestControllerInjector interface {
 	InjectRequestController(router Router, cve reflect.Value, svc *service.Service)
 }
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/xiaocairen/wgo/mdb"
@@ -39,11 +40,13 @@ type Servicer struct {
 	tables []*table
 }
 
+// NewServicer returns the process wide Servicer on the first call and nil on
+// the later ones.
 func NewServicer(db *mdb.DB) *Servicer {
 	var first = false
 	onceNewServicer.Do(func() {
 		first = true
-		servicerInst = &Servicer{db: db}
+		servicerInst = Open(db)
 	})
 
 	if first {
@@ -53,12 +56,22 @@ func NewServicer(db *mdb.DB) *Servicer {
 	}
 }
 
+// Open returns a new Servicer of db on every call.
+func Open(db *mdb.DB) *Servicer {
+	return &Servicer{db: db}
+}
+
 func (s *Servicer) Registe(tc TableCollection) {
 	if len(s.tables) == 0 && nil != tc {
 		tc.call(&TableRegister{svcer: s})
 	}
 }
 
+// Close closes the database pools of the Servicer.
+func (s *Servicer) Close() error {
+	return s.db.Close()
+}
+
 func (s *Servicer) New() *Service {
 	c, e := s.db.GetConn()
 	return &Service{
@@ -73,6 +86,7 @@ func (s *Servicer) New() *Service {
 
 // Service
 type Service struct {
+	ctx    context.Context
 	db     *mdb.DB
 	conn   *mdb.Conn
 	tx     *mdb.Tx
@@ -85,8 +99,9 @@ type Service struct {
 func (s *Service) NewService() *Service {
 	c, e := s.db.GetConn()
 	return &Service{
+		ctx:    s.ctx,
 		db:     s.db,
-		conn:   c,
+		conn:   s.bind(c),
 		tx:     nil,
 		in:     false,
 		tables: s.tables,
@@ -97,8 +112,9 @@ func (s *Service) NewService() *Service {
 func (s *Service) NewServiceByHostname(hostDbame string) *Service {
 	c, e := s.db.GetConnByName(hostDbame)
 	return &Service{
+		ctx:    s.ctx,
 		db:     s.db,
-		conn:   c,
+		conn:   s.bind(c),
 		tx:     nil,
 		in:     false,
 		tables: s.tables,
@@ -109,8 +125,9 @@ func (s *Service) NewServiceByHostname(hostDbame string) *Service {
 func (s *Service) NewConnService(config *mdb.DBConfig) *Service {
 	c, e := s.db.NewConn(config)
 	return &Service{
+		ctx:    s.ctx,
 		db:     s.db,
-		conn:   c,
+		conn:   s.bind(c),
 		tx:     nil,
 		in:     false,
 		tables: s.tables,
@@ -125,8 +142,36 @@ func (s *Service) Conn() *mdb.Conn {
 	return s.conn
 }
 
+// Err returns the error of getting the connection, Conn panics with it.
+func (s *Service) Err() error {
+	return s.err
+}
+
 func (s *Service) SelectDbHost(hostname string) {
 	s.conn, s.err = s.db.GetConnByName(hostname)
+	s.conn = s.bind(s.conn)
+}
+
+// SetContext binds the queries and transactions of the Service, and of the
+// Services created from it, to ctx. the Service of an action is bound to the
+// request context.
+func (s *Service) SetContext(ctx context.Context) {
+	s.ctx = ctx
+	s.conn = s.bind(s.conn)
+}
+
+func (s *Service) Context() context.Context {
+	if nil == s.ctx {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *Service) bind(c *mdb.Conn) *mdb.Conn {
+	if nil == c || nil == s.ctx {
+		return c
+	}
+	return c.WithContext(s.ctx)
 }
 
 func (s *Service) Begin() {
@@ -0,0 +1,515 @@
+package wgo
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaocairen/wgo/tool"
+)
+
+// sessionConfig is the "session" section of app.json, the timeouts are
+// seconds
+//
+//	"session": {
+//	  "secret": "a long random string",
+//	  "cookie_name": "wgo_session",
+//	  "idle_timeout": 1800,
+//	  "absolute_timeout": 86400,
+//	  "encrypt": false,
+//	  "secure": false,
+//	  "domain": "",
+//	  "store": "memory",
+//	  "table": "wgo_session",
+//	  "db": ""
+//	}
+//
+// the cookie holds the session id signed with the secret, encrypted too when
+// encrypt is true. a session expires when it is not used for idle_timeout,
+// or absolute_timeout after it was created, 0 means no such limit. store is
+// memory, cookie, which keeps the whole session encrypted in the cookie, or
+// mysql, the table of the database named by db, the default one when empty.
+// without secret a random one is used, the sessions don't outlive the process.
+// the cookie takes the defaults of the cookie section for domain and secure.
+type sessionConfig struct {
+	Secret          string `json:"secret"`
+	CookieName      string `json:"cookie_name"`
+	IdleTimeout     *int   `json:"idle_timeout"`
+	AbsoluteTimeout *int   `json:"absolute_timeout"`
+	Encrypt         bool   `json:"encrypt"`
+	Secure          bool   `json:"secure"`
+	Domain          string `json:"domain"`
+	Store           string `json:"store"`
+	Table           string `json:"table"`
+	DB              string `json:"db"`
+}
+
+func (this *app) getSessionConfig() *sessionConfig {
+	var c sessionConfig
+	if _, err := this.configurator.Get("session"); nil == err {
+		if err = this.configurator.GetStruct("session", &c); err != nil {
+			panic(err)
+		}
+	}
+	if "" == c.CookieName {
+		c.CookieName = "wgo_session"
+	}
+	if "" == c.Store {
+		c.Store = "memory"
+	}
+	if "" == c.Table {
+		c.Table = "wgo_session"
+	}
+	return &c
+}
+
+// SessionStore keeps the server side sessions. Load returns nil without
+// error when there is no session of the id. Expires of the data tells when
+// the store may forget it.
+type SessionStore interface {
+	Load(ctx context.Context, id string) (*SessionData, error)
+	Save(ctx context.Context, id string, data *SessionData) error
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionData is what a SessionStore keeps of a session, the values are json.
+type SessionData struct {
+	Values   map[string]json.RawMessage `json:"v"`
+	Created  time.Time                  `json:"c"`
+	Accessed time.Time                  `json:"a"`
+	Expires  time.Time                  `json:"e"`
+}
+
+// SetSessionStore replaces the store of the session section.
+func (this *app) SetSessionStore(store SessionStore) *app {
+	if nil == this.sessionStore {
+		this.sessionStore = store
+	}
+	return this
+}
+
+// sessions loads and saves the sessions of an app.
+type sessions struct {
+	logger   *log.Logger
+	store    SessionStore
+	name     string
+	idle     time.Duration
+	absolute time.Duration
+	secure   bool
+	domain   string
+	signKey  []byte
+	encKey   []byte
+}
+
+func (this *app) newSessions() (*sessions, error) {
+	var (
+		c = this.getSessionConfig()
+		s = &sessions{
+			logger:   this.logger,
+			store:    this.sessionStore,
+			name:     c.CookieName,
+			idle:     seconds(c.IdleTimeout, 1800),
+			absolute: seconds(c.AbsoluteTimeout, 86400),
+			secure:   c.Secure,
+			domain:   c.Domain,
+		}
+		secret = c.Secret
+	)
+	if "" == secret {
+		var b = make([]byte, 32)
+		rand.Read(b)
+		secret = string(b)
+		if "memory" != c.Store || nil != this.sessionStore {
+			this.logger.Printf("session secret is not set, the sessions are lost on restart")
+		}
+	}
+	s.signKey = deriveKey(secret, "wgo session sign")
+	if c.Encrypt || "cookie" == c.Store {
+		s.encKey = deriveKey(secret, "wgo session encrypt")
+	}
+
+	if nil == s.store {
+		switch c.Store {
+		case "memory":
+			s.store = NewMemorySessionStore()
+		case "cookie":
+			s.store = CookieSessionStore{}
+		case "mysql":
+			var svc = this.servicer.New()
+			if "" != c.DB {
+				svc = svc.NewServiceByHostname(c.DB)
+			}
+			if e := svc.Err(); e != nil {
+				return nil, fmt.Errorf("mysql session store: %w", e)
+			}
+			s.store = NewMysqlSessionStore(svc.Conn(), c.Table)
+		default:
+			log.Panicf("unknown session store '%s'", c.Store)
+		}
+	}
+	if _, ok := s.store.(CookieSessionStore); ok && nil == s.encKey {
+		s.encKey = deriveKey(secret, "wgo session encrypt")
+	}
+	return s, nil
+}
+
+func deriveKey(secret, purpose string) []byte {
+	var m = hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(purpose))
+	return m.Sum(nil)
+}
+
+// seal signs a cookie value, which is encrypted first when the encryption key
+// is set. the signature covers the cookie name, a value can't be moved to
+// another cookie.
+func (s *sessions) seal(value []byte) (string, error) {
+	var payload = base64.RawURLEncoding.EncodeToString(value)
+	if nil != s.encKey {
+		var iv = make([]byte, 16)
+		if _, e := rand.Read(iv); e != nil {
+			return "", e
+		}
+		enc, e := tool.Encrypt(value, s.encKey, iv)
+		if e != nil {
+			return "", e
+		}
+		payload = base64.RawURLEncoding.EncodeToString(iv) + ":" + enc
+	}
+	return payload + "." + s.sign(payload), nil
+}
+
+func (s *sessions) open(cookie string) ([]byte, bool) {
+	var n = strings.LastIndexByte(cookie, '.')
+	if n < 0 || 1 != subtle.ConstantTimeCompare([]byte(cookie[n+1:]), []byte(s.sign(cookie[:n]))) {
+		return nil, false
+	}
+	var payload = cookie[:n]
+	if nil == s.encKey {
+		b, e := base64.RawURLEncoding.DecodeString(payload)
+		return b, nil == e
+	}
+
+	ivs, enc, ok := strings.Cut(payload, ":")
+	if !ok {
+		return nil, false
+	}
+	iv, e := base64.RawURLEncoding.DecodeString(ivs)
+	if e != nil || 16 != len(iv) {
+		return nil, false
+	}
+	b, e := tool.Decrypt(enc, s.encKey, iv)
+	return b, nil == e
+}
+
+func (s *sessions) sign(payload string) string {
+	var m = hmac.New(sha256.New, s.signKey)
+	m.Write([]byte(s.name + "|" + payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// expired reports whether the session is over its idle or absolute timeout.
+func (s *sessions) expired(d *SessionData, now time.Time) bool {
+	return (s.idle > 0 && now.Sub(d.Accessed) > s.idle) || (s.absolute > 0 && now.Sub(d.Created) > s.absolute)
+}
+
+func (s *sessions) expires(d *SessionData) time.Time {
+	var t time.Time
+	if s.idle > 0 {
+		t = d.Accessed.Add(s.idle)
+	}
+	if s.absolute > 0 {
+		if end := d.Created.Add(s.absolute); t.IsZero() || end.Before(t) {
+			t = end
+		}
+	}
+	return t
+}
+
+// Session is the session of a request, it is saved and its cookie sent
+// before the response header is written. values are stored as json.
+type Session struct {
+	mu        sync.Mutex
+	mgr       *sessions
+	req       *HttpRequest
+	res       *HttpResponse
+	id        string
+	data      *SessionData
+	isNew     bool
+	dirty     bool
+	destroyed bool
+	committed bool
+}
+
+// Session returns the session of the request, a new one when the request has
+// none or it has expired.
+func (this *WgoController) Session() *Session {
+	return GetSession(this.Response, this.Request)
+}
+
+// GetSession returns the session of a request for the middlewares.
+func GetSession(w *HttpResponse, r *HttpRequest) *Session {
+	if nil != w.session {
+		return w.session
+	}
+	if nil == r.sessions {
+		log.Panic("sessions are not available before Run")
+	}
+
+	var s = &Session{mgr: r.sessions, req: r, res: w}
+	s.load()
+	w.session = s
+	if rw, ok := w.Writer.(*responseWriter); ok {
+		rw.beforeWrite = append(rw.beforeWrite, s.commit)
+	}
+	return s
+}
+
+func (s *Session) load() {
+	var now = time.Now()
+	if c, e := s.req.Request.Cookie(s.mgr.name); nil == e {
+		if value, ok := s.mgr.open(c.Value); ok {
+			var (
+				data *SessionData
+				err  error
+			)
+			if _, inCookie := s.mgr.store.(CookieSessionStore); inCookie {
+				var cs cookieSession
+				if nil == json.Unmarshal(value, &cs) && "" != cs.ID {
+					s.id, data = cs.ID, cs.Data
+				}
+			} else {
+				s.id = string(value)
+				if data, err = s.mgr.store.Load(s.req.Context(), s.id); err != nil {
+					logf(s.mgr.logger, "load session: %s", err)
+				}
+			}
+			if nil != data && s.mgr.expired(data, now) {
+				if _, inCookie := s.mgr.store.(CookieSessionStore); !inCookie {
+					s.mgr.store.Delete(s.req.Context(), s.id)
+				}
+				data = nil
+			}
+			if nil != data {
+				if nil == data.Values {
+					data.Values = map[string]json.RawMessage{}
+				}
+				s.data = data
+				return
+			}
+		}
+	}
+
+	s.id = newSessionID()
+	s.data = &SessionData{Values: map[string]json.RawMessage{}, Created: now, Accessed: now}
+	s.isNew = true
+}
+
+func newSessionID() string {
+	var b = make([]byte, 32)
+	if _, e := rand.Read(b); e != nil {
+		log.Panic(e)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ID returns the id of the session, it changes with Regenerate.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// IsNew reports whether the session was created by this request.
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isNew
+}
+
+// Get decodes the value of key into out, it reports whether there was one.
+func (s *Session) Get(key string, out any) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data.Values[key]
+	return ok && nil == json.Unmarshal(v, out)
+}
+
+func (s *Session) GetString(key string) string {
+	var v string
+	s.Get(key, &v)
+	return v
+}
+
+func (s *Session) GetInt(key string) int64 {
+	var v int64
+	s.Get(key, &v)
+	return v
+}
+
+func (s *Session) Has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.data.Values[key]
+	return ok
+}
+
+// Set stores v, it fails when v can't be encoded as json.
+func (s *Session) Set(key string, v any) error {
+	b, e := json.Marshal(v)
+	if e != nil {
+		return e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revive()
+	s.data.Values[key] = b
+	s.dirty = true
+	return nil
+}
+
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data.Values[key]; ok {
+		delete(s.data.Values, key)
+		s.dirty = true
+	}
+}
+
+// Regenerate gives the session a new id and keeps its values, it should be
+// called when the user logs in so an id known before can't be used.
+func (s *Session) Regenerate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revive()
+	if !s.isNew {
+		if e := s.mgr.store.Delete(s.req.Context(), s.id); e != nil {
+			return e
+		}
+	}
+	s.id = newSessionID()
+	s.isNew = true
+	s.dirty = true
+	return nil
+}
+
+// Destroy deletes the session and its cookie, a value set afterwards starts a
+// new one.
+func (s *Session) Destroy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var e error
+	if !s.isNew {
+		e = s.mgr.store.Delete(s.req.Context(), s.id)
+	}
+	var now = time.Now()
+	s.data = &SessionData{Values: map[string]json.RawMessage{}, Created: now, Accessed: now}
+	s.destroyed = true
+	s.dirty = false
+	return e
+}
+
+// revive starts a new session once the current one was destroyed.
+func (s *Session) revive() {
+	if s.destroyed {
+		s.destroyed = false
+		s.id = newSessionID()
+		s.isNew = true
+	}
+}
+
+const flashPrefix = "_flash:"
+
+// AddFlash adds a message read once by Flashes, like a notice shown after a
+// redirect.
+func (s *Session) AddFlash(key, msg string) {
+	var msgs []string
+	s.Get(flashPrefix+key, &msgs)
+	s.Set(flashPrefix+key, append(msgs, msg))
+}
+
+// Flashes returns the messages of key and removes them.
+func (s *Session) Flashes(key string) []string {
+	var msgs []string
+	if s.Get(flashPrefix+key, &msgs) {
+		s.Delete(flashPrefix + key)
+	}
+	return msgs
+}
+
+// commit saves the session and sets its cookie, once, before the header is
+// written. an untouched session is saved again only once a minute, or a
+// tenth of the idle timeout, to keep it from expiring.
+func (s *Session) commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.committed {
+		return
+	}
+	s.committed = true
+
+	var cookie = &http.Cookie{Name: s.mgr.name, Path: "/", Domain: s.mgr.domain, Secure: s.mgr.secure, HttpOnly: true, SameSite: http.SameSiteLaxMode}
+	if s.destroyed {
+		cookie.MaxAge = -1
+		s.res.WriteCookie(cookie)
+		return
+	}
+
+	var (
+		now   = time.Now()
+		touch = time.Minute
+	)
+	if s.mgr.idle > 0 && s.mgr.idle/10 < touch {
+		touch = s.mgr.idle / 10
+	}
+	if s.isNew && 0 == len(s.data.Values) {
+		return
+	}
+	if !s.dirty && now.Sub(s.data.Accessed) < touch {
+		return
+	}
+	s.data.Accessed = now
+	s.data.Expires = s.mgr.expires(s.data)
+
+	var (
+		value []byte
+		err   error
+	)
+	if _, inCookie := s.mgr.store.(CookieSessionStore); inCookie {
+		value, err = json.Marshal(cookieSession{ID: s.id, Data: s.data})
+	} else {
+		value, err = []byte(s.id), s.mgr.store.Save(s.req.Context(), s.id, s.data)
+	}
+	if err != nil {
+		logf(s.mgr.logger, "save session: %s", err)
+		return
+	}
+	if cookie.Value, err = s.mgr.seal(value); err != nil {
+		logf(s.mgr.logger, "save session: %s", err)
+		return
+	}
+	if len(cookie.Value) > 4000 {
+		logf(s.mgr.logger, "save session: cookie of %d bytes is too large", len(cookie.Value))
+		return
+	}
+	if !s.data.Expires.IsZero() {
+		cookie.Expires = s.data.Expires
+	}
+	s.res.WriteCookie(cookie)
+}
+
+// cookieSession is what the cookie of a CookieSessionStore holds.
+type cookieSession struct {
+	ID   string       `json:"i"`
+	Data *SessionData `json:"d"`
+}
@@ -0,0 +1,162 @@
+package wgo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaocairen/wgo/mdb"
+)
+
+// MemorySessionStore keeps the sessions in the memory of the process, the
+// expired ones are dropped as new ones are saved.
+type MemorySessionStore struct {
+	mu    sync.Mutex
+	m     map[string]memorySession
+	swept time.Time
+}
+
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{m: make(map[string]memorySession), swept: time.Now()}
+}
+
+func (s *MemorySessionStore) Load(_ context.Context, id string) (*SessionData, error) {
+	s.mu.Lock()
+	ms, ok := s.m[id]
+	s.mu.Unlock()
+	if !ok || (!ms.expires.IsZero() && time.Now().After(ms.expires)) {
+		return nil, nil
+	}
+	var data SessionData
+	if e := json.Unmarshal(ms.data, &data); e != nil {
+		return nil, e
+	}
+	return &data, nil
+}
+
+func (s *MemorySessionStore) Save(_ context.Context, id string, data *SessionData) error {
+	b, e := json.Marshal(data)
+	if e != nil {
+		return e
+	}
+
+	var now = time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[id] = memorySession{data: b, expires: data.Expires}
+	if now.Sub(s.swept) > time.Minute {
+		s.swept = now
+		for k, ms := range s.m {
+			if !ms.expires.IsZero() && now.After(ms.expires) {
+				delete(s.m, k)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	delete(s.m, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// CookieSessionStore keeps the whole session in its cookie, encrypted with
+// tool.Encrypt and signed, so nothing is stored on the server. the cookie
+// can't be over 4KB, and a destroyed session can't be revoked before it
+// expires, a copy of the cookie stays valid.
+type CookieSessionStore struct{}
+
+func (CookieSessionStore) Load(context.Context, string) (*SessionData, error) {
+	return nil, nil
+}
+
+func (CookieSessionStore) Save(context.Context, string, *SessionData) error {
+	return nil
+}
+
+func (CookieSessionStore) Delete(context.Context, string) error {
+	return nil
+}
+
+// MysqlSessionStore keeps the sessions in a table of this shape
+//
+//	CREATE TABLE wgo_session (
+//	  id VARCHAR(64) NOT NULL PRIMARY KEY,
+//	  data MEDIUMBLOB NOT NULL,
+//	  expires BIGINT NOT NULL,
+//	  KEY idx_expires (expires)
+//	) ENGINE=InnoDB;
+//
+// expires is a unix time, 0 when the session has no timeout. GC deletes the
+// expired rows, it is meant to be run by a ContextTasker. the sessions are read
+// from the read database of the Conn, give it the one of the write database
+// when the replicas lag.
+type MysqlSessionStore struct {
+	conn  *mdb.Conn
+	table string
+}
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+func NewMysqlSessionStore(conn *mdb.Conn, table string) *MysqlSessionStore {
+	if !tableName.MatchString(table) {
+		log.Panicf("invalid session table name '%s'", table)
+	}
+	return &MysqlSessionStore{conn: conn, table: "`" + strings.ReplaceAll(table, ".", "`.`") + "`"}
+}
+
+func (s *MysqlSessionStore) Load(ctx context.Context, id string) (*SessionData, error) {
+	var b []byte
+	e := s.conn.WithContext(ctx).QueryRow("SELECT data FROM "+s.table+" WHERE id = ? AND (expires = 0 OR expires > ?)", id, time.Now().Unix()).Scan(&b)
+	if errors.Is(e, sql.ErrNoRows) {
+		return nil, nil
+	} else if e != nil {
+		return nil, e
+	}
+
+	var data SessionData
+	if e = json.Unmarshal(b, &data); e != nil {
+		return nil, e
+	}
+	return &data, nil
+}
+
+func (s *MysqlSessionStore) Save(ctx context.Context, id string, data *SessionData) error {
+	b, e := json.Marshal(data)
+	if e != nil {
+		return e
+	}
+	var expires int64
+	if !data.Expires.IsZero() {
+		expires = data.Expires.Unix()
+	}
+	_, e = s.conn.WithContext(ctx).Exec("INSERT INTO "+s.table+" (id, data, expires) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE data = VALUES(data), expires = VALUES(expires)", id, b, expires)
+	return e
+}
+
+func (s *MysqlSessionStore) Delete(ctx context.Context, id string) error {
+	_, e := s.conn.WithContext(ctx).Exec("DELETE FROM "+s.table+" WHERE id = ?", id)
+	return e
+}
+
+// GC deletes the expired sessions and returns how many there were.
+func (s *MysqlSessionStore) GC(ctx context.Context) (int64, error) {
+	res, e := s.conn.WithContext(ctx).Exec("DELETE FROM "+s.table+" WHERE expires > 0 AND expires <= ?", time.Now().Unix())
+	if e != nil {
+		return 0, e
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,548 @@
+package wgo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaocairen/wgo/mdb"
+)
+
+type sessionController struct {
+	WgoController
+}
+
+func (this *sessionController) Get() []byte {
+	return []byte(this.Session().ID() + " " + this.Session().GetString("user"))
+}
+
+func (this *sessionController) Set() []byte {
+	this.Session().Set("user", this.Request.Get("v"))
+	return []byte(this.Session().ID())
+}
+
+func (this *sessionController) Big() []byte {
+	this.Session().Set("big", strings.Repeat("x", 5000))
+	return []byte("ok")
+}
+
+func (this *sessionController) Regenerate() []byte {
+	if e := this.Session().Regenerate(); e != nil {
+		return []byte(e.Error())
+	}
+	return []byte(this.Session().ID())
+}
+
+func (this *sessionController) Destroy() []byte {
+	this.Session().Destroy()
+	return []byte("ok")
+}
+
+func (this *sessionController) Flash() []byte {
+	this.Session().AddFlash("notice", this.Request.Get("v"))
+	return []byte("ok")
+}
+
+func (this *sessionController) Flashes() []byte {
+	return []byte(strings.Join(this.Session().Flashes("notice"), ","))
+}
+
+func newSessionTestServer(t *testing.T, conf map[string]any, store SessionStore) string {
+	var a = newTestApp(t, map[string]any{"session": conf})
+	if nil != store {
+		a.SetSessionStore(store)
+	}
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			for _, action := range []string{"Get", "Set", "Big", "Regenerate", "Destroy", "Flash", "Flashes"} {
+				m.Get("/"+strings.ToLower(action), &sessionController{}, action+"()")
+			}
+		})
+	})
+	return serveTestApp(t, a).URL
+}
+
+// sessionGet requests a path of the session server, it returns the body and
+// the session cookie the response set, nil when none.
+func sessionGet(t *testing.T, client *http.Client, target string) (string, *http.Cookie) {
+	t.Helper()
+	resp, e := client.Get(target)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if http.StatusOK != resp.StatusCode {
+		t.Fatalf("%s = %d %s", target, resp.StatusCode, b)
+	}
+	for _, c := range resp.Cookies() {
+		if "wgo_session" == c.Name {
+			return string(b), c
+		}
+	}
+	return string(b), nil
+}
+
+func TestSessionSeal(t *testing.T) {
+	var plain = &sessions{name: "wgo_session", signKey: deriveKey("secret", "wgo session sign")}
+	var encrypted = *plain
+	encrypted.encKey = deriveKey("secret", "wgo session encrypt")
+
+	for _, c := range []struct {
+		name string
+		s    *sessions
+	}{{"signed", plain}, {"encrypted", &encrypted}} {
+		t.Run(c.name, func(t *testing.T) {
+			cookie, e := c.s.seal([]byte("the session id"))
+			if e != nil {
+				t.Fatal(e)
+			}
+			if v, ok := c.s.open(cookie); !ok || "the session id" != string(v) {
+				t.Fatalf("open = %q %v", v, ok)
+			}
+			if nil != c.s.encKey && strings.Contains(cookie, "dGhlIHNlc3Npb24gaWQ") {
+				t.Fatalf("the value is readable in %s", cookie)
+			}
+
+			var (
+				n         = strings.LastIndexByte(cookie, '.')
+				renamed   = *c.s
+				resecret  = *c.s
+				flip      = func(s string, i int) string { return s[:i] + string(s[i]^1) + s[i+1:] }
+				tampereds = map[string]string{
+					"payload":   flip(cookie, 0),
+					"signature": flip(cookie, len(cookie)-1),
+					"no dot":    strings.ReplaceAll(cookie, ".", ""),
+					"empty":     "",
+				}
+			)
+			renamed.name = "other_cookie"
+			resecret.signKey = deriveKey("another secret", "wgo session sign")
+			for name, v := range tampereds {
+				if _, ok := c.s.open(v); ok {
+					t.Errorf("%s tampered: accepted", name)
+				}
+			}
+			if _, ok := renamed.open(cookie); ok {
+				t.Error("the value was accepted by another cookie")
+			}
+			if _, ok := resecret.open(cookie); ok {
+				t.Error("the value was accepted with another secret")
+			}
+			if _, ok := c.s.open(cookie[:n] + "." + c.s.sign(cookie[:n]+"x")); ok {
+				t.Error("the signature of another payload was accepted")
+			}
+		})
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	var (
+		now = time.Now()
+		s   = &sessions{idle: 30 * time.Minute, absolute: 24 * time.Hour}
+	)
+	for _, c := range []struct {
+		name     string
+		created  time.Duration
+		accessed time.Duration
+		expired  bool
+		expires  time.Time
+	}{
+		{"fresh", 0, 0, false, now.Add(30 * time.Minute)},
+		{"idle", -time.Hour, -31 * time.Minute, true, now.Add(-time.Minute)},
+		{"used", -23 * time.Hour, -time.Minute, false, now.Add(29 * time.Minute)},
+		{"absolute", -25 * time.Hour, 0, true, now.Add(-time.Hour)},
+		{"near the absolute end", -(24*time.Hour - 10*time.Minute), 0, false, now.Add(10 * time.Minute)},
+	} {
+		var d = &SessionData{Created: now.Add(c.created), Accessed: now.Add(c.accessed)}
+		if got := s.expired(d, now); c.expired != got {
+			t.Errorf("%s: expired = %v", c.name, got)
+		}
+		if got := s.expires(d); !c.expires.Equal(got) {
+			t.Errorf("%s: expires = %s, want %s", c.name, got, c.expires)
+		}
+	}
+
+	var forever = &sessions{}
+	if d := (&SessionData{Created: now.Add(-1000 * time.Hour), Accessed: now.Add(-1000 * time.Hour)}); forever.expired(d, now) || !forever.expires(d).IsZero() {
+		t.Error("a session without timeouts expired")
+	}
+}
+
+func TestSession(t *testing.T) {
+	var (
+		store  = NewMemorySessionStore()
+		base   = newSessionTestServer(t, map[string]any{"secret": "a secret of the tests"}, store)
+		client = newJarClient(t)
+		stored = func(id string) *SessionData {
+			d, e := store.Load(context.Background(), id)
+			if e != nil {
+				t.Fatal(e)
+			}
+			return d
+		}
+	)
+
+	if body, cookie := sessionGet(t, client, base+"/get"); nil != cookie || !strings.HasSuffix(body, " ") {
+		t.Fatalf("an empty session: %q %v", body, cookie)
+	}
+
+	id, cookie := sessionGet(t, client, base+"/set?v=ann")
+	if nil == cookie || !cookie.HttpOnly || nil == stored(id) {
+		t.Fatalf("set: cookie %v, stored %v", cookie, stored(id))
+	}
+	if body, _ := sessionGet(t, client, base+"/get"); id+" ann" != body {
+		t.Fatalf("get = %q", body)
+	}
+
+	t.Run("regenerate", func(t *testing.T) {
+		var old = cookie
+		newID, c := sessionGet(t, client, base+"/regenerate")
+		if newID == id || nil == c || nil != stored(id) || nil == stored(newID) {
+			t.Fatalf("regenerate: %s -> %s, old stored %v", id, newID, stored(id))
+		}
+		if body, _ := sessionGet(t, client, base+"/get"); newID+" ann" != body {
+			t.Fatalf("get = %q", body)
+		}
+		req, _ := http.NewRequest(GET, base+"/get", nil)
+		req.AddCookie(&http.Cookie{Name: old.Name, Value: old.Value})
+		if _, body := testGet(t, nil, req); strings.Contains(body, "ann") || strings.HasPrefix(body, id) {
+			t.Fatalf("the old id still works: %q", body)
+		}
+		id = newID
+	})
+
+	t.Run("flash", func(t *testing.T) {
+		sessionGet(t, client, base+"/flash?v=saved")
+		sessionGet(t, client, base+"/flash?v=again")
+		if body, _ := sessionGet(t, client, base+"/flashes"); "saved,again" != body {
+			t.Fatalf("flashes = %q", body)
+		}
+		if body, _ := sessionGet(t, client, base+"/flashes"); "" != body {
+			t.Fatalf("flashes read twice: %q", body)
+		}
+	})
+
+	t.Run("tampered cookie", func(t *testing.T) {
+		u, _ := url.Parse(base)
+		var c = client.Jar.Cookies(u)[0]
+		req, _ := http.NewRequest(GET, base+"/get", nil)
+		req.AddCookie(&http.Cookie{Name: c.Name, Value: string(c.Value[0]^1) + c.Value[1:]})
+		if _, body := testGet(t, nil, req); strings.Contains(body, "ann") {
+			t.Fatalf("a tampered cookie was accepted: %q", body)
+		}
+	})
+
+	for _, c := range []struct {
+		name     string
+		created  time.Duration
+		accessed time.Duration
+	}{
+		{"idle timeout", -time.Hour, -31 * time.Minute},
+		{"absolute timeout", -25 * time.Hour, -time.Minute},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			id, _ = sessionGet(t, client, base+"/set?v=ann")
+			var d = stored(id)
+			d.Created, d.Accessed = time.Now().Add(c.created), time.Now().Add(c.accessed)
+			store.Save(context.Background(), id, d)
+
+			if body, _ := sessionGet(t, client, base+"/get"); strings.HasPrefix(body, id) || strings.Contains(body, "ann") {
+				t.Fatalf("an expired session was loaded: %q", body)
+			}
+			if nil != stored(id) {
+				t.Fatal("the expired session was not deleted")
+			}
+		})
+	}
+
+	t.Run("destroy", func(t *testing.T) {
+		id, _ = sessionGet(t, client, base+"/set?v=ann")
+		_, c := sessionGet(t, client, base+"/destroy")
+		if nil == c || c.MaxAge >= 0 || nil != stored(id) {
+			t.Fatalf("destroy: cookie %v, stored %v", c, stored(id))
+		}
+		u, _ := url.Parse(base)
+		if 0 != len(client.Jar.Cookies(u)) {
+			t.Fatal("the cookie was not cleared")
+		}
+	})
+}
+
+func TestCookieSessionStore(t *testing.T) {
+	var (
+		base   = newSessionTestServer(t, map[string]any{"secret": "a secret of the tests", "store": "cookie"}, nil)
+		client = newJarClient(t)
+	)
+	id, cookie := sessionGet(t, client, base+"/set?v=ann")
+	if nil == cookie || strings.Contains(cookie.Value, "ann") {
+		t.Fatalf("cookie = %v", cookie)
+	}
+	if body, _ := sessionGet(t, client, base+"/get"); id+" ann" != body {
+		t.Fatalf("get = %q", body)
+	}
+
+	// a session over 4KB is not saved, the cookie of the client is kept.
+	if _, c := sessionGet(t, client, base+"/big"); nil != c {
+		t.Fatalf("a cookie of %d bytes was set", len(c.Value))
+	}
+	if body, _ := sessionGet(t, client, base+"/get"); id+" ann" != body {
+		t.Fatalf("get after the big session = %q", body)
+	}
+
+	// another app with another secret can't read the cookie.
+	var other = newSessionTestServer(t, map[string]any{"secret": "another secret", "store": "cookie"}, nil)
+	req, _ := http.NewRequest(GET, other+"/get", nil)
+	req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	if _, body := testGet(t, nil, req); strings.Contains(body, "ann") {
+		t.Fatalf("the cookie was read with another secret: %q", body)
+	}
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		now   = time.Now()
+		store = NewMemorySessionStore()
+	)
+	store.Save(ctx, "expired", &SessionData{Expires: now.Add(-time.Second)})
+	store.Save(ctx, "forever", &SessionData{})
+	store.Save(ctx, "alive", &SessionData{Expires: now.Add(time.Hour)})
+	if d, _ := store.Load(ctx, "expired"); nil != d {
+		t.Fatal("an expired session was loaded")
+	}
+	if d, _ := store.Load(ctx, "alive"); nil == d {
+		t.Fatal("a session was lost")
+	}
+	if 3 != len(store.m) {
+		t.Fatalf("swept before a minute: %d sessions", len(store.m))
+	}
+
+	store.swept = now.Add(-2 * time.Minute)
+	store.Save(ctx, "new", &SessionData{Expires: now.Add(time.Hour)})
+	if _, ok := store.m["expired"]; ok || 3 != len(store.m) {
+		t.Fatalf("after the sweep: %v", store.m)
+	}
+
+	store.Delete(ctx, "alive")
+	if d, _ := store.Load(ctx, "alive"); nil != d {
+		t.Fatal("a deleted session was loaded")
+	}
+}
+
+// stubDB is a database of the stub driver, it runs the queries of
+// MysqlSessionStore on a map and records them.
+type stubDB struct {
+	mu      sync.Mutex
+	rows    map[string]stubRow
+	queries []string
+}
+
+type stubRow struct {
+	data    []byte
+	expires int64
+}
+
+var stubDBs sync.Map
+
+type stubDriver struct{}
+
+func (stubDriver) Open(dsn string) (driver.Conn, error) {
+	var name = dsn[strings.LastIndexByte(dsn, '/')+1:]
+	db, ok := stubDBs.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("no stub database %s", name)
+	}
+	return &stubConn{db.(*stubDB)}, nil
+}
+
+type stubConn struct {
+	db *stubDB
+}
+
+func (c *stubConn) Prepare(query string) (driver.Stmt, error) {
+	return &stubStmt{c.db, query}, nil
+}
+
+func (c *stubConn) Close() error {
+	return nil
+}
+
+func (c *stubConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("no transactions")
+}
+
+type stubStmt struct {
+	db    *stubDB
+	query string
+}
+
+func (s *stubStmt) Close() error {
+	return nil
+}
+
+func (s *stubStmt) NumInput() int {
+	return strings.Count(s.query, "?")
+}
+
+func (s *stubStmt) Exec(args []driver.Value) (driver.Result, error) {
+	var db = s.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries = append(db.queries, s.query)
+
+	switch {
+	case strings.HasPrefix(s.query, "INSERT INTO"):
+		db.rows[args[0].(string)] = stubRow{data: args[1].([]byte), expires: args[2].(int64)}
+		return driver.RowsAffected(1), nil
+	case strings.HasSuffix(s.query, "WHERE id = ?"):
+		if _, ok := db.rows[args[0].(string)]; ok {
+			delete(db.rows, args[0].(string))
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+	case strings.HasSuffix(s.query, "WHERE expires > 0 AND expires <= ?"):
+		var n int64
+		for id, r := range db.rows {
+			if r.expires > 0 && r.expires <= args[0].(int64) {
+				delete(db.rows, id)
+				n++
+			}
+		}
+		return driver.RowsAffected(n), nil
+	}
+	return nil, fmt.Errorf("unexpected query %s", s.query)
+}
+
+func (s *stubStmt) Query(args []driver.Value) (driver.Rows, error) {
+	var db = s.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries = append(db.queries, s.query)
+
+	if !strings.HasSuffix(s.query, "WHERE id = ? AND (expires = 0 OR expires > ?)") {
+		return nil, fmt.Errorf("unexpected query %s", s.query)
+	}
+	var rows = &stubRows{}
+	if r, ok := db.rows[args[0].(string)]; ok && (0 == r.expires || r.expires > args[1].(int64)) {
+		rows.data = append(rows.data, r.data)
+	}
+	return rows, nil
+}
+
+type stubRows struct {
+	data [][]byte
+}
+
+func (r *stubRows) Columns() []string {
+	return []string{"data"}
+}
+
+func (r *stubRows) Close() error {
+	return nil
+}
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if 0 == len(r.data) {
+		return io.EOF
+	}
+	dest[0], r.data = r.data[0], r.data[1:]
+	return nil
+}
+
+var registerStub sync.Once
+
+func newStubConn(t *testing.T) (*mdb.Conn, *stubDB) {
+	registerStub.Do(func() { sql.Register("wgo_stub", stubDriver{}) })
+	var (
+		name = strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+		sdb  = &stubDB{rows: make(map[string]stubRow)}
+	)
+	stubDBs.Store(name, sdb)
+	db, e := mdb.Open([]*mdb.DBConfig{{Driver: "wgo_stub", Host: "stub", Port: 3306, Dbname: name}}, false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { db.Close() })
+	conn, e := db.GetConn()
+	if e != nil {
+		t.Fatal(e)
+	}
+	return conn, sdb
+}
+
+func TestMysqlSessionStore(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		now        = time.Now()
+		conn, sdb  = newStubConn(t)
+		store      = NewMysqlSessionStore(conn, "app.wgo_session")
+		data       = &SessionData{Values: map[string]json.RawMessage{"user": json.RawMessage(`"ann"`)}, Created: now, Accessed: now, Expires: now.Add(time.Hour)}
+		expiredOne = &SessionData{Values: map[string]json.RawMessage{}, Expires: now.Add(-time.Minute)}
+	)
+
+	if e := store.Save(ctx, "a", data); e != nil {
+		t.Fatal(e)
+	}
+	if e := store.Save(ctx, "forever", &SessionData{}); e != nil {
+		t.Fatal(e)
+	}
+	if e := store.Save(ctx, "expired", expiredOne); e != nil {
+		t.Fatal(e)
+	}
+	if 0 != sdb.rows["forever"].expires || data.Expires.Unix() != sdb.rows["a"].expires {
+		t.Fatalf("expires = %d %d", sdb.rows["forever"].expires, sdb.rows["a"].expires)
+	}
+
+	d, e := store.Load(ctx, "a")
+	if e != nil || nil == d || `"ann"` != string(d.Values["user"]) {
+		t.Fatalf("load = %v %v", d, e)
+	}
+	for _, id := range []string{"expired", "missing"} {
+		if d, e = store.Load(ctx, id); e != nil || nil != d {
+			t.Fatalf("load of %s = %v %v", id, d, e)
+		}
+	}
+
+	if n, e := store.GC(ctx); e != nil || 1 != n {
+		t.Fatalf("gc = %d %v", n, e)
+	}
+	if e = store.Delete(ctx, "a"); e != nil {
+		t.Fatal(e)
+	}
+	if 1 != len(sdb.rows) {
+		t.Fatalf("rows = %v", sdb.rows)
+	}
+	for _, q := range sdb.queries {
+		if !strings.Contains(q, " `app`.`wgo_session` ") {
+			t.Errorf("query of another table: %s", q)
+		}
+	}
+
+	for _, table := range []string{"wgo_session; DROP TABLE users", "a.b.c", "`x`", ""} {
+		func() {
+			defer func() {
+				if nil == recover() {
+					t.Errorf("table %q was accepted", table)
+				}
+			}()
+			NewMysqlSessionStore(conn, table)
+		}()
+	}
+}
+
+func TestMysqlSessionStoreWithoutDB(t *testing.T) {
+	var a = newTestApp(t, map[string]any{"session": map[string]any{"store": "mysql", "secret": "s"}})
+	if _, e := a.build(); nil == e || !strings.Contains(e.Error(), "mysql session store") {
+		t.Fatalf("build = %v, want the error of the mysql session store", e)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package wgo
+
+import (
+	"os"
+)
+
+var upgradeSignals []os.Signal
+
+func isUpgradeSignal(s os.Signal) bool {
+	return false
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package wgo
+
+import (
+	"os"
+	"syscall"
+)
+
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
+
+func isUpgradeSignal(s os.Signal) bool {
+	return syscall.SIGUSR2 == s
+}
@@ -0,0 +1,185 @@
+package wgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSSEClosed is returned by the SSEWriter methods once the client has gone
+// away or the action has returned.
+var ErrSSEClosed = errors.New("sse stream closed")
+
+// EventStream is returned by an action to send server-sent events, the
+// stream ends when the function returns.
+type EventStream func(s *SSEWriter) error
+
+// SSEWriter writes server-sent events. every event is flushed as it is sent,
+// and a comment line is sent when nothing else was for the heartbeat
+// interval, 15s by default, to keep proxies from closing the connection.
+type SSEWriter struct {
+	mu        sync.Mutex
+	w         http.ResponseWriter
+	rc        *http.ResponseController
+	ctx       context.Context
+	lastID    string
+	heartbeat time.Duration
+	last      time.Time
+	closed    bool
+	done      chan struct{}
+}
+
+// SSE starts a text/event-stream response and returns its writer, the action
+// sends the events then returns. the write timeout of the server does not
+// apply to the stream.
+func (this *WgoController) SSE() *SSEWriter {
+	return this.Response.sse(this.Request)
+}
+
+func (r *HttpResponse) sse(req *HttpRequest) *SSEWriter {
+	if nil != r.sseWriter {
+		return r.sseWriter
+	}
+
+	var h = r.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+
+	var s = &SSEWriter{
+		w:         r.Writer,
+		rc:        http.NewResponseController(r.Writer),
+		ctx:       req.Context(),
+		lastID:    req.GetHeader("Last-Event-ID"),
+		heartbeat: 15 * time.Second,
+		last:      time.Now(),
+		done:      make(chan struct{}),
+	}
+	s.rc.SetWriteDeadline(time.Time{})
+	r.WriteHeader(http.StatusOK)
+	s.rc.Flush()
+
+	r.sseWriter = s
+	go s.keepAlive()
+	return s
+}
+
+// LastEventID is the id of the last event the client got before it
+// reconnected, from the Last-Event-ID header, to resume from it.
+func (s *SSEWriter) LastEventID() string {
+	return s.lastID
+}
+
+// Context is done when the client goes away.
+func (s *SSEWriter) Context() context.Context {
+	return s.ctx
+}
+
+// Heartbeat sets the interval of the heartbeat, 0 stops it.
+func (s *SSEWriter) Heartbeat(d time.Duration) {
+	s.mu.Lock()
+	s.heartbeat = d
+	s.mu.Unlock()
+}
+
+// Retry tells the client how long to wait before reconnecting.
+func (s *SSEWriter) Retry(d time.Duration) error {
+	return s.write("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n")
+}
+
+// Send sends an event, event and id may be empty. data is sent as it is when
+// it is a string or []byte, other values are sent as json.
+func (s *SSEWriter) Send(event, id string, data any) error {
+	var payload string
+	switch v := data.(type) {
+	case string:
+		payload = v
+	case []byte:
+		payload = string(v)
+	default:
+		b, e := json.Marshal(v)
+		if e != nil {
+			return e
+		}
+		payload = string(b)
+	}
+
+	var b strings.Builder
+	if "" != event {
+		b.WriteString("event: " + sseLine(event) + "\n")
+	}
+	if "" != id {
+		b.WriteString("id: " + sseLine(id) + "\n")
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(payload, "\r\n", "\n"), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// sseLine keeps a field on one line.
+func sseLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+func (s *SSEWriter) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || nil != s.ctx.Err() {
+		return ErrSSEClosed
+	}
+	if _, e := io.WriteString(s.w, msg); e != nil {
+		return e
+	}
+	s.last = time.Now()
+	return s.rc.Flush()
+}
+
+func (s *SSEWriter) keepAlive() {
+	for {
+		s.mu.Lock()
+		var wait = s.heartbeat
+		if wait > 0 {
+			wait -= time.Since(s.last)
+		} else {
+			wait = time.Second
+		}
+		s.mu.Unlock()
+
+		var timer = time.NewTimer(wait)
+		select {
+		case <-s.done:
+			timer.Stop()
+			return
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.mu.Lock()
+		var due = s.heartbeat > 0 && time.Since(s.last) >= s.heartbeat
+		s.mu.Unlock()
+		if due {
+			s.write(": ping\n\n")
+		}
+	}
+}
+
+// close stops the heartbeat, nothing is written once it returns.
+func (s *SSEWriter) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
@@ -0,0 +1,157 @@
+package wgo
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type sseController struct {
+	WgoController
+}
+
+func (this *sseController) Events() EventStream {
+	return func(s *SSEWriter) error {
+		s.Retry(3 * time.Second)
+		s.Send("", "", "plain")
+		s.Send("tick", "1", []byte("a\nb"))
+		s.Send("user", "2\n", map[string]int{"id": 7})
+		return nil
+	}
+}
+
+func (this *sseController) Resume() EventStream {
+	return func(s *SSEWriter) error {
+		return s.Send("", "", "after "+s.LastEventID())
+	}
+}
+
+func (this *sseController) Live() {
+	var s = this.SSE()
+	s.Send("", "", "live")
+}
+
+func (this *sseController) Ping() EventStream {
+	return func(s *SSEWriter) error {
+		s.Heartbeat(20 * time.Millisecond)
+		<-s.Context().Done()
+		return s.Context().Err()
+	}
+}
+
+func (this *sseController) Fail() EventStream {
+	return func(s *SSEWriter) error {
+		return errors.New("gone")
+	}
+}
+
+func newSSETestApp(t *testing.T) string {
+	var (
+		a = newTestApp(t, nil)
+		c = &sseController{}
+	)
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Get("/events", c, "Events()")
+			m.Get("/resume", c, "Resume()")
+			m.Get("/live", c, "Live()")
+			m.Get("/ping", c, "Ping()")
+			m.Get("/fail", c, "Fail()")
+		})
+	})
+	return serveTestApp(t, a).URL
+}
+
+func TestSSE(t *testing.T) {
+	var url = newSSETestApp(t)
+
+	for _, c := range []struct {
+		name   string
+		path   string
+		lastID string
+		want   string
+	}{
+		{"events", "/events", "", "retry: 3000\n\ndata: plain\n\nevent: tick\nid: 1\ndata: a\ndata: b\n\nevent: user\nid: 2\ndata: {\"id\":7}\n\n"},
+		{"last event id", "/resume", "41", "data: after 41\n\n"},
+		{"SSE of the controller", "/live", "", "data: live\n\n"},
+		{"an error ends the stream", "/fail", "", ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(GET, url+c.path, nil)
+			if "" != c.lastID {
+				req.Header.Set("Last-Event-ID", c.lastID)
+			}
+			resp, e := http.DefaultClient.Do(req)
+			if e != nil {
+				t.Fatal(e)
+			}
+			defer resp.Body.Close()
+			if ct := resp.Header.Get("Content-Type"); "text/event-stream" != ct {
+				t.Fatalf("content type %q", ct)
+			}
+			if cc := resp.Header.Get("Cache-Control"); "no-cache" != cc {
+				t.Fatalf("cache control %q", cc)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			if c.want != string(b) {
+				t.Fatalf("got %q, want %q", b, c.want)
+			}
+		})
+	}
+}
+
+func TestSSEHeartbeat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, GET, newSSETestApp(t)+"/ping", nil)
+	resp, e := http.DefaultClient.Do(req)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer resp.Body.Close()
+
+	var (
+		r    = bufio.NewReader(resp.Body)
+		done = make(chan string, 1)
+	)
+	go func() {
+		line, _ := r.ReadString('\n')
+		done <- line
+	}()
+	select {
+	case line := <-done:
+		if ": ping\n" != line {
+			t.Fatalf("got %q, want a heartbeat", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no heartbeat")
+	}
+}
+
+func TestSSEClosed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var s = &SSEWriter{ctx: ctx, done: make(chan struct{})}
+	cancel()
+	if e := s.Send("", "", "x"); ErrSSEClosed != e {
+		t.Fatalf("send to a gone client = %v", e)
+	}
+
+	s = &SSEWriter{ctx: context.Background(), done: make(chan struct{})}
+	s.close()
+	s.close()
+	if e := s.Send("", "", "x"); ErrSSEClosed != e {
+		t.Fatalf("send after close = %v", e)
+	}
+}
+
+func TestSSELine(t *testing.T) {
+	for in, want := range map[string]string{"a": "a", "a\nb": "ab", "a\r\nb": "ab", "": ""} {
+		if got := sseLine(in); want != got {
+			t.Errorf("sseLine(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
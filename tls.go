@@ -0,0 +1,159 @@
+package wgo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// httpsConfig is the "https" section of app.json
+//
+//	"https": {
+//	  "enable": true,
+//	  "addr": "",
+//	  "port": 443,
+//	  "cert_file": "cert/server.crt",
+//	  "key_file": "cert/server.key",
+//	  "min_version": "1.2",
+//	  "client_ca_file": "cert/ca.crt",
+//	  "client_auth": "require_and_verify",
+//	  "http2": true,
+//	  "redirect_http": true,
+//	  "redirect_listen": ["http"]
+//	}
+//
+// the listeners of the "http" section keep serving the app, when redirect_http
+// is true the tcp ones named in redirect_listen only redirect to https. it
+// defaults to "http", the name of the listener of addr and port.
+//
+// client_auth is one of request, require, verify_if_given and
+// require_and_verify, it defaults to require_and_verify when client_ca_file
+// is set.
+type httpsConfig struct {
+	Enable         bool     `json:"enable"`
+	Addr           string   `json:"addr"`
+	Port           int      `json:"port"`
+	CertFile       string   `json:"cert_file"`
+	KeyFile        string   `json:"key_file"`
+	MinVersion     string   `json:"min_version"`
+	ClientCAFile   string   `json:"client_ca_file"`
+	ClientAuth     string   `json:"client_auth"`
+	Http2          *bool    `json:"http2"`
+	RedirectHttp   bool     `json:"redirect_http"`
+	RedirectListen []string `json:"redirect_listen"`
+}
+
+func (this *app) getHttpsConfig() *httpsConfig {
+	var c httpsConfig
+	if _, err := this.configurator.Get("https"); err != nil {
+		return nil
+	}
+	if err := this.configurator.GetStruct("https", &c); err != nil {
+		panic(err)
+	}
+	if !c.Enable {
+		return nil
+	}
+	if 0 == c.Port {
+		c.Port = 443
+	}
+	if 0 == len(c.RedirectListen) {
+		c.RedirectListen = []string{"http"}
+	}
+	c.CertFile = this.path(c.CertFile)
+	c.KeyFile = this.path(c.KeyFile)
+	c.ClientCAFile = this.path(c.ClientCAFile)
+	return &c
+}
+
+func newTLSConfig(c *httpsConfig) (*tls.Config, *certReloader, error) {
+	reloader := &certReloader{certFile: c.CertFile, keyFile: c.KeyFile}
+	if err := reloader.reload(); err != nil {
+		return nil, nil, err
+	}
+
+	conf := &tls.Config{GetCertificate: reloader.GetCertificate}
+	switch c.MinVersion {
+	case "", "1.2":
+		conf.MinVersion = tls.VersionTLS12
+	case "1.3":
+		conf.MinVersion = tls.VersionTLS13
+	case "1.1":
+		conf.MinVersion = tls.VersionTLS11
+	case "1.0":
+		conf.MinVersion = tls.VersionTLS10
+	default:
+		return nil, nil, fmt.Errorf("https min_version '%s' is invalid", c.MinVersion)
+	}
+
+	if "" != c.ClientCAFile {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		conf.ClientCAs = x509.NewCertPool()
+		if !conf.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificate found in https client_ca_file '%s'", c.ClientCAFile)
+		}
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	switch c.ClientAuth {
+	case "":
+	case "request":
+		conf.ClientAuth = tls.RequestClientCert
+	case "require":
+		conf.ClientAuth = tls.RequireAnyClientCert
+	case "verify_if_given":
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require_and_verify":
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, nil, fmt.Errorf("https client_auth '%s' is invalid", c.ClientAuth)
+	}
+
+	if nil == c.Http2 || *c.Http2 {
+		conf.NextProtos = []string{"h2", "http/1.1"}
+	} else {
+		conf.NextProtos = []string{"http/1.1"}
+	}
+	return conf, reloader, nil
+}
+
+// certReloader serves the certificate loaded last, reload is called again on
+// SIGHUP so a renewed certificate is used without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+func (cr *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	cr.cert.Store(&cert)
+	return nil
+}
+
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return cr.cert.Load(), nil
+}
+
+func redirectToHttps(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); nil == err {
+			host = h
+		}
+		if 443 != port {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,328 @@
+package wgo
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var testSerial int64
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, e := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if e != nil {
+		t.Fatal(e)
+	}
+	testSerial++
+	var tpl = &x509.Certificate{
+		SerialNumber:          big.NewInt(testSerial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, e := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the pem of a certificate of the CA and of its key, for a
+// server of localhost and 127.0.0.1, or for a client.
+func (ca *testCA) issue(t *testing.T, name string, client bool) ([]byte, []byte) {
+	t.Helper()
+	key, e := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if e != nil {
+		t.Fatal(e)
+	}
+	testSerial++
+	var tpl = &x509.Certificate{
+		SerialNumber: big.NewInt(testSerial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if client {
+		tpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	} else {
+		tpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tpl.DNSNames = []string{"localhost"}
+		tpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, e := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	kb, e := x509.MarshalECPrivateKey(key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb})
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	var p = x509.NewCertPool()
+	p.AddCert(ca.cert)
+	return p
+}
+
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	var file = filepath.Join(dir, name)
+	if e := os.WriteFile(file, data, 0600); e != nil {
+		t.Fatal(e)
+	}
+	return file
+}
+
+// serveTLS serves the handler over tls the way serve does, it returns the
+// address of the server.
+func serveTLS(t *testing.T, c *httpsConfig, handler http.Handler) (string, *certReloader) {
+	t.Helper()
+	conf, reloader, e := newTLSConfig(c)
+	if e != nil {
+		t.Fatal(e)
+	}
+	ln, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	var srv = &http.Server{Handler: handler, TLSConfig: conf, ErrorLog: log.New(io.Discard, "", 0)}
+	if nil != c.Http2 && !*c.Http2 {
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String(), reloader
+}
+
+func tlsClient(conf *tls.Config) *http.Client {
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: conf, ForceAttemptHTTP2: true, DisableKeepAlives: true}}
+}
+
+var hello = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	var name = "anonymous"
+	if len(r.TLS.PeerCertificates) > 0 {
+		name = r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	w.Write([]byte(r.Proto + " " + name))
+})
+
+func TestHTTPS(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		ca       = newTestCA(t, "test ca")
+		crt, key = ca.issue(t, "localhost", false)
+		base     = httpsConfig{CertFile: writeTestFile(t, dir, "server.crt", crt), KeyFile: writeTestFile(t, dir, "server.key", key)}
+		no       = false
+	)
+	for _, c := range []struct {
+		name  string
+		http2 *bool
+		want  string
+	}{{"http2", nil, "HTTP/2.0 anonymous"}, {"http1", &no, "HTTP/1.1 anonymous"}} {
+		t.Run(c.name, func(t *testing.T) {
+			var conf = base
+			conf.Http2 = c.http2
+			addr, _ := serveTLS(t, &conf, hello)
+			resp, e := tlsClient(&tls.Config{RootCAs: ca.pool()}).Get("https://" + addr + "/")
+			if e != nil {
+				t.Fatal(e)
+			}
+			defer resp.Body.Close()
+			b, _ := io.ReadAll(resp.Body)
+			if c.want != string(b) {
+				t.Fatalf("got %q, want %q", b, c.want)
+			}
+		})
+	}
+
+	t.Run("untrusted", func(t *testing.T) {
+		addr, _ := serveTLS(t, &base, hello)
+		if _, e := tlsClient(&tls.Config{RootCAs: newTestCA(t, "other ca").pool()}).Get("https://" + addr + "/"); nil == e {
+			t.Fatal("a certificate of another ca was accepted")
+		}
+	})
+}
+
+func TestHTTPSMinVersion(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		ca       = newTestCA(t, "test ca")
+		crt, key = ca.issue(t, "localhost", false)
+		conf     = httpsConfig{CertFile: writeTestFile(t, dir, "server.crt", crt), KeyFile: writeTestFile(t, dir, "server.key", key), MinVersion: "1.3"}
+	)
+	addr, _ := serveTLS(t, &conf, hello)
+	if _, e := tlsClient(&tls.Config{RootCAs: ca.pool(), MaxVersion: tls.VersionTLS12}).Get("https://" + addr + "/"); nil == e {
+		t.Fatal("tls 1.2 was accepted with min_version 1.3")
+	}
+	if _, e := tlsClient(&tls.Config{RootCAs: ca.pool(), MinVersion: tls.VersionTLS13}).Get("https://" + addr + "/"); e != nil {
+		t.Fatal(e)
+	}
+
+	conf.MinVersion = "1.4"
+	if _, _, e := newTLSConfig(&conf); nil == e {
+		t.Fatal("min_version 1.4 was accepted")
+	}
+}
+
+func TestHTTPSClientAuth(t *testing.T) {
+	var (
+		dir           = t.TempDir()
+		ca            = newTestCA(t, "test ca")
+		other         = newTestCA(t, "other ca")
+		crt, key      = ca.issue(t, "localhost", false)
+		ccrt, ckey    = ca.issue(t, "billing-job", true)
+		ocrt, okey    = other.issue(t, "intruder", true)
+		clientCert, _ = tls.X509KeyPair(ccrt, ckey)
+		otherCert, _  = tls.X509KeyPair(ocrt, okey)
+		caFile        = writeTestFile(t, dir, "ca.crt", ca.pem)
+		certFile      = writeTestFile(t, dir, "server.crt", crt)
+		keyFile       = writeTestFile(t, dir, "server.key", key)
+		withoutCert   = &tls.Config{RootCAs: ca.pool()}
+		withCert      = &tls.Config{RootCAs: ca.pool(), Certificates: []tls.Certificate{clientCert}}
+		withOtherCert = &tls.Config{RootCAs: ca.pool(), GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &otherCert, nil }}
+		emptyCA       = writeTestFile(t, dir, "empty.crt", []byte("no pem here"))
+		base          = httpsConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}
+	)
+
+	var cases = []struct {
+		name   string
+		auth   string
+		client *tls.Config
+		want   string
+	}{
+		{"default without cert", "", withoutCert, ""},
+		{"default with cert", "", withCert, "billing-job"},
+		{"default with cert of another ca", "", withOtherCert, ""},
+		{"verify_if_given without cert", "verify_if_given", withoutCert, "anonymous"},
+		{"verify_if_given with cert", "verify_if_given", withCert, "billing-job"},
+		{"verify_if_given with cert of another ca", "verify_if_given", withOtherCert, ""},
+		{"request with cert of another ca", "request", withOtherCert, "intruder"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var conf = base
+			conf.ClientAuth = c.auth
+			addr, _ := serveTLS(t, &conf, hello)
+			resp, e := tlsClient(c.client).Get("https://" + addr + "/")
+			if "" == c.want {
+				if nil == e {
+					resp.Body.Close()
+					t.Fatal("the client was accepted")
+				}
+				return
+			}
+			if e != nil {
+				t.Fatal(e)
+			}
+			defer resp.Body.Close()
+			b, _ := io.ReadAll(resp.Body)
+			if "HTTP/2.0 "+c.want != string(b) {
+				t.Fatalf("got %q, want %s", b, c.want)
+			}
+		})
+	}
+
+	var conf = base
+	conf.ClientAuth = "always"
+	if _, _, e := newTLSConfig(&conf); nil == e {
+		t.Error("client_auth always was accepted")
+	}
+	conf.ClientAuth, conf.ClientCAFile = "", emptyCA
+	if _, _, e := newTLSConfig(&conf); nil == e {
+		t.Error("a client_ca_file without certificate was accepted")
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		ca       = newTestCA(t, "test ca")
+		crt, key = ca.issue(t, "first", false)
+		conf     = httpsConfig{CertFile: writeTestFile(t, dir, "server.crt", crt), KeyFile: writeTestFile(t, dir, "server.key", key)}
+		served   = func(addr string) string {
+			conn, e := tls.Dial("tcp", addr, &tls.Config{RootCAs: ca.pool(), ServerName: "localhost"})
+			if e != nil {
+				t.Fatal(e)
+			}
+			defer conn.Close()
+			return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+		}
+	)
+	addr, reloader := serveTLS(t, &conf, hello)
+	if name := served(addr); "first" != name {
+		t.Fatalf("served %s", name)
+	}
+
+	crt, key = ca.issue(t, "second", false)
+	writeTestFile(t, dir, "server.crt", crt)
+	writeTestFile(t, dir, "server.key", key)
+	if name := served(addr); "first" != name {
+		t.Fatalf("served %s before the reload", name)
+	}
+	if e := reloader.reload(); e != nil {
+		t.Fatal(e)
+	}
+	if name := served(addr); "second" != name {
+		t.Fatalf("served %s after the reload", name)
+	}
+
+	writeTestFile(t, dir, "server.key", []byte("broken"))
+	if nil == reloader.reload() {
+		t.Fatal("a broken key was loaded")
+	}
+	if name := served(addr); "second" != name {
+		t.Fatalf("served %s after a failed reload", name)
+	}
+}
+
+func TestRedirectToHttps(t *testing.T) {
+	for _, c := range []struct {
+		port   int
+		host   string
+		target string
+		want   string
+	}{
+		{443, "example.com", "/a/b?c=1", "https://example.com/a/b?c=1"},
+		{443, "example.com:8080", "/", "https://example.com/"},
+		{8443, "example.com:8080", "/a?c=1", "https://example.com:8443/a?c=1"},
+		{8443, "[::1]:8080", "/a", "https://[::1]:8443/a"},
+	} {
+		var (
+			rec = httptest.NewRecorder()
+			req = httptest.NewRequest(GET, c.target, nil)
+		)
+		req.Host = c.host
+		redirectToHttps(c.port).ServeHTTP(rec, req)
+		if http.StatusMovedPermanently != rec.Code || c.want != rec.Header().Get("Location") {
+			t.Errorf("%s%s: %d %s, want %s", c.host, c.target, rec.Code, rec.Header().Get("Location"), c.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package httputil
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"io"
@@ -11,6 +12,7 @@ import (
 )
 
 type Request struct {
+	ctx     context.Context
 	url     string
 	body    string
 	method  string
@@ -51,6 +53,11 @@ func (r *Request) SetTimeout(t int) {
 	r.timeout = t
 }
 
+// SetContext cancels the request when ctx is done.
+func (r *Request) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
 func (r *Request) Get(url string) (*Response, error) {
 	r.url = url
 	r.method = "GET"
@@ -107,7 +114,11 @@ func (r *Request) handleRequest() (*Response, error) {
 	}
 	defer c.CloseIdleConnections()
 
-	req, err := http.NewRequest(r.method, r.url, strings.NewReader(r.body))
+	var ctx = r.ctx
+	if nil == ctx {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, r.url, strings.NewReader(r.body))
 	if err != nil {
 		return nil, err
 	}
@@ -311,7 +311,7 @@ func fillStruct(outType reflect.Type, outValue reflect.Value, name string, value
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < INT8_MIN || f > INT8_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo int8 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo int8 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(int8(f)))
 			case reflect.String:
@@ -338,7 +338,7 @@ func fillStruct(outType reflect.Type, outValue reflect.Value, name string, value
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < INT16_MIN || f > INT16_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo int16 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo int16 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(int16(f)))
 			case reflect.String:
@@ -365,7 +365,7 @@ func fillStruct(outType reflect.Type, outValue reflect.Value, name string, value
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < INT32_MIN || f > INT32_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo int32 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo int32 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(int32(f)))
 			case reflect.String:
@@ -416,7 +416,7 @@ func fillStruct(outType reflect.Type, outValue reflect.Value, name string, value
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < 0 {
-					return fmt.Errorf("value %t of '%s' can't assignableTo uint '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo uint '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(uint(f)))
 			case reflect.String:
@@ -443,7 +443,7 @@ func fillStruct(outType reflect.Type, outValue reflect.Value, name string, value
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < 0 || f > UINT8_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo uint8 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo uint8 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(uint8(f)))
 			case reflect.String:
@@ -470,7 +470,7 @@ func fillStruct(outType reflect.Type, outValue reflect.Value, name string, value
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < 0 || f > UINT16_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo uint16 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo uint16 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(uint16(f)))
 			case reflect.String:
@@ -497,7 +497,7 @@ func fillStruct(outType reflect.Type, outValue reflect.Value, name string, value
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < 0 || f > UINT32_MAX {
-					return fmt.Errorf("value %t of '%s' can't assignableTo uint32 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo uint32 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(uint32(f)))
 			case reflect.String:
@@ -524,7 +524,7 @@ func fillStruct(outType reflect.Type, outValue reflect.Value, name string, value
 			case reflect.Float64:
 				f, _ := value.(float64)
 				if f < 0 {
-					return fmt.Errorf("value %t of '%s' can't assignableTo uint64 '%s'", f, name, field.Name)
+					return fmt.Errorf("value %v of '%s' can't assignableTo uint64 '%s'", f, name, field.Name)
 				}
 				org.Set(reflect.ValueOf(uint64(f)))
 			case reflect.String:
@@ -0,0 +1,226 @@
+package wgo
+
+import (
+	"log"
+	"strings"
+)
+
+// --------------------------------------------------------------------------------
+// compressed prefix tree, one per subdomain and http method
+//
+// a route path is made of static segments, '/:name' param segments and an
+// optional trailing '/*' (or '/*name') catch-all segment. when several routes
+// can match a request path the precedence is static > param > catch-all,
+// checked segment by segment with backtracking.
+// --------------------------------------------------------------------------------
+type nodeKind uint8
+
+const (
+	staticNode nodeKind = iota
+	paramNode
+	catchAllNode
+)
+
+type node struct {
+	kind     nodeKind
+	prefix   string
+	indices  string
+	children []*node
+	param    *node
+	catchAll *node
+	route    *Router
+}
+
+// routeTree holds the routes of one routeNamespace. the '/*' route registered
+// at the root of a namespace is kept aside as fallback, it is only used when
+// nothing else matches, the same way it always was.
+type routeTree struct {
+	subdomain string
+	root      *node
+	fallback  *Router
+}
+
+func newRouteTree(rns *routeNamespace) *routeTree {
+	t := &routeTree{subdomain: rns.subdomain, root: &node{kind: staticNode}}
+	for _, route := range rns.routers {
+		t.add(route)
+	}
+	return t
+}
+
+func (t *routeTree) add(route *Router) {
+	if "/*" == route.Path {
+		if nil != t.fallback {
+			log.Panicf("route path '/*' of subdomain '%s' registered twice", t.subdomain)
+		}
+		t.fallback = route
+		return
+	}
+	t.root.insert(route.Path, route, true)
+}
+
+// lookup returns the matched route with the values of its path params in order.
+// a route that only matches a leading part of the path, ending on a '/', is
+// used when no route matches the whole path, the longest of them wins.
+func (t *routeTree) lookup(path string) (*Router, []string) {
+	var fb prefixMatch
+	if route, values := t.root.search(path, 0, nil, &fb); nil != route {
+		return route, values
+	}
+	if nil != fb.route {
+		return fb.route, fb.values
+	}
+	return t.fallback, nil
+}
+
+type prefixMatch struct {
+	route  *Router
+	values []string
+	depth  int
+}
+
+func (n *node) insert(path string, route *Router, seg bool) {
+	var i, max = 0, len(n.prefix)
+	if len(path) < max {
+		max = len(path)
+	}
+	for i < max && path[i] == n.prefix[i] {
+		i++
+	}
+
+	if i < len(n.prefix) {
+		child := &node{
+			kind:     staticNode,
+			prefix:   n.prefix[i:],
+			indices:  n.indices,
+			children: n.children,
+			param:    n.param,
+			catchAll: n.catchAll,
+			route:    n.route,
+		}
+		n.prefix = n.prefix[:i]
+		n.indices = child.prefix[:1]
+		n.children = []*node{child}
+		n.param = nil
+		n.catchAll = nil
+		n.route = nil
+	}
+
+	if i > 0 {
+		seg = '/' == n.prefix[i-1]
+	}
+	n.insertChild(path[i:], route, seg)
+}
+
+func (n *node) insertChild(path string, route *Router, seg bool) {
+	if 0 == len(path) {
+		if nil != n.route {
+			log.Panicf("route path '%s' conflicts with registered '%s'", route.Path, n.route.Path)
+		}
+		n.route = route
+		return
+	}
+
+	if seg && ':' == path[0] {
+		end := strings.IndexByte(path, '/')
+		if -1 == end {
+			end = len(path)
+		}
+		if 1 == end {
+			log.Panicf("route path '%s' has param without name", route.Path)
+		}
+		if nil == n.param {
+			n.param = &node{kind: paramNode}
+		}
+		n.param.insertChild(path[end:], route, false)
+		return
+	}
+
+	if seg && '*' == path[0] {
+		if -1 != strings.IndexByte(path, '/') {
+			log.Panicf("catch-all must be the last segment of route path '%s'", route.Path)
+		}
+		if nil != n.catchAll {
+			log.Panicf("route path '%s' conflicts with registered '%s'", route.Path, n.catchAll.route.Path)
+		}
+		n.catchAll = &node{kind: catchAllNode, route: route}
+		return
+	}
+
+	for k := 0; k < len(n.indices); k++ {
+		if n.indices[k] == path[0] {
+			n.children[k].insert(path, route, seg)
+			return
+		}
+	}
+
+	end := nextWildcard(path)
+	child := &node{kind: staticNode, prefix: path[:end]}
+	n.indices += path[:1]
+	n.children = append(n.children, child)
+	child.insertChild(path[end:], route, '/' == path[end-1])
+}
+
+func (n *node) search(path string, depth int, values []string, fb *prefixMatch) (*Router, []string) {
+	if staticNode == n.kind {
+		if !strings.HasPrefix(path, n.prefix) {
+			return nil, nil
+		}
+		path = path[len(n.prefix):]
+		depth += len(n.prefix)
+	}
+
+	if 0 == len(path) {
+		if nil != n.route {
+			return n.route, values
+		}
+		if nil != n.catchAll {
+			return n.catchAll.route, append(values[:len(values):len(values)], "")
+		}
+		return nil, nil
+	}
+
+	if nil != n.route && '/' == path[0] && depth > fb.depth {
+		fb.route = n.route
+		fb.values = values
+		fb.depth = depth
+	}
+
+	for k := 0; k < len(n.indices); k++ {
+		if n.indices[k] == path[0] {
+			if route, vals := n.children[k].search(path, depth, values, fb); nil != route {
+				return route, vals
+			}
+			break
+		}
+	}
+
+	if nil != n.param {
+		end := strings.IndexByte(path, '/')
+		if -1 == end {
+			end = len(path)
+		}
+		if end > 0 {
+			vals := append(values[:len(values):len(values)], path[:end])
+			if route, vals := n.param.search(path[end:], depth+end, vals, fb); nil != route {
+				return route, vals
+			}
+		}
+	}
+
+	if nil != n.catchAll {
+		return n.catchAll.route, append(values[:len(values):len(values)], path)
+	}
+	return nil, nil
+}
+
+// nextWildcard returns the index of the first ':' or '*' that starts a path
+// segment, or len(path) if there is none.
+func nextWildcard(path string) int {
+	for i := 1; i < len(path); i++ {
+		if ('/' == path[i-1]) && (':' == path[i] || '*' == path[i]) {
+			return i
+		}
+	}
+	return len(path)
+}
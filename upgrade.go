@@ -0,0 +1,180 @@
+package wgo
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listeners passed by a parent process or by systemd socket activation start
+// at fd 3, LISTEN_FDS gives their number and LISTEN_FDNAMES their names
+// separated by ':'. a listener is taken by name first, then by address.
+const listenFdsStart = 3
+
+type namedListener struct {
+	name string
+	ln   net.Listener
+}
+
+// inherited are the listeners passed to the process, the first app created
+// takes them all, a fd can only be served by one app.
+var inherited = struct {
+	sync.Mutex
+	loaded bool
+	list   []namedListener
+}{}
+
+func takeInheritedListeners() []namedListener {
+	inherited.Lock()
+	defer inherited.Unlock()
+	if !inherited.loaded {
+		inherited.loaded = true
+		inherited.list = loadInheritedListeners()
+	}
+	var list = inherited.list
+	inherited.list = nil
+	return list
+}
+
+// listenerPool holds the inherited listeners of an app until they are taken.
+type listenerPool struct {
+	sync.Mutex
+	list []namedListener
+}
+
+// take removes from the pool the listener of name, or else the one of addr.
+func (p *listenerPool) take(name, addr string) net.Listener {
+	p.Lock()
+	defer p.Unlock()
+	for k, l := range p.list {
+		if "" != name && l.name == name {
+			p.list = append(p.list[:k], p.list[k+1:]...)
+			return l.ln
+		}
+	}
+	for k, l := range p.list {
+		if sameAddr(l.ln.Addr(), addr) {
+			p.list = append(p.list[:k], p.list[k+1:]...)
+			return l.ln
+		}
+	}
+	return nil
+}
+
+// close closes the listeners no server took.
+func (p *listenerPool) close() {
+	p.Lock()
+	defer p.Unlock()
+	for _, l := range p.list {
+		l.ln.Close()
+	}
+	p.list = nil
+}
+
+func loadInheritedListeners() (list []namedListener) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	if pid := os.Getenv("LISTEN_PID"); "" != pid && pid != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil
+	}
+
+	var names = strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < n; i++ {
+		f := os.NewFile(uintptr(listenFdsStart+i), "listener")
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+
+		var nl = namedListener{ln: ln}
+		if i < len(names) {
+			nl.name = names[i]
+		}
+		list = append(list, nl)
+	}
+	return list
+}
+
+func sameAddr(a net.Addr, addr string) bool {
+	if strings.HasPrefix(addr, "unix:") {
+		return "unix" == a.Network() && a.String() == addr[len("unix:"):]
+	}
+	if a.String() == addr {
+		return true
+	}
+
+	want, err := net.ResolveTCPAddr("tcp", addr)
+	got, ok := a.(*net.TCPAddr)
+	if err != nil || !ok || want.Port != got.Port {
+		return false
+	}
+	return nil == want.IP || want.IP.IsUnspecified() && got.IP.IsUnspecified() || want.IP.Equal(got.IP)
+}
+
+// Upgrade starts the executable again with the listeners of this process, the
+// new process serves on them at once, this one keeps serving until it is shut
+// down. SIGUSR2 calls it and then shuts down.
+func (this *app) Upgrade() error {
+	if 0 == len(this.listeners) {
+		return fmt.Errorf("no listener to pass on")
+	}
+
+	var (
+		files []*os.File
+		names []string
+	)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range this.listeners {
+		fl, ok := l.ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener '%s' can't be passed on", l.name)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		if ul, ok := l.ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+		files = append(files, f)
+		names = append(names, l.name)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var env []string
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, "LISTEN_") {
+			env = append(env, e)
+		}
+	}
+	env = append(env, "LISTEN_FDS="+strconv.Itoa(len(files)), "LISTEN_FDNAMES="+strings.Join(names, ":"))
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	return cmd.Start()
+}
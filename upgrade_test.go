@@ -0,0 +1,76 @@
+package wgo
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSameAddr(t *testing.T) {
+	var (
+		tcp  = &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080}
+		all  = &net.TCPAddr{IP: net.IPv6unspecified, Port: 8080}
+		unix = &net.UnixAddr{Name: "/run/wgo.sock", Net: "unix"}
+	)
+	for _, c := range []struct {
+		addr net.Addr
+		want string
+		same bool
+	}{
+		{tcp, "127.0.0.1:8080", true},
+		{tcp, "localhost:8080", true},
+		{tcp, ":8080", true},
+		{tcp, "127.0.0.1:8081", false},
+		{tcp, "10.0.0.1:8080", false},
+		{all, ":8080", true},
+		{all, "0.0.0.0:8080", true},
+		{all, "127.0.0.1:8080", false},
+		{unix, "unix:/run/wgo.sock", true},
+		{unix, "unix:/run/other.sock", false},
+		{tcp, "unix:/run/wgo.sock", false},
+	} {
+		if got := sameAddr(c.addr, c.want); c.same != got {
+			t.Errorf("sameAddr(%s, %s) = %v", c.addr, c.want, got)
+		}
+	}
+}
+
+func TestInheritedListener(t *testing.T) {
+	var lns = make([]net.Listener, 3)
+	for k := range lns {
+		ln, e := net.Listen("tcp", "127.0.0.1:0")
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer ln.Close()
+		lns[k] = ln
+	}
+
+	var a = &app{}
+	a.inherited.list = []namedListener{{name: "public", ln: lns[0]}, {name: "admin", ln: lns[1]}, {name: "spare", ln: lns[2]}}
+	if ln, e := a.listen("admin", "127.0.0.1:1", false); e != nil || lns[1] != ln {
+		t.Fatalf("by name: got %v %v", ln, e)
+	}
+	if ln, e := a.listen("other", lns[0].Addr().String(), false); e != nil || lns[0] != ln {
+		t.Fatalf("by address: got %v %v", ln, e)
+	}
+	if ln := a.inherited.take("public", lns[0].Addr().String()); nil != ln {
+		t.Fatal("a listener was taken twice")
+	}
+	if 2 != len(a.listeners) || "admin" != a.listeners[0].name || "other" != a.listeners[1].name {
+		t.Fatalf("listeners = %v", a.listeners)
+	}
+
+	a.inherited.close()
+	if _, e := lns[2].Accept(); nil == e {
+		t.Fatal("the listener no server took is still open")
+	}
+	if _, e := net.Dial("tcp", lns[0].Addr().String()); e != nil {
+		t.Fatalf("a taken listener was closed: %v", e)
+	}
+}
+
+func TestUpgradeWithoutListener(t *testing.T) {
+	if e := (&app{}).Upgrade(); nil == e {
+		t.Fatal("upgraded without listener")
+	}
+}
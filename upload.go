@@ -0,0 +1,206 @@
+package wgo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+var (
+	ErrFileTooLarge = errors.New("uploaded file is too large")
+	ErrFileType     = errors.New("uploaded file type is not allowed")
+	ErrFileName     = errors.New("uploaded file name is not allowed")
+)
+
+var fileHeaderType = reflect.TypeOf(multipart.FileHeader{})
+
+// isFileType reports whether t is *multipart.FileHeader or a slice of them,
+// those params and struct fields bind from the files of a multipart form.
+func isFileType(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Ptr && t.Elem() == fileHeaderType
+}
+
+// GetFile returns the first file of a multipart form field, nil when there
+// is none.
+func (r *HttpRequest) GetFile(key string) *multipart.FileHeader {
+	if fhs := r.GetFiles(key); len(fhs) > 0 {
+		return fhs[0]
+	}
+	return nil
+}
+
+func (r *HttpRequest) GetFiles(key string) []*multipart.FileHeader {
+	if nil != r.parseForm() || nil == r.Request.MultipartForm {
+		return nil
+	}
+	return r.Request.MultipartForm.File[key]
+}
+
+// SaveOptions of SaveFile.
+//
+// MaxSize is the bytes a file may have, 0 means no limit. Types are the mime
+// types allowed, "image/*" allows every image, empty allows all. Name is the
+// file name without extension, a random one is used when it is empty.
+type SaveOptions struct {
+	MaxSize int64
+	Types   []string
+	Name    string
+}
+
+// SaveFile stores an uploaded file in dir and returns its path. the type is
+// sniffed from the content, not taken from the client, and gives the
+// extension, the name of the client is never used for the path.
+func (r *HttpRequest) SaveFile(fh *multipart.FileHeader, dir string, opts SaveOptions) (string, error) {
+	if opts.MaxSize > 0 && fh.Size > opts.MaxSize {
+		return "", ErrFileTooLarge
+	}
+
+	name := opts.Name
+	if "" == name {
+		var b = make([]byte, 16)
+		if _, e := rand.Read(b); e != nil {
+			return "", e
+		}
+		name = hex.EncodeToString(b)
+	} else if name != filepath.Base(name) || "." == name || ".." == name || strings.ContainsAny(name, `/\`) {
+		return "", ErrFileName
+	}
+
+	src, e := fh.Open()
+	if e != nil {
+		return "", e
+	}
+	defer src.Close()
+
+	var head = make([]byte, 512)
+	n, e := io.ReadFull(src, head)
+	if e != nil && e != io.ErrUnexpectedEOF && e != io.EOF {
+		return "", e
+	}
+	head = head[:n]
+
+	ctype, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !allowedType(ctype, opts.Types) {
+		return "", ErrFileType
+	}
+
+	if e = os.MkdirAll(dir, 0755); e != nil {
+		return "", e
+	}
+	dst := filepath.Join(dir, name+fileExt(ctype, fh.Filename))
+	if filepath.Dir(dst) != filepath.Clean(dir) {
+		return "", ErrFileName
+	}
+
+	f, e := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if e != nil {
+		return "", e
+	}
+
+	var body io.Reader = io.MultiReader(bytes.NewReader(head), src)
+	if opts.MaxSize > 0 {
+		body = io.LimitReader(body, opts.MaxSize+1)
+	}
+	written, e := io.Copy(f, body)
+	if ce := f.Close(); nil == e {
+		e = ce
+	}
+	if nil == e && opts.MaxSize > 0 && written > opts.MaxSize {
+		e = ErrFileTooLarge
+	}
+	if e != nil {
+		os.Remove(dst)
+		return "", e
+	}
+	return dst, nil
+}
+
+func allowedType(ctype string, types []string) bool {
+	if 0 == len(types) {
+		return true
+	}
+	for _, t := range types {
+		if t == ctype || (strings.HasSuffix(t, "/*") && strings.HasPrefix(ctype, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+var preferredExts = map[string]string{
+	"image/jpeg":               ".jpg",
+	"image/png":                ".png",
+	"image/gif":                ".gif",
+	"image/webp":               ".webp",
+	"image/bmp":                ".bmp",
+	"application/pdf":          ".pdf",
+	"application/zip":          ".zip",
+	"text/plain":               ".txt",
+	"video/mp4":                ".mp4",
+	"audio/mpeg":               ".mp3",
+	"application/octet-stream": ".bin",
+}
+
+// fileExt returns the extension of a sniffed mime type. the extension of the
+// client file name is kept when it is of the same type, or of a text format
+// the sniffing sees as text/plain.
+func fileExt(ctype, filename string) string {
+	if ext := strings.ToLower(filepath.Ext(filename)); "" != ext && isSimpleExt(ext) {
+		t, _, e := mime.ParseMediaType(mime.TypeByExtension(ext))
+		if nil == e && (t == ctype || ("text/plain" == ctype && plainText(t))) {
+			return ext
+		}
+	}
+	if ext, ok := preferredExts[ctype]; ok {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(ctype); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// plainText reports whether a file of type t may sniff as text/plain and be
+// stored with its extension, not the ones browsers run.
+func plainText(t string) bool {
+	switch t {
+	case "text/csv", "text/markdown", "text/x-markdown", "application/json", "application/x-yaml", "text/yaml":
+		return true
+	}
+	return false
+}
+
+func isSimpleExt(ext string) bool {
+	if len(ext) > 10 {
+		return false
+	}
+	for _, c := range ext[1:] {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// bindFiles sets a file param or struct field of type t.
+func bindFiles(t reflect.Type, fhs []*multipart.FileHeader) reflect.Value {
+	if 0 == len(fhs) {
+		return reflect.Zero(t)
+	}
+	if t.Kind() == reflect.Slice {
+		return reflect.ValueOf(fhs).Convert(t)
+	}
+	return reflect.ValueOf(fhs[0]).Convert(t)
+}
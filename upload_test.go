@@ -0,0 +1,206 @@
+package wgo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var pngData = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89")
+
+// multipartBody is a form of name=value fields and files named "field:filename".
+func multipartBody(t *testing.T, fields map[string]string, files map[string][]byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var (
+		buf bytes.Buffer
+		mw  = multipart.NewWriter(&buf)
+	)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	for k, data := range files {
+		field, name, _ := strings.Cut(k, ":")
+		w, e := mw.CreateFormFile(field, name)
+		if e != nil {
+			t.Fatal(e)
+		}
+		w.Write(data)
+	}
+	mw.Close()
+	return &buf, mw.FormDataContentType()
+}
+
+// fileHeader returns the header of an uploaded file, as the server parses it.
+func fileHeader(t *testing.T, name string, data []byte) *multipart.FileHeader {
+	t.Helper()
+	body, ctype := multipartBody(t, nil, map[string][]byte{"f:" + name: data})
+	req, _ := http.NewRequest(POST, "/", body)
+	req.Header.Set("Content-Type", ctype)
+	if e := req.ParseMultipartForm(1 << 20); e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { req.MultipartForm.RemoveAll() })
+	return req.MultipartForm.File["f"][0]
+}
+
+func TestSaveFile(t *testing.T) {
+	var dir = t.TempDir()
+	for _, c := range []struct {
+		name     string
+		filename string
+		data     []byte
+		opts     SaveOptions
+		want     string
+		err      error
+	}{
+		{"png", "a.png", pngData, SaveOptions{Name: "avatar", Types: []string{"image/*"}}, "avatar.png", nil},
+		{"extension of the content", "a.txt", pngData, SaveOptions{Name: "b"}, "b.png", nil},
+		{"csv keeps its extension", "list.csv", []byte("a,b\n1,2\n"), SaveOptions{Name: "c"}, "c.csv", nil},
+		{"pdf named txt", "doc.txt", []byte("%PDF-1.4\n"), SaveOptions{Name: "d"}, "d.pdf", nil},
+		{"type not allowed", "a.png", []byte("just text"), SaveOptions{Name: "e", Types: []string{"image/png"}}, "", ErrFileType},
+		{"too large", "a.png", pngData, SaveOptions{Name: "f", MaxSize: 10}, "", ErrFileTooLarge},
+		{"name with a dir", "a.png", pngData, SaveOptions{Name: "../g"}, "", ErrFileName},
+		{"name dot dot", "a.png", pngData, SaveOptions{Name: ".."}, "", ErrFileName},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			path, e := (&HttpRequest{}).SaveFile(fileHeader(t, c.filename, c.data), dir, c.opts)
+			if !errors.Is(e, c.err) {
+				t.Fatalf("error = %v, want %v", e, c.err)
+			}
+			if nil != c.err {
+				if "" != path {
+					t.Fatalf("path = %s", path)
+				}
+				return
+			}
+			if filepath.Join(dir, c.want) != path {
+				t.Fatalf("path = %s, want %s", path, c.want)
+			}
+			if data, _ := os.ReadFile(path); !bytes.Equal(c.data, data) {
+				t.Fatalf("saved %q", data)
+			}
+		})
+	}
+
+	path, e := (&HttpRequest{}).SaveFile(fileHeader(t, "../../etc/passwd", pngData), dir, SaveOptions{})
+	if e != nil || dir != filepath.Dir(path) || ".png" != filepath.Ext(path) {
+		t.Fatalf("random name: %s %v", path, e)
+	}
+}
+
+// attachments is a named slice of files, bound as []*multipart.FileHeader.
+type attachments []*multipart.FileHeader
+
+type profile struct {
+	Name  string                `json:"name"`
+	Photo *multipart.FileHeader `form:"photo"`
+	Extra attachments           `form:"extra"`
+}
+
+type uploadController struct {
+	WgoController
+}
+
+func (this *uploadController) Upload(avatar *multipart.FileHeader, docs []*multipart.FileHeader, title string) []byte {
+	var names []string
+	for _, fh := range append([]*multipart.FileHeader{avatar}, docs...) {
+		if nil == fh {
+			names = append(names, "nil")
+		} else {
+			names = append(names, fmt.Sprintf("%s:%d", fh.Filename, fh.Size))
+		}
+	}
+	return []byte(title + " " + strings.Join(names, " "))
+}
+
+func (this *uploadController) Profile(p *profile) []byte {
+	var photo = "nil"
+	if nil != p.Photo {
+		photo = p.Photo.Filename
+	}
+	return []byte(fmt.Sprint(p.Name, " ", photo, " ", len(p.Extra)))
+}
+
+func TestFileBinding(t *testing.T) {
+	var (
+		c = &uploadController{}
+		a = newTestApp(t, nil)
+	)
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Post("/upload", c, "Upload(avatar *multipart.FileHeader, docs []*multipart.FileHeader, title string)")
+			m.Post("/profile", c, "Profile(p *profile)")
+		})
+	})
+	var url = serveTestApp(t, a).URL
+
+	for _, c := range []struct {
+		name   string
+		path   string
+		fields map[string]string
+		files  map[string][]byte
+		want   string
+	}{
+		{"params", "/upload", map[string]string{"title": "t"}, map[string][]byte{"avatar:a.png": pngData, "docs:x.txt": []byte("x")}, "t a.png:33 x.txt:1"},
+		{"no file", "/upload", map[string]string{"title": "t"}, nil, "t nil"},
+		{"struct", "/profile", map[string]string{"name": "ann"}, map[string][]byte{"photo:p.png": pngData, "extra:1.txt": []byte("1")}, "ann p.png 1"},
+		{"struct with files", "/profile", map[string]string{"name": "cy"}, map[string][]byte{"extra:1.txt": []byte("1"), "extra:2.txt": []byte("2")}, "cy nil 2"},
+		{"struct without file", "/profile", map[string]string{"name": "bob"}, nil, "bob nil 0"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			body, ctype := multipartBody(t, c.fields, c.files)
+			req, _ := http.NewRequest(POST, url+c.path, body)
+			req.Header.Set("Content-Type", ctype)
+			if code, got := testGet(t, nil, req); 200 != code || c.want != got {
+				t.Fatalf("got %d %q, want %q", code, got, c.want)
+			}
+		})
+	}
+
+	t.Run("repeated files", func(t *testing.T) {
+		var (
+			buf bytes.Buffer
+			mw  = multipart.NewWriter(&buf)
+		)
+		for _, name := range []string{"1.txt", "2.txt"} {
+			w, _ := mw.CreateFormFile("docs", name)
+			w.Write([]byte(name))
+		}
+		mw.Close()
+		req, _ := http.NewRequest(POST, url+"/upload", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		if code, got := testGet(t, nil, req); 200 != code || " nil 1.txt:5 2.txt:5" != got {
+			t.Fatalf("got %d %q", code, got)
+		}
+	})
+}
+
+func TestUploadTempFiles(t *testing.T) {
+	var (
+		tmp = t.TempDir()
+		a   = newTestApp(t, map[string]any{"http": map[string]any{"addr": "127.0.0.1", "port": 0, "request_timeout": 5, "max_multipart_memory": 1}})
+	)
+	t.Setenv("TMPDIR", tmp)
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Post("/upload", &uploadController{}, "Upload(avatar *multipart.FileHeader, docs []*multipart.FileHeader, title string)")
+		})
+	})
+	var url = serveTestApp(t, a).URL
+
+	body, ctype := multipartBody(t, map[string]string{"title": "t"}, map[string][]byte{"avatar:a.png": pngData})
+	req, _ := http.NewRequest(POST, url+"/upload", body)
+	req.Header.Set("Content-Type", ctype)
+	if code, got := testGet(t, nil, req); 200 != code || "t a.png:33" != got {
+		t.Fatalf("got %d %q", code, got)
+	}
+	if files, _ := os.ReadDir(tmp); len(files) > 0 {
+		t.Fatalf("%d temp files left", len(files))
+	}
+}
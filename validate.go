@@ -0,0 +1,331 @@
+package wgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// --------------------------------------------------------------------------------
+// validation of the struct params of an action
+//
+//	type SignUp struct {
+//		Name  string `json:"name" validate:"required,min=2,max=64"`
+//		Email string `json:"email" validate:"required,email"`
+//		Role  string `json:"role" validate:"omitempty,oneof=admin user"`
+//		Age   *int   `json:"age" validate:"min=18"`
+//	}
+//
+// min, max and len compare numbers by value and strings, slices and maps by
+// length. the rules are checked once the param is bound, the action is not
+// called when one fails and the client gets 400 with every failing field.
+// a param implementing Validator is checked after its tags passed.
+// --------------------------------------------------------------------------------
+
+// Validator is implemented by action params with checks the tags can't express,
+// the error may be a ValidationErrors to report several fields.
+type Validator interface {
+	Validate() error
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	var msgs = make([]string, 0, len(e))
+	for _, fe := range e {
+		if "" == fe.Field {
+			msgs = append(msgs, fe.Message)
+		} else {
+			msgs = append(msgs, fe.Field+" "+fe.Message)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidationFormatter writes the 400 response of a request whose params failed
+// binding or validation.
+type ValidationFormatter func(w *HttpResponse, r *HttpRequest, errs ValidationErrors)
+
+type validateRule struct {
+	name string
+	num  float64
+	args []string
+}
+
+type fieldRules struct {
+	index     int
+	name      string
+	rules     []validateRule
+	omitempty bool
+	embedded  bool
+}
+
+var structRules sync.Map
+
+// rulesOf parses the validate tags of a struct type, it panics on an unknown
+// rule so a typo shows at route registration.
+func rulesOf(t reflect.Type) []fieldRules {
+	if v, ok := structRules.Load(t); ok {
+		return v.([]fieldRules)
+	}
+
+	var frs []fieldRules
+	for i := 0; i < t.NumField(); i++ {
+		var (
+			f  = t.Field(i)
+			fr = fieldRules{index: i, name: fieldName(f), embedded: isPromoted(f)}
+		)
+		if !f.IsExported() && !fr.embedded {
+			continue
+		}
+		for _, r := range strings.Split(f.Tag.Get("validate"), ",") {
+			if r = strings.TrimSpace(r); "" == r {
+				continue
+			}
+			var (
+				name, arg, _ = strings.Cut(r, "=")
+				rule         = validateRule{name: name}
+				e            error
+			)
+			switch name {
+			case "omitempty":
+				fr.omitempty = true
+				continue
+			case "required", "email":
+			case "min", "max", "len":
+				if rule.num, e = strconv.ParseFloat(arg, 64); e != nil {
+					log.Panicf("validate rule '%s' of %s.%s needs a number", r, t, f.Name)
+				}
+			case "oneof":
+				if rule.args = strings.Fields(arg); 0 == len(rule.args) {
+					log.Panicf("validate rule '%s' of %s.%s needs values", r, t, f.Name)
+				}
+			default:
+				log.Panicf("unknown validate rule '%s' of %s.%s", name, t, f.Name)
+			}
+			fr.rules = append(fr.rules, rule)
+		}
+		frs = append(frs, fr)
+	}
+
+	structRules.Store(t, frs)
+	return frs
+}
+
+// checkValidateTags parses the validate tags of t and of the structs it holds.
+func checkValidateTags(t reflect.Type, seen map[reflect.Type]bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+	for _, fr := range rulesOf(t) {
+		checkValidateTags(t.Field(fr.index).Type, seen)
+	}
+}
+
+// isPromoted reports whether the fields of an embedded struct are the ones of
+// the outer struct in json, exported or not the struct has no json name then.
+func isPromoted(f reflect.StructField) bool {
+	var t = f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return f.Anonymous && t.Kind() == reflect.Struct && "" == name
+}
+
+func fieldName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); "" != name && "-" != name {
+		return name
+	}
+	return f.Name
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *ValidationErrors) {
+	for _, fr := range rulesOf(v.Type()) {
+		var (
+			fv   = v.Field(fr.index)
+			name = prefix + fr.name
+		)
+		if fv.Kind() == reflect.Ptr && fv.IsNil() {
+			for _, r := range fr.rules {
+				if "required" == r.name {
+					*errs = append(*errs, FieldError{Field: name, Rule: r.name, Message: "is required"})
+				}
+			}
+			continue
+		}
+		if fr.omitempty && fv.IsZero() {
+			continue
+		}
+
+		var zero = fv.IsZero()
+		fv = reflect.Indirect(fv)
+		for _, r := range fr.rules {
+			if msg := r.check(fv, zero); "" != msg {
+				*errs = append(*errs, FieldError{Field: name, Rule: r.name, Message: msg})
+				break
+			}
+		}
+		if fr.embedded {
+			validateStruct(fv, prefix, errs)
+		} else {
+			validateValue(fv, name, errs)
+		}
+	}
+}
+
+// validateValue goes into the structs held by a field.
+func validateValue(v reflect.Value, name string, errs *ValidationErrors) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			validateValue(v.Elem(), name, errs)
+		}
+	case reflect.Struct:
+		validateStruct(v, name+".", errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), name+"["+strconv.Itoa(i)+"]", errs)
+		}
+	}
+}
+
+func (r validateRule) check(v reflect.Value, zero bool) string {
+	switch r.name {
+	case "required":
+		if zero {
+			return "is required"
+		}
+	case "min", "max", "len":
+		n, isLen, ok := ruleSize(v)
+		if !ok {
+			return ""
+		}
+		var what = "must be"
+		if isLen {
+			what = "length must be"
+		}
+		if "min" == r.name && n < r.num {
+			return fmt.Sprintf("%s at least %v", what, r.num)
+		}
+		if "max" == r.name && n > r.num {
+			return fmt.Sprintf("%s at most %v", what, r.num)
+		}
+		if "len" == r.name && n != r.num {
+			return fmt.Sprintf("%s %v", what, r.num)
+		}
+	case "email":
+		if v.Kind() != reflect.String {
+			return ""
+		}
+		if a, e := mail.ParseAddress(v.String()); e != nil || a.Address != v.String() {
+			return "must be an email address"
+		}
+	case "oneof":
+		var s = fmt.Sprint(v)
+		for _, a := range r.args {
+			if a == s {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(r.args, ", ")
+	}
+	return ""
+}
+
+func ruleSize(v reflect.Value) (n float64, isLen bool, ok bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	}
+	return 0, false, false
+}
+
+// validateParams checks the struct params bound for an action.
+func validateParams(params []methodParam) (errs ValidationErrors) {
+	for _, p := range params {
+		if !p.IsStruct || !p.StructValue.IsValid() {
+			continue
+		}
+
+		var (
+			v     = p.StructValue
+			iface any
+			n     = len(errs)
+		)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				continue
+			}
+			iface = v.Interface()
+		} else if v.CanAddr() {
+			iface = v.Addr().Interface()
+		} else {
+			iface = v.Interface()
+		}
+
+		validateStruct(reflect.Indirect(v), "", &errs)
+		if len(errs) > n {
+			continue
+		}
+		if vd, ok := iface.(Validator); ok {
+			if e := vd.Validate(); e != nil {
+				var ve ValidationErrors
+				if errors.As(e, &ve) {
+					errs = append(errs, ve...)
+				} else {
+					errs = append(errs, FieldError{Field: p.Name, Rule: "validate", Message: e.Error()})
+				}
+			}
+		}
+	}
+	return
+}
+
+// bodyError turns the error of decoding a json body into the field it is about.
+func bodyError(e error) ValidationErrors {
+	var te *json.UnmarshalTypeError
+	if errors.As(e, &te) {
+		return ValidationErrors{{Field: te.Field, Rule: "type", Message: "must be " + te.Type.String()}}
+	}
+	return ValidationErrors{{Rule: "json", Message: "invalid json body: " + e.Error()}}
+}
+
+// writeValidationErrors is the default ValidationFormatter.
+func writeValidationErrors(res *HttpResponse, req *HttpRequest, errs ValidationErrors) {
+	if acceptsHtml(req) {
+		writeError(res, req, http.StatusBadRequest, errs.Error())
+		return
+	}
+
+	b, _ := json.Marshal(map[string]any{"code": http.StatusBadRequest, "msg": "invalid request params", "errors": errs})
+	res.SetHeader("Content-Type", "application/json")
+	res.WriteHeader(http.StatusBadRequest)
+	res.Writer.Write(b)
+}
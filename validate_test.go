@@ -0,0 +1,202 @@
+package wgo
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type signUp struct {
+	Name    string   `json:"name" validate:"required,min=2,max=8"`
+	Email   string   `json:"email" validate:"required,email"`
+	Role    string   `json:"role" validate:"omitempty,oneof=admin user"`
+	Age     *int     `json:"age" validate:"min=18"`
+	Code    string   `validate:"len=4"`
+	Tags    []string `json:"tags" validate:"max=2"`
+	Address *address `json:"address"`
+}
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type password struct {
+	Password string `json:"password" validate:"required"`
+	Confirm  string `json:"confirm"`
+}
+
+func (p *password) Validate() error {
+	if p.Password != p.Confirm {
+		return errors.New("passwords differ")
+	}
+	return nil
+}
+
+type twoFields struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+func (p twoFields) Validate() error {
+	if "" == p.A && "" == p.B {
+		return ValidationErrors{{Field: "a", Rule: "validate", Message: "or b is required"}, {Field: "b", Rule: "validate", Message: "or a is required"}}
+	}
+	return nil
+}
+
+type paging struct {
+	Page int `json:"page" validate:"min=1"`
+}
+
+type search struct {
+	paging
+	Q string `json:"q" validate:"required"`
+}
+
+func TestValidateParams(t *testing.T) {
+	var (
+		age17, age18 = 17, 18
+		valid        = signUp{Name: "ann", Email: "ann@example.com", Code: "abcd"}
+		with         = func(fn func(*signUp)) signUp {
+			var s = valid
+			fn(&s)
+			return s
+		}
+	)
+	for _, c := range []struct {
+		name  string
+		param any
+		want  string
+	}{
+		{"valid", valid, ""},
+		{"valid with the optional fields", with(func(s *signUp) { s.Role, s.Age, s.Tags = "admin", &age18, []string{"a", "b"} }), ""},
+		{"missing required", signUp{Code: "abcd"}, "name required, email required"},
+		{"min length", with(func(s *signUp) { s.Name = "a" }), "name min"},
+		{"max length counts runes", with(func(s *signUp) { s.Name = "ééééééééé" }), "name max"},
+		{"max length of runes", with(func(s *signUp) { s.Name = "éééééééé" }), ""},
+		{"email", with(func(s *signUp) { s.Email = "Ann <ann@example.com>" }), "email email"},
+		{"oneof", with(func(s *signUp) { s.Role = "root" }), "role oneof"},
+		{"min of a pointer", with(func(s *signUp) { s.Age = &age17 }), "age min"},
+		{"len", with(func(s *signUp) { s.Code = "abc" }), "Code len"},
+		{"max of a slice", with(func(s *signUp) { s.Tags = []string{"a", "b", "c"} }), "tags max"},
+		{"nested struct", with(func(s *signUp) { s.Address = &address{} }), "address.city required"},
+		{"Validate", &password{Password: "a", Confirm: "b"}, "p validate"},
+		{"Validate not called when a tag fails", &password{Confirm: "b"}, "password required"},
+		{"Validate returning ValidationErrors", twoFields{}, "a validate, b validate"},
+		{"Validate passing", twoFields{A: "a"}, ""},
+		{"embedded struct", search{}, "page min, q required"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			for _, fe := range validateParams([]methodParam{{Name: "p", IsStruct: true, StructValue: reflect.ValueOf(c.param)}}) {
+				got = append(got, fe.Field+" "+fe.Rule)
+			}
+			if c.want != strings.Join(got, ", ") {
+				t.Fatalf("got %q, want %q", strings.Join(got, ", "), c.want)
+			}
+		})
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	for _, v := range []any{
+		struct {
+			A string `validate:"requird"`
+		}{},
+		struct {
+			A int `validate:"min=one"`
+		}{},
+		struct {
+			A string `validate:"oneof="`
+		}{},
+		struct {
+			A []struct {
+				B string `validate:"mx=1"`
+			}
+		}{},
+	} {
+		func() {
+			defer func() {
+				if nil == recover() {
+					t.Errorf("the tags of %T were accepted", v)
+				}
+			}()
+			checkValidateTags(reflect.TypeOf(v), map[reflect.Type]bool{})
+		}()
+	}
+}
+
+type signUpController struct {
+	WgoController
+}
+
+func (this *signUpController) SignUp(p *signUp) []byte {
+	return []byte("welcome " + p.Name)
+}
+
+func TestValidation(t *testing.T) {
+	var a = newTestApp(t, nil)
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			m.Post("/signup", &signUpController{}, "SignUp(p *signUp)")
+		})
+	})
+	var url = serveTestApp(t, a).URL + "/signup"
+
+	for _, c := range []struct {
+		name   string
+		body   string
+		code   int
+		fields string
+	}{
+		{"valid", `{"name":"ann","email":"ann@example.com","Code":"abcd"}`, 200, ""},
+		{"invalid", `{"name":"a","email":"ann","Code":"abcd"}`, 400, "name email"},
+		{"type mismatch", `{"name":1,"email":"ann@example.com","Code":"abcd"}`, 400, "name"},
+		{"broken json", `{"name":`, 400, ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest(POST, url, strings.NewReader(c.body))
+			req.Header.Set("Content-Type", "application/json")
+			code, body := testGet(t, nil, req)
+			if c.code != code {
+				t.Fatalf("got %d %s, want %d", code, body, c.code)
+			}
+			if 200 == code {
+				return
+			}
+			var res struct {
+				Code   int          `json:"code"`
+				Errors []FieldError `json:"errors"`
+			}
+			if e := json.Unmarshal([]byte(body), &res); e != nil || 400 != res.Code || 0 == len(res.Errors) {
+				t.Fatalf("body = %s", body)
+			}
+			var fields []string
+			for _, fe := range res.Errors {
+				if "" != fe.Field {
+					fields = append(fields, fe.Field)
+				}
+			}
+			if c.fields != strings.Join(fields, " ") {
+				t.Fatalf("fields = %v, want %s", fields, c.fields)
+			}
+		})
+	}
+
+	t.Run("formatter", func(t *testing.T) {
+		var b = newTestApp(t, nil)
+		b.SetRouteCollection(a.routeCollection)
+		b.SetValidationFormatter(func(w *HttpResponse, r *HttpRequest, errs ValidationErrors) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Writer.Write([]byte(errs.Error()))
+		})
+		req, _ := http.NewRequest(POST, serveTestApp(t, b).URL+"/signup", strings.NewReader(`{"email":"ann@example.com","Code":"abcd"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if code, body := testGet(t, nil, req); http.StatusUnprocessableEntity != code || "name is required" != body {
+			t.Fatalf("got %d %q", code, body)
+		}
+	})
+}
@@ -0,0 +1,766 @@
+package wgo
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// message types of WSConn
+const (
+	WSText   = 1
+	WSBinary = 2
+)
+
+// close codes of RFC 6455
+const (
+	WSCloseNormal          = 1000
+	WSCloseGoingAway       = 1001
+	WSCloseProtocolError   = 1002
+	WSCloseUnsupportedData = 1003
+	WSCloseNoStatus        = 1005
+	WSCloseAbnormal        = 1006
+	WSCloseInvalidPayload  = 1007
+	WSClosePolicyViolation = 1008
+	WSCloseMessageTooBig   = 1009
+	WSCloseInternalError   = 1011
+)
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+
+	wsGUID      = "258EAFA5-E914-47DA-95CA-C5AB0DC11D64"
+	wsCloseWait = 5 * time.Second
+)
+
+var (
+	// ErrWSClosed is returned by the WSConn methods once the close frame has
+	// been sent or the connection is gone.
+	ErrWSClosed = errors.New("websocket closed")
+	// ErrWSHandshake is returned by Websocket and DialWebsocket when the
+	// request or the response is not a valid websocket handshake.
+	ErrWSHandshake = errors.New("bad websocket handshake")
+)
+
+// WSCloseError is returned by ReadMessage when the peer has closed the
+// connection, Code is WSCloseNoStatus when the close frame had none.
+type WSCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WSCloseError) Error() string {
+	return fmt.Sprintf("websocket closed with %d %s", e.Code, e.Reason)
+}
+
+// WebSocket is returned by an action of a GET route to upgrade the request,
+// the function serves the connection, which is closed when it returns, with
+// WSCloseInternalError when it returns an error.
+type WebSocket func(c *WSConn) error
+
+// WSOptions of the websocket handshake, set on routes by the Websocket
+// middleware. ReadLimit is the bytes a message may have, it defaults to
+// websocket_read_limit of the http section. a ping is sent every
+// PingInterval, websocket_ping_interval by default, a connection that sends
+// nothing for two intervals is closed, a negative interval disables it.
+// WriteTimeout bounds the write of a message, 10s by default. Subprotocols
+// are the ones the server speaks, by preference. CheckOrigin replaces the
+// default check, which only accepts an Origin of the same host as the request.
+type WSOptions struct {
+	ReadLimit    int64
+	PingInterval time.Duration
+	WriteTimeout time.Duration
+	Subprotocols []string
+	CheckOrigin  func(r *http.Request) bool
+}
+
+// Websocket sets the handshake options of the routes it wraps, the zero
+// fields keep their defaults.
+func Websocket(opts WSOptions) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w *HttpResponse, r *HttpRequest) {
+			if opts.ReadLimit > 0 {
+				r.wsOptions.ReadLimit = opts.ReadLimit
+			}
+			if 0 != opts.PingInterval {
+				r.wsOptions.PingInterval = opts.PingInterval
+			}
+			if opts.WriteTimeout > 0 {
+				r.wsOptions.WriteTimeout = opts.WriteTimeout
+			}
+			if len(opts.Subprotocols) > 0 {
+				r.wsOptions.Subprotocols = opts.Subprotocols
+			}
+			if nil != opts.CheckOrigin {
+				r.wsOptions.CheckOrigin = opts.CheckOrigin
+			}
+			next(w, r)
+		}
+	}
+}
+
+// WSConn is a websocket connection. messages may be written from any
+// goroutine, only one goroutine may read.
+type WSConn struct {
+	conn         net.Conn
+	br           *bufio.Reader
+	client       bool
+	logger       *log.Logger
+	subprotocol  string
+	readLimit    int64
+	pingInterval time.Duration
+	writeTimeout time.Duration
+
+	wmu       sync.Mutex
+	closeSent bool
+	closed    bool
+	reading   atomic.Bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	onClose   []func(c *WSConn)
+	closeOnce sync.Once
+}
+
+// Websocket upgrades the request to a websocket, the action serves the
+// connection and returns, it is closed then. the error response is already
+// sent when it fails.
+func (this *WgoController) Websocket() (*WSConn, error) {
+	return this.Response.websocket(this.Request)
+}
+
+func (r *HttpResponse) websocket(req *HttpRequest) (*WSConn, error) {
+	if nil != r.wsConn {
+		return r.wsConn, nil
+	}
+
+	var (
+		hr   = req.Request
+		opts = req.wsOptions
+	)
+	if hr.Method != GET || !headerHasToken(hr.Header, "Connection", "upgrade") || !headerHasToken(hr.Header, "Upgrade", "websocket") {
+		writeError(r, req, http.StatusBadRequest, "websocket handshake needs a GET request with Connection: Upgrade and Upgrade: websocket")
+		return nil, ErrWSHandshake
+	}
+	if "13" != hr.Header.Get("Sec-WebSocket-Version") {
+		r.SetHeader("Sec-WebSocket-Version", "13")
+		writeError(r, req, http.StatusUpgradeRequired, "websocket version 13 is required")
+		return nil, ErrWSHandshake
+	}
+	var key = hr.Header.Get("Sec-WebSocket-Key")
+	if b, e := base64.StdEncoding.DecodeString(key); e != nil || 16 != len(b) {
+		writeError(r, req, http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+		return nil, ErrWSHandshake
+	}
+	var checkOrigin = opts.CheckOrigin
+	if nil == checkOrigin {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(hr) {
+		writeError(r, req, http.StatusForbidden, "websocket origin not allowed")
+		return nil, ErrWSHandshake
+	}
+
+	var subprotocol string
+	for _, p := range opts.Subprotocols {
+		if headerHasToken(hr.Header, "Sec-WebSocket-Protocol", p) {
+			subprotocol = p
+			break
+		}
+	}
+
+	conn, brw, e := http.NewResponseController(r.Writer).Hijack()
+	if e != nil {
+		writeError(r, req, http.StatusInternalServerError, "websocket upgrade: "+e.Error())
+		return nil, e
+	}
+	conn.SetDeadline(time.Time{})
+	r.hijacked()
+
+	var h = r.Writer.Header().Clone()
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	h.Set("Sec-WebSocket-Accept", wsAccept(key))
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	if "" != subprotocol {
+		h.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	h.Write(brw)
+	brw.WriteString("\r\n")
+	if e = brw.Flush(); e != nil {
+		conn.Close()
+		return nil, e
+	}
+
+	var c = newWSConn(conn, brw.Reader, false, opts)
+	c.subprotocol, c.logger = subprotocol, req.logger
+	if nil != req.websockets {
+		req.websockets.add(c)
+		c.onClose = append(c.onClose, req.websockets.remove)
+	}
+	r.wsConn = c
+	return c, nil
+}
+
+func newWSConn(conn net.Conn, br *bufio.Reader, client bool, opts WSOptions) *WSConn {
+	var c = &WSConn{
+		conn:         conn,
+		br:           br,
+		client:       client,
+		readLimit:    opts.ReadLimit,
+		pingInterval: opts.PingInterval,
+		writeTimeout: opts.WriteTimeout,
+		done:         make(chan struct{}),
+	}
+	if c.readLimit <= 0 {
+		c.readLimit = 1 << 20
+	}
+	if c.writeTimeout <= 0 {
+		c.writeTimeout = 10 * time.Second
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	if c.pingInterval > 0 {
+		go c.keepAlive()
+	}
+	return c
+}
+
+// serve runs the function returned by an action and closes the connection.
+func (c *WSConn) serve(fn WebSocket) {
+	var e = fn(c)
+	c.wmu.Lock()
+	var closing = c.closeSent || c.closed
+	c.wmu.Unlock()
+	if nil == e || closing || errors.Is(e, ErrWSClosed) || errors.As(e, new(*WSCloseError)) {
+		c.Close(WSCloseNormal, "")
+		return
+	}
+	if !errors.Is(e, net.ErrClosed) && !errors.Is(e, io.EOF) {
+		logf(c.logger, "websocket %s: %s", c.conn.RemoteAddr(), e)
+	}
+	c.Close(WSCloseInternalError, "")
+}
+
+func wsAccept(key string) string {
+	var h = sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// sameOrigin accepts the requests without Origin, which don't come from a
+// browser, and the ones whose Origin has the host of the request.
+func sameOrigin(r *http.Request) bool {
+	var origin = r.Header.Get("Origin")
+	if "" == origin {
+		return true
+	}
+	u, e := url.Parse(origin)
+	return nil == e && strings.EqualFold(u.Host, r.Host)
+}
+
+func headerHasToken(h http.Header, key, token string) bool {
+	for _, v := range h.Values(key) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Context is done once the connection is closing.
+func (c *WSConn) Context() context.Context {
+	return c.ctx
+}
+
+// Subprotocol is the one agreed on in the handshake, empty when none.
+func (c *WSConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+func (c *WSConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage returns the next text or binary message, answering the pings
+// it gets meanwhile. it returns a *WSCloseError once the peer has closed the
+// connection, any error ends the connection.
+func (c *WSConn) ReadMessage() (int, []byte, error) {
+	if !c.reading.CompareAndSwap(false, true) {
+		c.wmu.Lock()
+		defer c.wmu.Unlock()
+		if c.closeSent || c.closed {
+			return 0, nil, ErrWSClosed
+		}
+		return 0, nil, errors.New("websocket: concurrent read")
+	}
+	defer c.reading.Store(false)
+
+	typ, msg, e := c.readMessage()
+	if e != nil {
+		c.shutdown()
+	}
+	return typ, msg, e
+}
+
+func (c *WSConn) readMessage() (int, []byte, error) {
+	var (
+		typ int
+		msg []byte
+	)
+	for {
+		c.wmu.Lock()
+		var closing = c.closeSent
+		c.wmu.Unlock()
+		if c.pingInterval > 0 && !closing {
+			c.conn.SetReadDeadline(time.Now().Add(2 * c.pingInterval))
+		}
+
+		fin, op, payload, e := c.readFrame(c.readLimit - int64(len(msg)))
+		if e != nil {
+			if errors.Is(e, errWSTooLarge) {
+				c.Close(WSCloseMessageTooBig, "")
+			} else if errors.Is(e, errWSProtocol) {
+				c.Close(WSCloseProtocolError, "")
+			}
+			return 0, nil, e
+		}
+
+		switch op {
+		case wsOpPing:
+			if e = c.writeFrame(wsOpPong, payload); e != nil && !errors.Is(e, ErrWSClosed) {
+				return 0, nil, e
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			return 0, nil, c.peerClosed(payload)
+		case wsOpText, wsOpBinary:
+			if 0 != typ {
+				c.Close(WSCloseProtocolError, "")
+				return 0, nil, errWSProtocol
+			}
+			typ = int(op)
+		case wsOpContinuation:
+			if 0 == typ {
+				c.Close(WSCloseProtocolError, "")
+				return 0, nil, errWSProtocol
+			}
+		default:
+			c.Close(WSCloseProtocolError, "")
+			return 0, nil, errWSProtocol
+		}
+
+		msg = append(msg, payload...)
+		if fin {
+			if WSText == typ && !utf8.Valid(msg) {
+				c.Close(WSCloseInvalidPayload, "")
+				return 0, nil, errors.New("websocket: invalid utf-8 in text message")
+			}
+			if nil == msg {
+				msg = []byte{}
+			}
+			return typ, msg, nil
+		}
+	}
+}
+
+// peerClosed handles the close frame of the peer, answering it when this side
+// did not close first.
+func (c *WSConn) peerClosed(payload []byte) error {
+	var ce = &WSCloseError{Code: WSCloseNoStatus}
+	if len(payload) >= 2 {
+		ce.Code = int(binary.BigEndian.Uint16(payload))
+		ce.Reason = string(payload[2:])
+		if !validCloseCode(ce.Code) || !utf8.ValidString(ce.Reason) {
+			c.Close(WSCloseProtocolError, "")
+			return ce
+		}
+	} else if 1 == len(payload) {
+		c.Close(WSCloseProtocolError, "")
+		return ce
+	}
+
+	var code = ce.Code
+	if WSCloseNoStatus == code {
+		code = WSCloseNormal
+	}
+	c.Close(code, "")
+	return ce
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011, code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+var (
+	errWSTooLarge = errors.New("websocket: message too large")
+	errWSProtocol = errors.New("websocket: protocol error")
+)
+
+// readFrame reads a frame of at most max payload bytes.
+func (c *WSConn) readFrame(max int64) (fin bool, op byte, payload []byte, e error) {
+	var head [2]byte
+	if _, e = io.ReadFull(c.br, head[:]); e != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	op = head[0] & 0x0f
+	if head[0]&0x70 != 0 {
+		e = errWSProtocol
+		return
+	}
+
+	var (
+		masked = head[1]&0x80 != 0
+		n      = int64(head[1] & 0x7f)
+	)
+	if masked == c.client {
+		e = errWSProtocol
+		return
+	}
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, e = io.ReadFull(c.br, b[:]); e != nil {
+			return
+		}
+		n = int64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, e = io.ReadFull(c.br, b[:]); e != nil {
+			return
+		}
+		if b[0]&0x80 != 0 {
+			e = errWSProtocol
+			return
+		}
+		n = int64(binary.BigEndian.Uint64(b[:]))
+	}
+	if op >= wsOpClose {
+		if n > 125 || !fin {
+			e = errWSProtocol
+			return
+		}
+	} else if n > max {
+		e = errWSTooLarge
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, e = io.ReadFull(c.br, mask[:]); e != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, e = io.ReadFull(c.br, payload); e != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i&3]
+		}
+	}
+	return
+}
+
+// ReadJSON reads the next message into v.
+func (c *WSConn) ReadJSON(v any) error {
+	_, msg, e := c.ReadMessage()
+	if e != nil {
+		return e
+	}
+	return json.Unmarshal(msg, v)
+}
+
+// WriteMessage sends a WSText or WSBinary message.
+func (c *WSConn) WriteMessage(typ int, data []byte) error {
+	if WSText != typ && WSBinary != typ {
+		return fmt.Errorf("websocket: unknown message type %d", typ)
+	}
+	return c.writeFrame(byte(typ), data)
+}
+
+func (c *WSConn) WriteText(s string) error {
+	return c.writeFrame(wsOpText, []byte(s))
+}
+
+// WriteJSON sends v as a json text message.
+func (c *WSConn) WriteJSON(v any) error {
+	b, e := json.Marshal(v)
+	if e != nil {
+		return e
+	}
+	return c.writeFrame(wsOpText, b)
+}
+
+func (c *WSConn) writeFrame(op byte, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed || c.closeSent {
+		return ErrWSClosed
+	}
+	if wsOpClose == op {
+		c.closeSent = true
+	}
+
+	var frame = make([]byte, 2, 14+len(data))
+	frame[0] = 0x80 | op
+	switch n := len(data); {
+	case n <= 125:
+		frame[1] = byte(n)
+	case n <= 0xffff:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if c.client {
+		var mask [4]byte
+		if _, e := rand.Read(mask[:]); e != nil {
+			return e
+		}
+		frame[1] |= 0x80
+		frame = append(frame, mask[:]...)
+		for i, b := range data {
+			frame = append(frame, b^mask[i&3])
+		}
+	} else {
+		frame = append(frame, data...)
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	if _, e := c.conn.Write(frame); e != nil {
+		// a frame written in part leaves the stream broken.
+		c.closed = true
+		c.conn.Close()
+		return e
+	}
+	return nil
+}
+
+// Close starts the close handshake, the connection is closed once the peer
+// has answered, or after 5s. it returns ErrWSClosed when the close frame has
+// already been sent.
+func (c *WSConn) Close(code int, reason string) error {
+	var payload = binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload = append(payload, reason...)
+
+	var e = c.writeFrame(wsOpClose, payload)
+	c.cancel()
+	if e != nil {
+		if !errors.Is(e, ErrWSClosed) {
+			c.shutdown()
+		}
+		return e
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(wsCloseWait))
+	if c.reading.CompareAndSwap(false, true) {
+		// nobody reads, wait for the answer here.
+		go func() {
+			defer c.reading.Store(false)
+			for {
+				if _, op, _, e := c.readFrame(1 << 20); e != nil || wsOpClose == op {
+					break
+				}
+			}
+			c.shutdown()
+		}()
+	}
+	return nil
+}
+
+// shutdown closes the connection and runs the close hooks, once.
+func (c *WSConn) shutdown() {
+	c.closeOnce.Do(func() {
+		c.wmu.Lock()
+		c.closed = true
+		c.wmu.Unlock()
+		c.conn.Close()
+		c.cancel()
+		close(c.done)
+		for _, fn := range c.onClose {
+			fn(c)
+		}
+	})
+}
+
+// finish is called when the request is over, the connection outlives the
+// action only for the close handshake.
+func (c *WSConn) finish() {
+	if e := c.Close(WSCloseNormal, ""); errors.Is(e, ErrWSClosed) {
+		c.wmu.Lock()
+		var closed = c.closed
+		c.wmu.Unlock()
+		if closed || !c.reading.Load() {
+			c.shutdown()
+		}
+	}
+}
+
+func (c *WSConn) keepAlive() {
+	var ticker = time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if nil != c.writeFrame(wsOpPing, nil) {
+				return
+			}
+		}
+	}
+}
+
+// OnClose adds a func called once the connection is closed.
+func (c *WSConn) OnClose(fn func(c *WSConn)) {
+	c.wmu.Lock()
+	var closed = c.closed
+	if !closed {
+		c.onClose = append(c.onClose, fn)
+	}
+	c.wmu.Unlock()
+	if closed {
+		fn(c)
+	}
+}
+
+// wsSet is the set of open websockets of an app, closed on Shutdown.
+type wsSet struct {
+	sync.Mutex
+	m map[*WSConn]struct{}
+}
+
+func (s *wsSet) add(c *WSConn) {
+	s.Lock()
+	if nil == s.m {
+		s.m = make(map[*WSConn]struct{})
+	}
+	s.m[c] = struct{}{}
+	s.Unlock()
+}
+
+func (s *wsSet) remove(c *WSConn) {
+	s.Lock()
+	delete(s.m, c)
+	s.Unlock()
+}
+
+func (s *wsSet) closeAll(code int, reason string) {
+	s.Lock()
+	var conns = make([]*WSConn, 0, len(s.m))
+	for c := range s.m {
+		conns = append(conns, c)
+	}
+	s.Unlock()
+	for _, c := range conns {
+		c.Close(code, reason)
+	}
+}
+
+// DialWebsocket opens a websocket to a ws:// or wss:// url, to talk to a
+// route from a Go program or a test. ctx bounds the handshake only. the
+// response is returned with ErrWSHandshake when the server refused it.
+func DialWebsocket(ctx context.Context, rawurl string, header http.Header) (*WSConn, *http.Response, error) {
+	u, e := url.Parse(rawurl)
+	if e != nil {
+		return nil, nil, e
+	}
+	var (
+		addr   = u.Host
+		dialer net.Dialer
+		conn   net.Conn
+	)
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+		if "" == u.Port() {
+			addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+		conn, e = dialer.DialContext(ctx, "tcp", addr)
+	case "wss":
+		u.Scheme = "https"
+		if "" == u.Port() {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		}
+		var td = tls.Dialer{NetDialer: &dialer, Config: &tls.Config{ServerName: u.Hostname(), NextProtos: []string{"http/1.1"}}}
+		conn, e = td.DialContext(ctx, "tcp", addr)
+	default:
+		return nil, nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	if e != nil {
+		return nil, nil, e
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var key = make([]byte, 16)
+	rand.Read(key)
+	req := &http.Request{Method: GET, URL: u, Host: u.Host, Header: http.Header{}, Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if e = req.Write(conn); e != nil {
+		conn.Close()
+		return nil, nil, e
+	}
+
+	var br = bufio.NewReader(conn)
+	res, e := http.ReadResponse(br, req)
+	if e != nil {
+		conn.Close()
+		return nil, nil, e
+	}
+	if http.StatusSwitchingProtocols != res.StatusCode || res.Header.Get("Sec-WebSocket-Accept") != wsAccept(req.Header.Get("Sec-WebSocket-Key")) {
+		conn.Close()
+		return nil, res, ErrWSHandshake
+	}
+	conn.SetDeadline(time.Time{})
+
+	var c = newWSConn(conn, br, true, WSOptions{})
+	c.subprotocol = res.Header.Get("Sec-WebSocket-Protocol")
+	return c, res, nil
+}
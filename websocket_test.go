@@ -0,0 +1,293 @@
+package wgo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type wsController struct {
+	WgoController
+	Hub *Hub
+	// Closed gets the read error that ended an Echo, when nobody holds one.
+	Closed chan error
+}
+
+// Echo sends back the messages it reads.
+func (this *wsController) Echo() WebSocket {
+	return func(c *WSConn) error {
+		for {
+			typ, msg, e := c.ReadMessage()
+			if e != nil {
+				select {
+				case this.Closed <- e:
+				default:
+				}
+				return e
+			}
+			if e = c.WriteMessage(typ, msg); e != nil {
+				return e
+			}
+		}
+	}
+}
+
+// Room broadcasts the messages it reads to the room, then tells the sender
+// how many got it.
+func (this *wsController) Room() WebSocket {
+	return func(c *WSConn) error {
+		this.Hub.Join("room", c)
+		for {
+			typ, msg, e := c.ReadMessage()
+			if e != nil {
+				return e
+			}
+			var n = this.Hub.Broadcast("room", typ, msg, c)
+			if e = c.WriteText("sent " + strconv.Itoa(n)); e != nil {
+				return e
+			}
+		}
+	}
+}
+
+func newWSTestServer(t *testing.T, ctrl *wsController) (*app, string) {
+	var a = newTestApp(t, nil)
+	a.SetRouteCollection(func(r *RouteRegister) {
+		r.Registe("", "/", nil, func(um UnitHttpMethod, m HttpMethod) {
+			um.Get(RouteUnit{Path: "/echo", Controller: ctrl, Action: "Echo()", Middlewares: []Middleware{Websocket(WSOptions{ReadLimit: 16, PingInterval: -1})}})
+			m.Get("/room", ctrl, "Room()")
+		})
+	})
+	return a, "ws" + strings.TrimPrefix(serveTestApp(t, a).URL, "http")
+}
+
+func dialWS(t *testing.T, url string, header http.Header) *WSConn {
+	t.Helper()
+	c, _, e := DialWebsocket(context.Background(), url, header)
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(c.shutdown)
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return c
+}
+
+// writeRawFrame writes a masked frame of the client, fin not set when more
+// fragments follow.
+func writeRawFrame(t *testing.T, c *WSConn, fin bool, op byte, data []byte) {
+	t.Helper()
+	var frame = []byte{op, 0x80 | byte(len(data))}
+	if fin {
+		frame[0] |= 0x80
+	}
+	var mask [4]byte
+	rand.Read(mask[:])
+	frame = append(frame, mask[:]...)
+	for i, b := range data {
+		frame = append(frame, b^mask[i&3])
+	}
+	if _, e := c.conn.Write(frame); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func expectMessage(t *testing.T, c *WSConn, typ int, want string) {
+	t.Helper()
+	got, msg, e := c.ReadMessage()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if typ != got || want != string(msg) {
+		t.Fatalf("got %d %q, want %d %q", got, msg, typ, want)
+	}
+}
+
+func expectClose(t *testing.T, c *WSConn, code int) *WSCloseError {
+	t.Helper()
+	_, msg, e := c.ReadMessage()
+	var ce *WSCloseError
+	if !errors.As(e, &ce) || code != ce.Code {
+		t.Fatalf("got %q %v, want a close with %d", msg, e, code)
+	}
+	return ce
+}
+
+func TestWebsocketHandshake(t *testing.T) {
+	_, url := newWSTestServer(t, &wsController{})
+
+	for _, c := range []struct {
+		name   string
+		origin string
+		code   int
+	}{
+		{"no origin", "", http.StatusSwitchingProtocols},
+		{"same origin", "http://" + strings.TrimPrefix(url, "ws://"), http.StatusSwitchingProtocols},
+		{"other origin", "http://evil.example.com", http.StatusForbidden},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var h = http.Header{}
+			if "" != c.origin {
+				h.Set("Origin", c.origin)
+			}
+			conn, res, e := DialWebsocket(context.Background(), url+"/echo", h)
+			if nil != conn {
+				conn.shutdown()
+			}
+			if nil == res || c.code != res.StatusCode {
+				t.Fatalf("got %v %v, want %d", res, e, c.code)
+			}
+			if http.StatusSwitchingProtocols != c.code && !errors.Is(e, ErrWSHandshake) {
+				t.Fatalf("error = %v", e)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest(GET, strings.Replace(url, "ws", "http", 1)+"/echo", nil)
+	if code, _ := testGet(t, nil, req); http.StatusBadRequest != code {
+		t.Errorf("plain GET = %d, want 400", code)
+	}
+}
+
+func TestWebsocketMessages(t *testing.T) {
+	var ctrl = &wsController{Closed: make(chan error, 1)}
+	_, url := newWSTestServer(t, ctrl)
+
+	t.Run("echo", func(t *testing.T) {
+		var c = dialWS(t, url+"/echo", nil)
+		c.WriteText("hello")
+		expectMessage(t, c, WSText, "hello")
+		c.WriteMessage(WSBinary, []byte{0, 1, 2, 0xff})
+		expectMessage(t, c, WSBinary, "\x00\x01\x02\xff")
+		c.WriteText("")
+		expectMessage(t, c, WSText, "")
+	})
+
+	t.Run("fragments with a ping between them", func(t *testing.T) {
+		var c = dialWS(t, url+"/echo", nil)
+		writeRawFrame(t, c, false, wsOpText, []byte("hel"))
+		writeRawFrame(t, c, true, wsOpPing, []byte("p"))
+		writeRawFrame(t, c, false, wsOpContinuation, []byte("lo "))
+		writeRawFrame(t, c, true, wsOpContinuation, []byte("you"))
+		_, op, payload, e := c.readFrame(125)
+		if e != nil || wsOpPong != op || "p" != string(payload) {
+			t.Fatalf("got %x %q %v, want the pong", op, payload, e)
+		}
+		expectMessage(t, c, WSText, "hello you")
+	})
+
+	t.Run("continuation without a start", func(t *testing.T) {
+		var c = dialWS(t, url+"/echo", nil)
+		writeRawFrame(t, c, true, wsOpContinuation, []byte("x"))
+		expectClose(t, c, WSCloseProtocolError)
+	})
+
+	t.Run("invalid utf-8", func(t *testing.T) {
+		var c = dialWS(t, url+"/echo", nil)
+		c.WriteMessage(WSText, []byte{0xff, 0xfe})
+		expectClose(t, c, WSCloseInvalidPayload)
+	})
+
+	for _, c := range []struct {
+		name   string
+		frames []string
+	}{
+		{"message over the read limit", []string{strings.Repeat("a", 17)}},
+		{"fragments over the read limit", []string{strings.Repeat("a", 10), strings.Repeat("a", 10)}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var conn = dialWS(t, url+"/echo", nil)
+			for k, f := range c.frames {
+				var op byte = wsOpText
+				if k > 0 {
+					op = wsOpContinuation
+				}
+				writeRawFrame(t, conn, k == len(c.frames)-1, op, []byte(f))
+			}
+			expectClose(t, conn, WSCloseMessageTooBig)
+		})
+	}
+
+	t.Run("close handshake", func(t *testing.T) {
+		var c = dialWS(t, url+"/echo", nil)
+		for len(ctrl.Closed) > 0 {
+			<-ctrl.Closed
+		}
+		c.Close(WSCloseNormal, "bye")
+		var ce *WSCloseError
+		select {
+		case e := <-ctrl.Closed:
+			if !errors.As(e, &ce) || WSCloseNormal != ce.Code || "bye" != ce.Reason {
+				t.Fatalf("the server read %v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the server did not read the close")
+		}
+		select {
+		case <-c.done:
+		case <-time.After(time.Second):
+			t.Fatal("the close was not answered")
+		}
+		if e := c.WriteText("late"); !errors.Is(e, ErrWSClosed) {
+			t.Fatalf("write after close = %v", e)
+		}
+	})
+
+	t.Run("close answered", func(t *testing.T) {
+		var c = dialWS(t, url+"/echo", nil)
+		c.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, 4000))
+		expectClose(t, c, 4000)
+	})
+}
+
+func TestWebsocketHub(t *testing.T) {
+	var hub = NewHub()
+	_, url := newWSTestServer(t, &wsController{Hub: hub})
+	var waitCount = func(n int) {
+		t.Helper()
+		for deadline := time.Now().Add(time.Second); hub.Count("room") != n; time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("room has %d connections, want %d", hub.Count("room"), n)
+			}
+		}
+	}
+
+	var a, b, c = dialWS(t, url+"/room", nil), dialWS(t, url+"/room", nil), dialWS(t, url+"/room", nil)
+	waitCount(3)
+
+	a.WriteText("hi")
+	expectMessage(t, b, WSText, "hi")
+	expectMessage(t, c, WSText, "hi")
+	// the sender is excepted, the answer is its next message.
+	expectMessage(t, a, WSText, "sent 2")
+
+	b.Close(WSCloseNormal, "")
+	waitCount(2)
+	c.WriteMessage(WSBinary, []byte("bin"))
+	expectMessage(t, a, WSBinary, "bin")
+	expectMessage(t, c, WSText, "sent 1")
+	if rooms := hub.Rooms(); 1 != len(rooms) || "room" != rooms[0] {
+		t.Fatalf("rooms = %v", rooms)
+	}
+}
+
+func TestWebsocketShutdown(t *testing.T) {
+	a, url := newWSTestServer(t, &wsController{})
+	var c = dialWS(t, url+"/echo", nil)
+	c.WriteText("ping")
+	expectMessage(t, c, WSText, "ping")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if e := a.Shutdown(ctx); e != nil {
+		t.Fatal(e)
+	}
+	if ce := expectClose(t, c, WSCloseGoingAway); "server shutting down" != ce.Reason {
+		t.Fatalf("reason = %q", ce.Reason)
+	}
+}